@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"view-list/internal/auth"
+	"view-list/internal/config"
+	"view-list/internal/migrate"
+	"view-list/internal/repository"
+	"view-list/internal/service"
+	"view-list/internal/storage"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Subcomandos que se corren una vez y terminan, en vez de levantar el server
+func runCommand(cfg *config.Config, keys *auth.KeyManager, db *mongo.Database, images, quarantine storage.ImageStore, args []string) error {
+	ctx := context.Background()
+
+	switch args[0] {
+	case "rotate-jwt-key":
+		// Los tokens firmados con las claves anteriores siguen valiendo hasta que salen de las JWT_MAX_KEYS vigentes
+		kid, err := keys.Rotate()
+		if err != nil {
+			return err
+		}
+		log.Printf("New JWT signing key %s saved in %s\n", kid, cfg.JWTKeysFile)
+		return nil
+
+	case "gc-uploads":
+		// gc-uploads [--dry-run]
+		dryRun := len(args) > 1 && args[1] == "--dry-run"
+		imageSvc := commandImageService(cfg, db, images)
+		gc := service.NewUploadGC(repository.NewMangaRepo(db), nil, imageSvc, quarantine, cfg.UploadGCGrace, cfg.QuarantineRetention)
+		report, err := gc.Run(ctx, dryRun)
+		if err != nil {
+			return err
+		}
+		return printJSON(report)
+
+	case "backfill-variants":
+		// backfill-variants [--force]
+		force := len(args) > 1 && args[1] == "--force"
+		imageSvc := commandImageService(cfg, db, images)
+		report, err := service.NewVariantBackfill(repository.NewMangaRepo(db), imageSvc).Run(ctx, force)
+		if err != nil {
+			return err
+		}
+		return printJSON(report)
+
+	case "recalc-storage":
+		// Reconstruye el uso de cada usuario (y los conteos de referencias) desde el storage
+		imageSvc := commandImageService(cfg, db, images)
+		report, err := service.NewStorageRecalc(repository.NewMangaRepo(db), repository.NewUserRepo(db), imageSvc).Run(ctx)
+		if err != nil {
+			return err
+		}
+		return printJSON(report)
+
+	case "migrate":
+		// migrate [status]: aplica las pendientes, o solo muestra cuáles se aplicaron
+		runner := migrate.NewRunner(db, migrate.All(commandImageService(cfg, db, images)))
+		if len(args) > 1 && args[1] == "status" {
+			status, err := runner.Status(ctx)
+			if err != nil {
+				return err
+			}
+			return printJSON(status)
+		}
+		applied, err := runner.Up(ctx)
+		if err != nil {
+			return err
+		}
+		return printJSON(map[string]int{"applied": applied})
+
+	case "migrate-image-keys":
+		// Pasa Manga.Image de URL completa a key de storage (independiente del host y el puerto)
+		migrated, err := service.MigrateImageKeys(ctx, repository.NewMangaRepo(db), commandImageService(cfg, db, images))
+		if err != nil {
+			return err
+		}
+		return printJSON(map[string]int{"migrated": migrated})
+
+	default:
+		return fmt.Errorf("unknown command %q (available: rotate-jwt-key, gc-uploads, backfill-variants, recalc-storage, migrate, migrate-image-keys)", args[0])
+	}
+}
+
+// Los comandos no bajan imágenes de URLs ni firman URLs
+func commandImageService(cfg *config.Config, db *mongo.Database, images storage.ImageStore) *service.ImageService {
+	return service.NewImageService(images, repository.NewImageRefRepo(db), repository.NewUserRepo(db), service.ImageOptions{
+		Limits:    cfg.ImageLimits(),
+		Quota:     int64(cfg.UserStorageQuota),
+		PublicURL: cfg.PublicURL(),
+	})
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -5,11 +5,19 @@ import (
 	"log"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"os/signal"
 	"runtime"
+	"syscall"
+	"time"
+	"view-list/internal/auth"
+	"view-list/internal/config"
+	"view-list/internal/jobs"
+	"view-list/internal/migrate"
+	"view-list/internal/repository"
+	"view-list/internal/service"
 	"view-list/internal/transport/http"
+	"view-list/internal/worker"
 
-	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -32,62 +40,111 @@ func openBrowser(url string) {
 	exec.Command(cmd, args...).Start()
 }
 func main() {
-	staticDir := ""
-	// 1. Cargar .env
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using system environment")
+	// 1. Cargar configuración (archivo, .env y entorno)
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("Invalid configuration:\n", err)
 	}
 
-	env := os.Getenv("APP_ENV")
-	if env == "" {
-		env = "prod"
+	// 1.1 Claves para firmar los JWT (genera una si no hay JWT_SECRET)
+	keys, err := auth.NewKeyManager(cfg.JWTKeysFile, cfg.JWTSecret, cfg.JWTPreviousSecrets, cfg.JWTMaxKeys)
+	if err != nil {
+		log.Fatal("Error loading JWT keys: ", err)
 	}
 
-	if env == "dev" {
-		log.Println("Running in development mode")
-	} else {
-		exePath, err := os.Executable()
+	// 1.2 Storage de imágenes (disco o S3)
+	images, quarantine, jobFiles, err := newImageStores(cfg)
+	if err != nil {
+		log.Fatal("Error configuring image storage: ", err)
+	}
+
+	// 2. Conectar Mongo
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(cfg.MongoURI))
+	if err != nil {
+		log.Fatal("Error connecting to MongoDB:", err)
+	}
+	db := client.Database(cfg.DBName)
+
+	// 2.1 Subcomandos de mantenimiento (ej: server rotate-jwt-key)
+	if len(os.Args) > 1 {
+		err := runCommand(cfg, keys, db, images, quarantine, os.Args[1:])
+		_ = client.Disconnect(context.Background())
 		if err != nil {
 			log.Fatal(err)
 		}
-		baseDir := filepath.Dir(exePath)
-		relativePath := filepath.Join(".", "web", "dist")
-		if _, err := os.Stat(relativePath); err == nil {
-			staticDir = relativePath
-		} else {
-			staticDir = filepath.Join(baseDir, "web", "dist")
-		}
+		return
 	}
 
-	uri := os.Getenv("MONGODB_URI")
-	if uri == "" {
-		uri = "mongodb://localhost:27017"
-	}
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "4090"
-	}
-	dbName := os.Getenv("DB_NAME")
-	if dbName == "" {
-		dbName = "retroskb"
+	if !cfg.IsProd() {
+		log.Println("Running in development mode")
 	}
 
-	// 2. Conectar Mongo
-	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
-	if err != nil {
-		log.Fatal("Error connecting to MongoDB:", err)
+	// 2.2 Índices y migraciones de datos pendientes
+	if cfg.MigrateOnStart {
+		runner := migrate.NewRunner(db, migrate.All(commandImageService(cfg, db, images)))
+		if _, err := runner.Up(context.Background()); err != nil {
+			log.Fatal("Error running migrations: ", err)
+		}
 	}
-	db := client.Database(dbName)
 
-	// 3. Crear router principal
-	app := http.NewRouter(db, staticDir)
+	// 3. Crear la cola de jobs (corre en el worker pool) y el router principal
+	workers := worker.NewPool(cfg.Workers, cfg.Workers)
+	queue := jobs.NewQueue(repository.NewJobRepo(db), workers, jobs.Options{
+		MaxAttempts:  cfg.JobMaxAttempts,
+		BaseBackoff:  cfg.JobBaseBackoff,
+		MaxBackoff:   cfg.JobMaxBackoff,
+		PollInterval: cfg.JobPollInterval,
+		Lease:        15 * time.Minute, // un import grande puede tardar
+		Concurrency:  cfg.Workers,
+	})
+	app := http.NewRouter(db, cfg, keys, queue, images, quarantine, jobFiles)
+	queue.Start()
+	if cfg.UploadGCInterval > 0 {
+		queue.Schedule(service.JobGCUploads, cfg.UploadGCInterval)
+	}
+	if cfg.JobFileTTL > 0 {
+		queue.Schedule(service.JobCleanJobFiles, time.Hour)
+	}
 
 	// 4. Iniciar servidor y abrir navegador
-	if env == "prod" {
-		url := "http://localhost:" + port
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- app.Listen(":" + cfg.Port)
+	}()
+
+	if cfg.IsProd() {
+		url := "http://localhost:" + cfg.Port
 		log.Println("Servidor iniciado en:", url)
 		go openBrowser(url)
 	}
 
-	log.Fatal(app.Listen(":" + port))
+	select {
+	case err := <-listenErr:
+		if err != nil {
+			log.Println("Server error:", err)
+		}
+	case <-ctx.Done():
+		log.Println("Shutting down...")
+	}
+
+	// 5. Apagado ordenado: requests en curso, tareas pendientes y Mongo, todo con el mismo timeout
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := app.ShutdownWithContext(shutdownCtx); err != nil {
+		log.Println("Error shutting down HTTP server:", err)
+	}
+	if err := queue.Stop(shutdownCtx); err != nil {
+		log.Println("Error stopping job queue:", err)
+	}
+	if err := workers.Shutdown(shutdownCtx); err != nil {
+		log.Println("Background tasks did not finish in time:", err)
+	}
+	if err := client.Disconnect(shutdownCtx); err != nil {
+		log.Println("Error disconnecting from MongoDB:", err)
+	}
+	log.Println("Server stopped")
 }
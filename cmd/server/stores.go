@@ -0,0 +1,43 @@
+package main
+
+import (
+	"view-list/internal/config"
+	"view-list/internal/storage"
+)
+
+// Arma el storage de imágenes, el de la cuarentena del recolector y el de los archivos de
+// import/export de los jobs según la config. Con S3 los tres comparten bucket y todas las
+// instancias ven los mismos archivos.
+func newImageStores(cfg *config.Config) (images, quarantine, jobFiles storage.ImageStore, err error) {
+	if cfg.Storage == config.StorageLocal {
+		return storage.NewLocalStore(cfg.UploadsDir), storage.NewLocalStore(cfg.QuarantineDir()), storage.NewLocalStore(cfg.JobFilesDir()), nil
+	}
+
+	s3cfg := storage.S3Config{
+		Endpoint:  cfg.S3Endpoint,
+		Region:    cfg.S3Region,
+		Bucket:    cfg.S3Bucket,
+		AccessKey: cfg.S3AccessKey,
+		SecretKey: cfg.S3SecretKey,
+		Prefix:    cfg.S3Prefix,
+		PathStyle: cfg.S3PathStyle,
+	}
+	s3Images, err := storage.NewS3Store(s3cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Misma bucket, otro prefijo que no se sirve por /uploads
+	s3cfg.Prefix = "quarantine/"
+	s3Quarantine, err := storage.NewS3Store(s3cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	s3cfg.Prefix = "jobs/"
+	s3JobFiles, err := storage.NewS3Store(s3cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return s3Images, s3Quarantine, s3JobFiles, nil
+}
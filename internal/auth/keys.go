@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Único algoritmo aceptado. Cualquier token con otro "alg" (none, RS256, ...) se rechaza.
+const SigningAlg = "HS256"
+
+// Largo mínimo del secreto (32 bytes = 256 bits, lo que pide HS256)
+const MinSecretLength = 32
+
+var (
+	ErrWeakSecret = fmt.Errorf("JWT secret must be at least %d characters long", MinSecretLength)
+	ErrUnknownKey = errors.New("Unknown signing key")
+	ErrConfigured = errors.New("JWT_SECRET is configured: rotate it by changing JWT_SECRET and moving the old one to JWT_PREVIOUS_SECRETS")
+)
+
+type Key struct {
+	ID        string    `json:"kid"`
+	Secret    []byte    `json:"secret"` // json lo guarda en base64
+	CreatedAt time.Time `json:"created_at"`
+
+	fromConfig bool // las claves de la config no se persisten
+}
+
+type keyFile struct {
+	Active string `json:"active"`
+	Keys   []Key  `json:"keys"`
+}
+
+// KeyManager centraliza las claves para firmar y verificar los JWT.
+// Firma siempre con la clave activa y verifica con cualquiera de las que sigan vigentes (rotación por "kid").
+type KeyManager struct {
+	mu      sync.RWMutex
+	path    string
+	maxKeys int
+	active  string
+	keys    []Key // la más nueva primero
+}
+
+// NewKeyManager carga las claves persistidas en path.
+// Si hay un secreto configurado se usa como clave activa (y previous solo para verificar);
+// si no hay ninguno se genera uno y se guarda.
+func NewKeyManager(path, configuredSecret string, previous []string, maxKeys int) (*KeyManager, error) {
+	if maxKeys < 1 {
+		maxKeys = 1
+	}
+	km := &KeyManager{path: path, maxKeys: maxKeys}
+
+	if err := km.load(); err != nil {
+		return nil, err
+	}
+
+	if configuredSecret != "" {
+		if len(configuredSecret) < MinSecretLength {
+			return nil, ErrWeakSecret
+		}
+		km.keys = append([]Key{configKey(configuredSecret)}, km.keys...)
+		for _, prev := range previous {
+			if len(prev) < MinSecretLength {
+				return nil, ErrWeakSecret
+			}
+			km.keys = append(km.keys, configKey(prev))
+		}
+		km.active = km.keys[0].ID
+		return km, nil
+	}
+
+	if km.active == "" {
+		if _, err := km.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return km, nil
+}
+
+// Rotate genera una clave nueva, la deja como activa y descarta las más viejas si se pasa de maxKeys.
+func (km *KeyManager) Rotate() (string, error) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	if current, ok := km.find(km.active); ok && current.fromConfig {
+		return "", ErrConfigured
+	}
+
+	secret := make([]byte, 64)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	key := Key{ID: secretID(secret), Secret: secret, CreatedAt: time.Now()}
+
+	km.keys = append([]Key{key}, km.keys...)
+	if len(km.keys) > km.maxKeys {
+		km.keys = km.keys[:km.maxKeys]
+	}
+	km.active = key.ID
+
+	if err := km.save(); err != nil {
+		return "", err
+	}
+	return key.ID, nil
+}
+
+// Sign firma los claims con la clave activa y agrega el "kid" en el header.
+func (km *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	km.mu.RLock()
+	key, ok := km.find(km.active)
+	km.mu.RUnlock()
+	if !ok {
+		return "", ErrUnknownKey
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Secret)
+}
+
+// Parse valida el token contra las claves vigentes, forzando HS256.
+// Los tokens viejos sin "kid" se validan solo contra la clave activa.
+func (km *KeyManager) Parse(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		km.mu.RLock()
+		defer km.mu.RUnlock()
+
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			kid = km.active
+		}
+		key, ok := km.find(kid)
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		return key.Secret, nil
+	}, jwt.WithValidMethods([]string{SigningAlg}))
+}
+
+// ActiveKeyID devuelve el "kid" con el que se firman los tokens nuevos.
+func (km *KeyManager) ActiveKeyID() string {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	return km.active
+}
+
+func (km *KeyManager) find(kid string) (Key, bool) {
+	for _, k := range km.keys {
+		if k.ID == kid {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
+
+func configKey(secret string) Key {
+	return Key{ID: secretID([]byte(secret)), Secret: []byte(secret), CreatedAt: time.Now(), fromConfig: true}
+}
+
+func (km *KeyManager) load() error {
+	data, err := os.ReadFile(km.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading JWT keys file %s: %w", km.path, err)
+	}
+
+	var f keyFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("parsing JWT keys file %s: %w", km.path, err)
+	}
+	for _, k := range f.Keys {
+		if len(k.Secret) < MinSecretLength {
+			return fmt.Errorf("JWT keys file %s: key %s: %w", km.path, k.ID, ErrWeakSecret)
+		}
+	}
+
+	km.keys = f.Keys
+	if _, ok := km.find(f.Active); ok {
+		km.active = f.Active
+	}
+	return nil
+}
+
+// Guarda solo las claves generadas por nosotros, con permisos 0600
+func (km *KeyManager) save() error {
+	if dir := filepath.Dir(km.path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+
+	f := keyFile{Active: km.active}
+	for _, k := range km.keys {
+		if !k.fromConfig {
+			f.Keys = append(f.Keys, k)
+		}
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := km.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, km.path)
+}
+
+// El kid se deriva del secreto, así no hay que guardarlo aparte y nunca lo expone
+func secretID(secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	secretA = strings.Repeat("a", MinSecretLength)
+	secretB = strings.Repeat("b", MinSecretLength)
+)
+
+func claims(sub string) jwt.MapClaims {
+	return jwt.MapClaims{"sub": sub}
+}
+
+func sign(t *testing.T, km *KeyManager, sub string) string {
+	t.Helper()
+	token, err := km.Sign(claims(sub))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return token
+}
+
+func valid(km *KeyManager, token string) bool {
+	parsed, err := km.Parse(token)
+	return err == nil && parsed.Valid
+}
+
+func TestKeyManagerGeneratesAndPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "jwt.json")
+	km, err := NewKeyManager(path, "", nil, 3)
+	if err != nil {
+		t.Fatalf("NewKeyManager: %v", err)
+	}
+	if km.ActiveKeyID() == "" {
+		t.Fatal("no active key generated")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("keys file not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("keys file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	token := sign(t, km, "user_1")
+
+	// Al reiniciar se carga la misma clave y los tokens siguen valiendo
+	again, err := NewKeyManager(path, "", nil, 3)
+	if err != nil {
+		t.Fatalf("reloading: %v", err)
+	}
+	if again.ActiveKeyID() != km.ActiveKeyID() {
+		t.Fatalf("active key changed on reload: %s -> %s", km.ActiveKeyID(), again.ActiveKeyID())
+	}
+	if !valid(again, token) {
+		t.Fatal("token signed before the restart is not valid")
+	}
+}
+
+func TestKeyManagerRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwt.json")
+	km, err := NewKeyManager(path, "", nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := km.ActiveKeyID()
+	oldToken := sign(t, km, "user_1")
+
+	second, err := km.Rotate()
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if second == first || km.ActiveKeyID() != second {
+		t.Fatalf("active key after Rotate = %s (was %s, Rotate returned %s)", km.ActiveKeyID(), first, second)
+	}
+
+	// Los tokens nuevos llevan el kid nuevo y los viejos siguen valiendo
+	newToken := sign(t, km, "user_1")
+	parsed, err := km.Parse(newToken)
+	if err != nil || parsed.Header["kid"] != second {
+		t.Fatalf("new token kid = %v, %v; want %s", parsed.Header["kid"], err, second)
+	}
+	if !valid(km, oldToken) {
+		t.Fatal("token signed with the previous key is no longer valid")
+	}
+
+	// Con maxKeys=2 la tercera rotación descarta la primera clave
+	if _, err := km.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := km.Parse(oldToken); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("token of a discarded key: got %v, want ErrUnknownKey", err)
+	}
+	if !valid(km, newToken) {
+		t.Fatal("token of the previous key is no longer valid")
+	}
+
+	// Lo descartado tampoco vuelve al recargar
+	again, err := NewKeyManager(path, "", nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ActiveKeyID() != km.ActiveKeyID() || valid(again, oldToken) || !valid(again, newToken) {
+		t.Fatal("reloaded keys differ from the rotated ones")
+	}
+}
+
+func TestKeyManagerConfiguredSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwt.json")
+	old, err := NewKeyManager(path, secretB, nil, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken := sign(t, old, "user_1")
+
+	km, err := NewKeyManager(path, secretA, []string{secretB}, 3)
+	if err != nil {
+		t.Fatalf("NewKeyManager: %v", err)
+	}
+	if km.ActiveKeyID() != secretID([]byte(secretA)) {
+		t.Fatal("the configured secret is not the active key")
+	}
+	if !valid(km, oldToken) {
+		t.Fatal("token signed with a previous secret is not valid")
+	}
+	if _, err := km.Rotate(); !errors.Is(err, ErrConfigured) {
+		t.Fatalf("Rotate with JWT_SECRET: got %v, want ErrConfigured", err)
+	}
+	// Los secretos de la config nunca se escriben a disco
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("configured secrets were persisted: %v", err)
+	}
+
+	for _, tt := range []struct {
+		secret   string
+		previous []string
+	}{
+		{"short", nil},
+		{secretA, []string{"short"}},
+	} {
+		if _, err := NewKeyManager(path, tt.secret, tt.previous, 3); !errors.Is(err, ErrWeakSecret) {
+			t.Errorf("NewKeyManager(%q, %q): got %v, want ErrWeakSecret", tt.secret, tt.previous, err)
+		}
+	}
+}
+
+func TestKeyManagerBadKeysFile(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"broken.json": "{",
+		"weak.json":   `{"active":"x","keys":[{"kid":"x","secret":"c2hvcnQ="}]}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewKeyManager(path, "", nil, 3); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestKeyManagerParse(t *testing.T) {
+	km, err := NewKeyManager(filepath.Join(t.TempDir(), "jwt.json"), secretA, nil, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := []byte(secretA)
+
+	signWith := func(method jwt.SigningMethod, kid string, secret interface{}) string {
+		token := jwt.NewWithClaims(method, claims("user_1"))
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		s, err := token.SignedString(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"signed by the manager", sign(t, km, "user_1"), true},
+		// Tokens de antes de la rotación por kid: se validan con la activa
+		{"without kid", signWith(jwt.SigningMethodHS256, "", key), true},
+		{"unknown kid", signWith(jwt.SigningMethodHS256, "0123456789abcdef", key), false},
+		{"wrong secret", signWith(jwt.SigningMethodHS256, km.ActiveKeyID(), []byte(secretB)), false},
+		{"HS512", signWith(jwt.SigningMethodHS512, km.ActiveKeyID(), key), false},
+		{"alg none", signWith(jwt.SigningMethodNone, km.ActiveKeyID(), jwt.UnsafeAllowNoneSignatureType), false},
+		{"garbage", "not.a.token", false},
+	}
+	for _, tt := range tests {
+		if got := valid(km, tt.token); got != tt.ok {
+			t.Errorf("%s: valid = %v, want %v", tt.name, got, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// URLSigner firma URLs de /uploads con vencimiento, para que un <img> pueda pedir
+// la imagen sin mandar el JWT. Usa una clave derivada de las del KeyManager, así
+// rota junto con ellas y una firma nunca sirve como token.
+type URLSigner struct {
+	keys *KeyManager
+	ttl  time.Duration
+}
+
+func NewURLSigner(keys *KeyManager, ttl time.Duration) *URLSigner {
+	return &URLSigner{keys: keys, ttl: ttl}
+}
+
+// Sign devuelve la query (exp y sig) para la key. El vencimiento se redondea a ventanas de ttl:
+// dentro de una misma ventana la URL es idéntica y el navegador la puede cachear.
+// Cada URL vale entre ttl y 2*ttl.
+func (s *URLSigner) Sign(key string, now time.Time) url.Values {
+	window := int64(s.ttl.Seconds())
+	exp := (now.Unix()/window + 2) * window
+
+	s.keys.mu.RLock()
+	active, _ := s.keys.find(s.keys.active)
+	s.keys.mu.RUnlock()
+
+	return url.Values{
+		"exp": {strconv.FormatInt(exp, 10)},
+		"sig": {urlSignature(active.Secret, key, exp)},
+	}
+}
+
+// Verify chequea la firma contra todas las claves vigentes y que no esté vencida
+func (s *URLSigner) Verify(key, expParam, sig string, now time.Time) bool {
+	exp, err := strconv.ParseInt(expParam, 10, 64)
+	if err != nil || now.Unix() > exp || sig == "" {
+		return false
+	}
+
+	s.keys.mu.RLock()
+	defer s.keys.mu.RUnlock()
+	for _, k := range s.keys.keys {
+		if hmac.Equal([]byte(sig), []byte(urlSignature(k.Secret, key, exp))) {
+			return true
+		}
+	}
+	return false
+}
+
+func urlSignature(secret []byte, key string, exp int64) string {
+	// Subclave propia para URLs: HMAC(secret, "upload-urls")
+	sub := hmac.New(sha256.New, secret)
+	sub.Write([]byte("upload-urls"))
+
+	mac := hmac.New(sha256.New, sub.Sum(nil))
+	mac.Write([]byte(key + "\n" + strconv.FormatInt(exp, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:18])
+}
@@ -0,0 +1,454 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"view-list/internal/imaging"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EnvDev  = "dev"
+	EnvProd = "prod"
+)
+
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+
+	ServeProxy   = "proxy"
+	ServePresign = "presign"
+)
+
+// Igual a auth.MinSecretLength, duplicado para no acoplar config a auth
+const minJWTSecretLength = 32
+
+// Config centraliza toda la configuración del servidor.
+// Orden de prioridad: defaults < archivo (yaml/toml) < .env < variables de entorno.
+type Config struct {
+	AppEnv     string `yaml:"app_env" toml:"app_env"`
+	Port       string `yaml:"port" toml:"port"`
+	MongoURI   string `yaml:"mongodb_uri" toml:"mongodb_uri"`
+	DBName     string `yaml:"db_name" toml:"db_name"`
+	BackendURL string `yaml:"backend_url" toml:"backend_url"` // URL base pública completa, ej: https://manga.example.com; vacío = links relativos
+	StaticDir  string `yaml:"static_dir" toml:"static_dir"`
+	UploadsDir string `yaml:"uploads_dir" toml:"uploads_dir"`
+	DataDir    string `yaml:"data_dir" toml:"data_dir"`     // archivos internos (claves, imports/exports)
+	BodyLimit  int    `yaml:"body_limit" toml:"body_limit"` // en bytes
+	// Usuarios que pueden ver /api/admin
+	AdminEmails []string `yaml:"admin_emails" toml:"admin_emails"`
+
+	JWTSecret string `yaml:"jwt_secret" toml:"jwt_secret"`
+	// Secretos anteriores, solo para verificar tokens ya emitidos mientras se rota JWT_SECRET
+	JWTPreviousSecrets []string `yaml:"jwt_previous_secrets" toml:"jwt_previous_secrets"`
+	// Dónde se guardan las claves generadas cuando no hay JWT_SECRET (por defecto DATA_DIR/jwt_keys.json)
+	JWTKeysFile string `yaml:"jwt_keys_file" toml:"jwt_keys_file"`
+	JWTMaxKeys  int    `yaml:"jwt_max_keys" toml:"jwt_max_keys"` // claves vigentes para verificar
+
+	// Cuánto se espera a requests y tareas pendientes al apagar el server
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	Workers         int           `yaml:"workers" toml:"workers"` // workers para tareas en segundo plano
+
+	// Corre las migraciones pendientes (índices y datos) al arrancar; si es false hay que usar "server migrate"
+	MigrateOnStart bool `yaml:"migrate_on_start" toml:"migrate_on_start"`
+
+	// Cola de jobs: reintentos con backoff exponencial hasta JobMaxAttempts, después quedan "dead"
+	JobMaxAttempts  int           `yaml:"job_max_attempts" toml:"job_max_attempts"`
+	JobBaseBackoff  time.Duration `yaml:"job_base_backoff" toml:"job_base_backoff"`
+	JobMaxBackoff   time.Duration `yaml:"job_max_backoff" toml:"job_max_backoff"`
+	JobPollInterval time.Duration `yaml:"job_poll_interval" toml:"job_poll_interval"`
+
+	// Recolector de uploads huérfanos (0 en el intervalo lo desactiva; se puede correr a mano)
+	UploadGCInterval    time.Duration `yaml:"upload_gc_interval" toml:"upload_gc_interval"`
+	UploadGCGrace       time.Duration `yaml:"upload_gc_grace" toml:"upload_gc_grace"`
+	QuarantineRetention time.Duration `yaml:"quarantine_retention" toml:"quarantine_retention"`
+	// Cuánto duran los archivos de import/export (DATA_DIR/jobs o jobs/ del bucket; 0 = no se borran)
+	JobFileTTL time.Duration `yaml:"job_file_ttl" toml:"job_file_ttl"`
+
+	// Dónde se guardan las imágenes: "local" (UPLOADS_DIR) o "s3" (cualquier compatible, ej: MinIO)
+	Storage     string `yaml:"storage" toml:"storage"`
+	S3Endpoint  string `yaml:"s3_endpoint" toml:"s3_endpoint"`
+	S3Region    string `yaml:"s3_region" toml:"s3_region"`
+	S3Bucket    string `yaml:"s3_bucket" toml:"s3_bucket"`
+	S3AccessKey string `yaml:"s3_access_key" toml:"s3_access_key"`
+	S3SecretKey string `yaml:"s3_secret_key" toml:"s3_secret_key"`
+	S3Prefix    string `yaml:"s3_prefix" toml:"s3_prefix"`
+	S3PathStyle bool   `yaml:"s3_path_style" toml:"s3_path_style"`
+	// "proxy": el server lee y devuelve la imagen; "presign": redirige a una URL firmada del storage
+	ImageServeMode string        `yaml:"image_serve_mode" toml:"image_serve_mode"`
+	PresignTTL     time.Duration `yaml:"presign_ttl" toml:"presign_ttl"`
+
+	// Límites de las imágenes subidas (se validan por contenido, no por extensión)
+	ImageMaxBytes  int `yaml:"image_max_bytes" toml:"image_max_bytes"`
+	ImageMaxWidth  int `yaml:"image_max_width" toml:"image_max_width"`
+	ImageMaxHeight int `yaml:"image_max_height" toml:"image_max_height"`
+	// Bytes de imágenes que puede ocupar cada usuario (originales + variantes). 0 = sin límite
+	UserStorageQuota int `yaml:"user_storage_quota" toml:"user_storage_quota"`
+	// Descarga de portadas desde una URL (fetch_image). AllowPrivate solo para desarrollo/tests.
+	RemoteFetchTimeout      time.Duration `yaml:"remote_fetch_timeout" toml:"remote_fetch_timeout"`
+	RemoteFetchAllowPrivate bool          `yaml:"remote_fetch_allow_private" toml:"remote_fetch_allow_private"`
+	// Cuánto vale (como mínimo) una URL firmada de /uploads
+	UploadURLTTL time.Duration `yaml:"upload_url_ttl" toml:"upload_url_ttl"`
+}
+
+func defaults() *Config {
+	return &Config{
+		AppEnv:     EnvProd,
+		Port:       "4090",
+		MongoURI:   "mongodb://localhost:27017",
+		DBName:     "retroskb",
+		UploadsDir: "uploads",
+		DataDir:    "data",
+		BodyLimit:  20 * 1024 * 1024,
+
+		JWTMaxKeys: 3,
+
+		ShutdownTimeout: 15 * time.Second,
+		Workers:         4,
+
+		MigrateOnStart: true,
+
+		JobMaxAttempts:  8,
+		JobBaseBackoff:  2 * time.Second,
+		JobMaxBackoff:   10 * time.Minute,
+		JobPollInterval: 2 * time.Second,
+
+		UploadGCInterval:    24 * time.Hour,
+		UploadGCGrace:       24 * time.Hour,
+		QuarantineRetention: 30 * 24 * time.Hour,
+		JobFileTTL:          72 * time.Hour,
+
+		Storage:        StorageLocal,
+		S3Region:       "us-east-1",
+		S3Prefix:       "uploads/",
+		S3PathStyle:    true,
+		ImageServeMode: ServeProxy,
+		PresignTTL:     15 * time.Minute,
+
+		ImageMaxBytes:  10 * 1024 * 1024,
+		ImageMaxWidth:  6000,
+		ImageMaxHeight: 6000,
+
+		UserStorageQuota: 500 * 1024 * 1024,
+
+		RemoteFetchTimeout: 10 * time.Second,
+		UploadURLTTL:       24 * time.Hour,
+	}
+}
+
+// Load arma la configuración y la valida. Si falla, el server no debería arrancar.
+func Load() (*Config, error) {
+	cfg := defaults()
+
+	// 1. Archivo opcional (CONFIG_FILE o config.yaml/config.toml en el cwd)
+	if err := cfg.loadFile(os.Getenv("CONFIG_FILE")); err != nil {
+		return nil, err
+	}
+
+	// 2. .env (no pisa variables que ya estén en el entorno)
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using system environment")
+	}
+
+	// 3. Variables de entorno
+	cfg.loadEnv()
+
+	if cfg.JWTKeysFile == "" {
+		cfg.JWTKeysFile = filepath.Join(cfg.DataDir, "jwt_keys.json")
+	}
+	if cfg.AppEnv == EnvProd && cfg.StaticDir == "" {
+		cfg.StaticDir = resolveStaticDir()
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	if path == "" {
+		for _, candidate := range []string{"config.yaml", "config.yml", "config.toml"} {
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+		if path == "" {
+			return nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file %s: %w", path, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".toml":
+		err = toml.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("unsupported config file format: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() {
+	setString(&c.AppEnv, "APP_ENV")
+	setString(&c.Port, "PORT")
+	setString(&c.MongoURI, "MONGODB_URI")
+	setString(&c.DBName, "DB_NAME")
+	// Nombre viejo: se guardaba sin el puerto y se le pegaba PORT
+	if v := strings.TrimSpace(os.Getenv("BACKEND_URL_WITHOUT_PORT")); v != "" {
+		c.BackendURL = v + c.Port
+	}
+	setString(&c.BackendURL, "BACKEND_URL")
+	setString(&c.JWTSecret, "JWT_SECRET")
+	setList(&c.JWTPreviousSecrets, "JWT_PREVIOUS_SECRETS")
+	setString(&c.JWTKeysFile, "JWT_KEYS_FILE")
+	setInt(&c.JWTMaxKeys, "JWT_MAX_KEYS")
+	setString(&c.StaticDir, "STATIC_DIR")
+	setString(&c.UploadsDir, "UPLOADS_DIR")
+	setString(&c.DataDir, "DATA_DIR")
+	setList(&c.AdminEmails, "ADMIN_EMAILS")
+	setInt(&c.BodyLimit, "BODY_LIMIT")
+	setDuration(&c.ShutdownTimeout, "SHUTDOWN_TIMEOUT")
+	setInt(&c.Workers, "WORKERS")
+	setBool(&c.MigrateOnStart, "MIGRATE_ON_START")
+	setInt(&c.JobMaxAttempts, "JOB_MAX_ATTEMPTS")
+	setDuration(&c.JobBaseBackoff, "JOB_BASE_BACKOFF")
+	setDuration(&c.JobMaxBackoff, "JOB_MAX_BACKOFF")
+	setDuration(&c.JobPollInterval, "JOB_POLL_INTERVAL")
+	setDuration(&c.UploadGCInterval, "UPLOAD_GC_INTERVAL")
+	setDuration(&c.UploadGCGrace, "UPLOAD_GC_GRACE")
+	setDuration(&c.QuarantineRetention, "QUARANTINE_RETENTION")
+	setDuration(&c.JobFileTTL, "JOB_FILE_TTL")
+	setString(&c.Storage, "STORAGE")
+	setString(&c.S3Endpoint, "S3_ENDPOINT")
+	setString(&c.S3Region, "S3_REGION")
+	setString(&c.S3Bucket, "S3_BUCKET")
+	setString(&c.S3AccessKey, "S3_ACCESS_KEY")
+	setString(&c.S3SecretKey, "S3_SECRET_KEY")
+	setString(&c.S3Prefix, "S3_PREFIX")
+	setBool(&c.S3PathStyle, "S3_PATH_STYLE")
+	setString(&c.ImageServeMode, "IMAGE_SERVE_MODE")
+	setDuration(&c.PresignTTL, "PRESIGN_TTL")
+	setInt(&c.ImageMaxBytes, "IMAGE_MAX_BYTES")
+	setInt(&c.ImageMaxWidth, "IMAGE_MAX_WIDTH")
+	setInt(&c.ImageMaxHeight, "IMAGE_MAX_HEIGHT")
+	setInt(&c.UserStorageQuota, "USER_STORAGE_QUOTA")
+	setDuration(&c.RemoteFetchTimeout, "REMOTE_FETCH_TIMEOUT")
+	setBool(&c.RemoteFetchAllowPrivate, "REMOTE_FETCH_ALLOW_PRIVATE")
+	setDuration(&c.UploadURLTTL, "UPLOAD_URL_TTL")
+}
+
+func setString(dst *string, key string) {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		*dst = v
+	}
+}
+
+// Si el valor no es un número queda en -1 para que lo rechace Validate
+func setInt(dst *int, key string) {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			n = -1
+		}
+		*dst = n
+	}
+}
+
+func setBool(dst *bool, key string) {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		*dst = v == "1" || strings.EqualFold(v, "true") || strings.EqualFold(v, "yes")
+	}
+}
+
+// Formato de time.ParseDuration (ej: 15s, 1m). Si es inválido queda en -1
+func setDuration(dst *time.Duration, key string) {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			d = -1
+		}
+		*dst = d
+	}
+}
+
+// Lista separada por comas
+func setList(dst *[]string, key string) {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*dst = list
+}
+
+// Validate revisa que la configuración tenga sentido antes de levantar nada.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.AppEnv != EnvDev && c.AppEnv != EnvProd {
+		errs = append(errs, fmt.Errorf("APP_ENV must be %q or %q, got %q", EnvDev, EnvProd, c.AppEnv))
+	}
+	if p, err := strconv.Atoi(c.Port); err != nil || p < 1 || p > 65535 {
+		errs = append(errs, fmt.Errorf("PORT must be a number between 1 and 65535, got %q", c.Port))
+	}
+	if c.MongoURI == "" {
+		errs = append(errs, errors.New("MONGODB_URI cannot be empty"))
+	}
+	if c.BackendURL != "" {
+		if u, err := url.Parse(c.BackendURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("BACKEND_URL must be an absolute http(s) URL, got %q", c.BackendURL))
+		}
+	}
+	if c.DBName == "" {
+		errs = append(errs, errors.New("DB_NAME cannot be empty"))
+	}
+	if c.UploadsDir == "" {
+		errs = append(errs, errors.New("UPLOADS_DIR cannot be empty"))
+	}
+	if c.DataDir == "" {
+		errs = append(errs, errors.New("DATA_DIR cannot be empty"))
+	}
+	if c.BodyLimit <= 0 {
+		errs = append(errs, errors.New("BODY_LIMIT must be a positive number of bytes"))
+	}
+	// Sin JWT_SECRET se genera y persiste uno al arrancar, pero uno corto no se acepta nunca
+	if c.JWTSecret != "" && len(c.JWTSecret) < minJWTSecretLength {
+		errs = append(errs, fmt.Errorf("JWT_SECRET must be at least %d characters long", minJWTSecretLength))
+	}
+	for _, prev := range c.JWTPreviousSecrets {
+		if len(prev) < minJWTSecretLength {
+			errs = append(errs, fmt.Errorf("JWT_PREVIOUS_SECRETS entries must be at least %d characters long", minJWTSecretLength))
+			break
+		}
+	}
+	if c.JWTMaxKeys < 1 {
+		errs = append(errs, errors.New("JWT_MAX_KEYS must be at least 1"))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("SHUTDOWN_TIMEOUT must be a positive duration (ej: 15s)"))
+	}
+	if c.Workers < 1 {
+		errs = append(errs, errors.New("WORKERS must be at least 1"))
+	}
+	if c.JobMaxAttempts < 1 {
+		errs = append(errs, errors.New("JOB_MAX_ATTEMPTS must be at least 1"))
+	}
+	if c.JobBaseBackoff <= 0 || c.JobMaxBackoff < c.JobBaseBackoff {
+		errs = append(errs, errors.New("JOB_BASE_BACKOFF must be positive and not greater than JOB_MAX_BACKOFF"))
+	}
+	if c.JobPollInterval <= 0 {
+		errs = append(errs, errors.New("JOB_POLL_INTERVAL must be a positive duration"))
+	}
+	if c.JobFileTTL < 0 {
+		errs = append(errs, errors.New("JOB_FILE_TTL must be a valid duration"))
+	}
+	if c.UploadGCInterval < 0 || c.UploadGCGrace < 0 || c.QuarantineRetention < 0 {
+		errs = append(errs, errors.New("UPLOAD_GC_INTERVAL, UPLOAD_GC_GRACE and QUARANTINE_RETENTION must be valid durations"))
+	}
+	switch c.Storage {
+	case StorageLocal:
+	case StorageS3:
+		if c.S3Endpoint == "" || c.S3Bucket == "" || c.S3AccessKey == "" || c.S3SecretKey == "" {
+			errs = append(errs, errors.New("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY are required with STORAGE=s3"))
+		}
+		// La cuarentena y los archivos de jobs van en el mismo bucket: el prefijo de las imágenes no los puede incluir
+		if p := strings.TrimLeft(c.S3Prefix, "/"); p == "" || strings.HasPrefix(p, "quarantine/") || strings.HasPrefix(p, "jobs/") {
+			errs = append(errs, fmt.Errorf("S3_PREFIX must be a folder other than quarantine/ and jobs/, got %q", c.S3Prefix))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("STORAGE must be %q or %q, got %q", StorageLocal, StorageS3, c.Storage))
+	}
+	if c.ImageServeMode != ServeProxy && c.ImageServeMode != ServePresign {
+		errs = append(errs, fmt.Errorf("IMAGE_SERVE_MODE must be %q or %q, got %q", ServeProxy, ServePresign, c.ImageServeMode))
+	}
+	if c.PresignTTL <= 0 {
+		errs = append(errs, errors.New("PRESIGN_TTL must be a positive duration"))
+	}
+	if c.ImageMaxBytes <= 0 || c.ImageMaxWidth <= 0 || c.ImageMaxHeight <= 0 {
+		errs = append(errs, errors.New("IMAGE_MAX_BYTES, IMAGE_MAX_WIDTH and IMAGE_MAX_HEIGHT must be positive integers"))
+	}
+	if c.UserStorageQuota < 0 {
+		errs = append(errs, errors.New("USER_STORAGE_QUOTA must be 0 (unlimited) or a positive number of bytes"))
+	}
+	if c.RemoteFetchTimeout <= 0 {
+		errs = append(errs, errors.New("REMOTE_FETCH_TIMEOUT must be a positive duration"))
+	}
+	if c.UploadURLTTL < time.Minute {
+		errs = append(errs, errors.New("UPLOAD_URL_TTL must be at least 1m"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// ImageLimits son los límites que aplica imaging.Sanitize a cada imagen subida
+func (c *Config) ImageLimits() imaging.Limits {
+	return imaging.Limits{MaxBytes: int64(c.ImageMaxBytes), MaxWidth: c.ImageMaxWidth, MaxHeight: c.ImageMaxHeight}
+}
+
+func (c *Config) IsAdmin(email string) bool {
+	for _, admin := range c.AdminEmails {
+		if strings.EqualFold(admin, email) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) IsProd() bool {
+	return c.AppEnv == EnvProd
+}
+
+// Los huérfanos se mueven acá en vez de borrarse
+func (c *Config) QuarantineDir() string {
+	return filepath.Join(c.DataDir, "quarantine")
+}
+
+// Los archivos de import/export de los jobs, con STORAGE=local
+func (c *Config) JobFilesDir() string {
+	return filepath.Join(c.DataDir, "jobs")
+}
+
+// PublicURL es la URL base con la que se arman los links a /uploads.
+// Sin BACKEND_URL queda vacía y los links son relativos (/uploads/<key>).
+func (c *Config) PublicURL() string {
+	return strings.TrimRight(c.BackendURL, "/")
+}
+
+// En prod el front se sirve desde web/dist, relativo al cwd o al ejecutable
+func resolveStaticDir() string {
+	relativePath := filepath.Join(".", "web", "dist")
+	if _, err := os.Stat(relativePath); err == nil {
+		return relativePath
+	}
+
+	exePath, err := os.Executable()
+	if err != nil {
+		return relativePath
+	}
+	return filepath.Join(filepath.Dir(exePath), "web", "dist")
+}
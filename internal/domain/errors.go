@@ -0,0 +1,9 @@
+package domain
+
+import "errors"
+
+// Lo devuelven los repos cuando un índice único rechaza el insert (ej: email repetido)
+var ErrDuplicate = errors.New("duplicate key")
+
+// El job ya no es de quien lo corría: el lock venció y lo tomó otro
+var ErrLeaseLost = errors.New("job lease lost")
@@ -2,6 +2,8 @@ package domain
 
 import (
 	"context"
+	"time"
+	"view-list/internal/query"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -10,11 +12,95 @@ import (
 type MangaRepo interface {
 	Create(ctx context.Context, manga *Manga) error
 	GetByID(ctx context.Context, id primitive.ObjectID) (*Manga, error)
-	List(ctx context.Context, userID primitive.ObjectID, state, search string) ([]Manga, error)
+	List(ctx context.Context, userID primitive.ObjectID, state string) ([]Manga, error) // más recientes primero
+	// Como List pero con el filtro de la consulta; la búsqueda libre no la aplica (puede traer de más)
+	Filter(ctx context.Context, userID primitive.ObjectID, f query.Node) ([]Manga, error)
+	// Filter más los conteos por estado y género de esos mismos resultados, en una sola consulta
+	FilterFacets(ctx context.Context, userID primitive.ObjectID, f query.Node) ([]Manga, *Facets, error)
 	Update(ctx context.Context, id primitive.ObjectID, updates bson.M) error
 	Delete(ctx context.Context, id primitive.ObjectID) error
 	DeleteAll(ctx context.Context, id primitive.ObjectID) error
 	BulkInsert(ctx context.Context, mangas []Manga) error // Inserta todos los mangas del bson
+	ListWithImage(ctx context.Context) ([]Manga, error)   // Todos los mangas con imagen (solo _id, user_id e image)
+	GetByIDs(ctx context.Context, userID primitive.ObjectID, ids []primitive.ObjectID) ([]Manga, error)
+	CountByState(ctx context.Context, userID primitive.ObjectID) (map[MangaState]int, error)
+	// Pasa todos los mangas del usuario de un estado a otro; devuelve cuántos cambió
+	ReassignState(ctx context.Context, userID primitive.ObjectID, from, to MangaState) (int64, error)
+}
+
+type SmartListRepo interface {
+	Create(ctx context.Context, list *SmartList) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*SmartList, error)
+	ListByUser(ctx context.Context, userID primitive.ObjectID) ([]SmartList, error) // por nombre
+	CountByUser(ctx context.Context, userID primitive.ObjectID) (int64, error)
+	Update(ctx context.Context, id primitive.ObjectID, updates bson.M) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// Colecciones del usuario y sus mangas (muchos a muchos, en dos colecciones de Mongo)
+type CollectionRepo interface {
+	Create(ctx context.Context, c *Collection) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*Collection, error)
+	ListByUser(ctx context.Context, userID primitive.ObjectID) ([]Collection, error) // por posición, con Count
+	Update(ctx context.Context, id primitive.ObjectID, updates bson.M) error
+	Delete(ctx context.Context, id primitive.ObjectID) error // también saca sus mangas
+	SetPositions(ctx context.Context, positions map[primitive.ObjectID]float64) error
+
+	// Devuelve ErrDuplicate si el manga ya estaba en la colección
+	AddItem(ctx context.Context, item *CollectionItem) error
+	RemoveItem(ctx context.Context, collectionID, mangaID primitive.ObjectID) (bool, error)
+	Items(ctx context.Context, collectionID primitive.ObjectID) ([]CollectionItem, error) // por posición
+	SetItemPositions(ctx context.Context, collectionID primitive.ObjectID, positions map[primitive.ObjectID]float64) error
+	CollectionsOf(ctx context.Context, mangaID primitive.ObjectID) ([]primitive.ObjectID, error)
+	RemoveManga(ctx context.Context, mangaID primitive.ObjectID) error    // al borrar un manga
+	RemoveUserItems(ctx context.Context, userID primitive.ObjectID) error // al borrar todos los mangas
+}
+
+// -------------------- JOBS --------------------
+
+type JobRepo interface {
+	Create(ctx context.Context, job *Job) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*Job, error)
+	// Toma el próximo job listo para correr (o uno running con el lock vencido), lo marca running
+	// y le pone un LeaseOwner nuevo
+	ClaimNext(ctx context.Context, now time.Time, lease time.Duration) (*Job, error)
+	// Complete, Fail y Release solo cambian el job si sigue tomado por owner (el LeaseOwner de ClaimNext);
+	// si el lock venció y lo retomó otro devuelven ErrLeaseLost
+	Complete(ctx context.Context, id primitive.ObjectID, owner string, result map[string]string) error
+	// Vuelve a pending para reintentar en runAt, o lo marca dead si dead es true
+	Fail(ctx context.Context, id primitive.ObjectID, owner, errMsg string, runAt time.Time, dead bool) error
+	// Devuelve un job interrumpido (ej: shutdown) a pending sin gastar el intento
+	Release(ctx context.Context, id primitive.ObjectID, owner string) error
+	List(ctx context.Context, status JobStatus, limit int64) ([]Job, error)
+}
+
+// -------------------- IMAGES --------------------
+
+// Conteo de referencias de las imágenes guardadas por hash: el archivo se borra con la última
+type ImageRefRepo interface {
+	// Suma una referencia y devuelve el estado después del incremento. Si no existía, el registro
+	// se crea pendiente: alguien tiene que escribir el archivo (ClaimWrite/FinishWrite)
+	Acquire(ctx context.Context, key, userID string) (*ImageRef, error)
+	// Resta una referencia; last es true si era la última. Si la key no tenía registro devuelve nil y last false
+	Release(ctx context.Context, key string) (ref *ImageRef, last bool, err error)
+	// Marca que ya tiene variantes (menos skipped) con su tamaño total; devuelve el registro anterior (nil si no había)
+	SetVariants(ctx context.Context, key string, size int64, skipped []string) (*ImageRef, error)
+	// Saca el registro y lo devuelve (nil si no había)
+	Remove(ctx context.Context, key string) (*ImageRef, error)
+	// Devuelve el registro o nil si no hay
+	Get(ctx context.Context, key string) (*ImageRef, error)
+	// Toma la escritura de una key pendiente si nadie la tiene o si el que la tenía la tomó antes de staleBefore
+	ClaimWrite(ctx context.Context, key, token string, staleBefore time.Time) (bool, error)
+	// Marca escrito el archivo de una escritura tomada, con el tamaño total que ocupa, y devuelve el registro
+	FinishWrite(ctx context.Context, key, token string, size int64, hasVariants bool, skipped []string) (*ImageRef, error)
+	// Suelta una escritura (o un borrado) tomado sin terminarlo: la key sigue pendiente
+	AbortWrite(ctx context.Context, key, token string) error
+	// Toma el borrado del archivo de una key: solo si no tiene referencias y nadie la está escribiendo
+	ClaimDelete(ctx context.Context, key, userID, token string, staleBefore time.Time) (bool, error)
+	// Termina un borrado: saca el registro, o lo deja pendiente si alguien tomó la key mientras tanto
+	FinishDelete(ctx context.Context, key, token string) error
+	List(ctx context.Context) ([]ImageRef, error)
+	Upsert(ctx context.Context, ref *ImageRef) error
 }
 
 // -------------------- USERS --------------------
@@ -23,6 +109,13 @@ type UserRepo interface {
 	Create(ctx context.Context, user *User) error
 	GetByEmail(ctx context.Context, email string) (*User, error)
 	GetByID(ctx context.Context, id primitive.ObjectID) (*User, error)
+	// Suma delta (puede ser negativo) a los bytes guardados del usuario. Si limit > 0 y la suma
+	// lo pasaría, no cambia nada y devuelve false.
+	AddStorageUsed(ctx context.Context, id primitive.ObjectID, delta, limit int64) (bool, error)
+	SetStorageUsed(ctx context.Context, id primitive.ObjectID, bytes int64) error
+	ResetStorageUsed(ctx context.Context) error // pone todos en 0 (recálculo)
+	SetStates(ctx context.Context, id primitive.ObjectID, states []ReadingState) error
+	SetScoreScale(ctx context.Context, id primitive.ObjectID, scale ScoreScale) error
 }
 
 type UserService interface {
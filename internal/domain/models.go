@@ -1,11 +1,13 @@
 package domain
 
 import (
+	"math"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// MangaState es la key de uno de los estados del usuario (ver ReadingState)
 type MangaState string
 
 const (
@@ -13,28 +15,391 @@ const (
 	MangaStateCompleted MangaState = "completed"
 	MangaStateOnHold    MangaState = "on hold"
 	MangaStateDropped   MangaState = "dropped"
+	MangaStatePlanned   MangaState = "plan to read"
+	MangaStateRereading MangaState = "rereading"
+	MangaStateWaiting   MangaState = "waiting"
 )
 
+// MediaKind es qué tipo de obra se sigue. Los documentos sin kind (anteriores a los tipos) son mangas.
+type MediaKind string
+
+const (
+	KindManga MediaKind = "manga"
+	KindAnime MediaKind = "anime"
+	KindNovel MediaKind = "novel"
+	KindTV    MediaKind = "tv"
+	KindGame  MediaKind = "game"
+)
+
+func IsValidMediaKind(k MediaKind) bool {
+	switch k {
+	case KindManga, KindAnime, KindNovel, KindTV, KindGame:
+		return true
+	}
+	return false
+}
+
+// ProgressUnit es en qué se cuenta el progreso (Manga.Chapter y Manga.TotalChapters)
+type ProgressUnit string
+
+const (
+	UnitChapter ProgressUnit = "chapter"
+	UnitEpisode ProgressUnit = "episode"
+	UnitHours   ProgressUnit = "hours"
+)
+
+func (k MediaKind) Unit() ProgressUnit {
+	switch k {
+	case KindAnime, KindTV:
+		return UnitEpisode
+	case KindGame:
+		return UnitHours
+	}
+	return UnitChapter
+}
+
+// HasVolumes dice si tiene sentido contar tomos además de la unidad principal
+func (k MediaKind) HasVolumes() bool {
+	return k == KindManga || k == KindNovel
+}
+
+type PublicationStatus string
+
+const (
+	PublicationUnknown   PublicationStatus = ""
+	PublicationOngoing   PublicationStatus = "ongoing"
+	PublicationCompleted PublicationStatus = "completed"
+	PublicationHiatus    PublicationStatus = "hiatus"
+	PublicationCancelled PublicationStatus = "cancelled"
+)
+
+func IsValidPublicationStatus(p PublicationStatus) bool {
+	switch p {
+	case PublicationUnknown, PublicationOngoing, PublicationCompleted, PublicationHiatus, PublicationCancelled:
+		return true
+	}
+	return false
+}
+
+// MediaKind es el tipo, con los documentos viejos sin kind como mangas
+func (m *Manga) MediaKind() MediaKind {
+	if m.Kind == "" {
+		return KindManga
+	}
+	return m.Kind
+}
+
+// Completion es el porcentaje leído (0 a 100, con un decimal); false si no se sabe el total
+func (m *Manga) Completion() (float64, bool) {
+	if m.TotalChapters <= 0 {
+		return 0, false
+	}
+	pct := m.Chapter / m.TotalChapters * 100
+	if pct > 100 {
+		pct = 100
+	}
+	return math.Round(pct*10) / 10, true
+}
+
+// SeriesType es el formato de la serie (no confundir con el estado de lectura)
+type SeriesType string
+
+const (
+	SeriesUnknown    SeriesType = ""
+	SeriesManga      SeriesType = "manga"
+	SeriesManhwa     SeriesType = "manhwa"
+	SeriesManhua     SeriesType = "manhua"
+	SeriesWebtoon    SeriesType = "webtoon"
+	SeriesLightNovel SeriesType = "light novel"
+)
+
+func IsValidSeriesType(t SeriesType) bool {
+	switch t {
+	case SeriesUnknown, SeriesManga, SeriesManhwa, SeriesManhua, SeriesWebtoon, SeriesLightNovel:
+		return true
+	}
+	return false
+}
+
+// Demographic es el público al que apunta la revista o editorial
+type Demographic string
+
+const (
+	DemographicUnknown Demographic = ""
+	DemographicShounen Demographic = "shounen"
+	DemographicShoujo  Demographic = "shoujo"
+	DemographicSeinen  Demographic = "seinen"
+	DemographicJosei   Demographic = "josei"
+	DemographicKodomo  Demographic = "kodomo"
+)
+
+func IsValidDemographic(d Demographic) bool {
+	switch d {
+	case DemographicUnknown, DemographicShounen, DemographicShoujo, DemographicSeinen, DemographicJosei, DemographicKodomo:
+		return true
+	}
+	return false
+}
+
+// AltTitle es otro nombre de la serie: el original, el romanizado o el de otra edición
+type AltTitle struct {
+	Title     string `bson:"title" json:"title"`
+	Language  string `bson:"language,omitempty" json:"language,omitempty"`   // ISO 639-1 (ja, ko, en)
+	Romanized bool   `bson:"romanized,omitempty" json:"romanized,omitempty"` // ej: "Shingeki no Kyojin"
+}
+
+// Source es un sitio de la serie además de Link (donde se lee): editorial, MangaDex, MAL, etc.
+type Source struct {
+	Name string `bson:"name" json:"name"`
+	URL  string `bson:"url" json:"url"`
+}
+
+// ScoreScale es la escala en la que el usuario pone y ve los puntajes. En la db siempre se
+// guardan de 0 a 100 (Manga.Score), así cambiar de escala no toca ningún manga.
+type ScoreScale string
+
+const (
+	ScorePoint10  ScoreScale = "10"  // 0.5 a 10, de a medio punto
+	ScorePoint100 ScoreScale = "100" // 1 a 100
+	ScoreStars5   ScoreScale = "5"   // 0.5 a 5 estrellas, de a media
+)
+
+const DefaultScoreScale = ScorePoint10
+
+func IsValidScoreScale(s ScoreScale) bool {
+	switch s {
+	case ScorePoint10, ScorePoint100, ScoreStars5:
+		return true
+	}
+	return false
+}
+
+// Max es el puntaje más alto y Step el salto mínimo entre puntajes
+func (s ScoreScale) Max() float64 {
+	switch s {
+	case ScorePoint100:
+		return 100
+	case ScoreStars5:
+		return 5
+	}
+	return 10
+}
+
+func (s ScoreScale) Step() float64 {
+	if s == ScorePoint100 {
+		return 1
+	}
+	return 0.5
+}
+
+// Normalize pasa un puntaje de la escala a 0-100; false si no es uno de los valores de la escala
+func (s ScoreScale) Normalize(v float64) (float64, bool) {
+	if v <= 0 || v > s.Max() || math.Mod(v, s.Step()) != 0 {
+		return 0, false
+	}
+	return s.ToNormalized(v), true
+}
+
+// ToNormalized pasa a 0-100 sin validar (ej: los límites de un filtro), con dos decimales
+func (s ScoreScale) ToNormalized(v float64) float64 {
+	return math.Round(v/s.Max()*100*100) / 100
+}
+
+// Display pasa un puntaje guardado (0-100) a la escala, redondeado al paso más cercano
+func (s ScoreScale) Display(normalized float64) float64 {
+	v := normalized / 100 * s.Max()
+	v = math.Round(v/s.Step()) * s.Step()
+	return math.Max(v, s.Step())
+}
+
+// Average pasa un promedio a la escala con un decimal (no se redondea al paso)
+func (s ScoreScale) Average(normalized float64) float64 {
+	return math.Round(normalized/100*s.Max()*10) / 10
+}
+
+// StateCategory agrupa los estados para las estadísticas, sean cuales sean los del usuario
+type StateCategory string
+
+const (
+	CategoryActive   StateCategory = "active"   // lo está leyendo
+	CategoryFinished StateCategory = "finished" // lo terminó
+	CategoryInactive StateCategory = "inactive" // pendiente, pausado o abandonado
+)
+
+func IsValidStateCategory(c StateCategory) bool {
+	switch c {
+	case CategoryActive, CategoryFinished, CategoryInactive:
+		return true
+	}
+	return false
+}
+
+// ReadingState es un estado configurable por el usuario. Key es lo que se guarda en Manga.State
+// y no cambia; el resto se puede editar. El orden es el del slice.
+type ReadingState struct {
+	Key      MangaState    `bson:"key" json:"key"`
+	Label    string        `bson:"label" json:"label"`
+	Color    string        `bson:"color" json:"color"` // #rrggbb
+	Category StateCategory `bson:"category" json:"category"`
+}
+
+// DefaultReadingStates son los que recibe cada usuario nuevo (los cuatro de siempre y algunos más)
+func DefaultReadingStates() []ReadingState {
+	return []ReadingState{
+		{Key: MangaStateReading, Label: "Reading", Color: "#3b82f6", Category: CategoryActive},
+		{Key: MangaStateRereading, Label: "Re-reading", Color: "#8b5cf6", Category: CategoryActive},
+		{Key: MangaStateWaiting, Label: "Waiting for new chapters", Color: "#06b6d4", Category: CategoryActive},
+		{Key: MangaStatePlanned, Label: "Plan to read", Color: "#a3a3a3", Category: CategoryInactive},
+		{Key: MangaStateCompleted, Label: "Completed", Color: "#22c55e", Category: CategoryFinished},
+		{Key: MangaStateOnHold, Label: "On hold", Color: "#f59e0b", Category: CategoryInactive},
+		{Key: MangaStateDropped, Label: "Dropped", Color: "#ef4444", Category: CategoryInactive},
+	}
+}
+
+// Media es el nombre general de lo que se sigue. El tipo se llama Manga (y la colección mangas)
+// porque la app empezó solo con mangas; Kind dice qué es.
+type Media = Manga
+
 type Manga struct {
+	ID    primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	Kind  MediaKind          `bson:"kind,omitempty" json:"kind"`
+	Unit  ProgressUnit       `bson:"-" json:"unit"` // la de Kind, se completa al responder
+	Name  string             `bson:"name,omitempty" json:"name"`
+	State MangaState         `bson:"state" json:"state"`
+	// Por dónde voy, en la unidad del tipo: capítulo (105.5 para extras), episodio u horas
+	Chapter float64 `bson:"chapter" json:"chapter"`
+	Volume  int     `bson:"volume,omitempty" json:"volume"`
+	// Largo de la serie si se conoce (0 = no se sabe) y si sigue saliendo
+	TotalChapters     float64           `bson:"total_chapters,omitempty" json:"total_chapters"`
+	TotalVolumes      int               `bson:"total_volumes,omitempty" json:"total_volumes"`
+	PublicationStatus PublicationStatus `bson:"publication_status,omitempty" json:"publication_status"`
+	Progress          *float64          `bson:"-" json:"progress,omitempty"` // % leído, se calcula al responder
+	// Puntaje de 0 a 100 (0 = sin puntaje). En la API va en la escala del usuario, en ScoreDisplay.
+	Score         float64            `bson:"score,omitempty" json:"-"`
+	ScoreDisplay  *float64           `bson:"-" json:"score,omitempty"`
+	Review        string             `bson:"review,omitempty" json:"review,omitempty"`
+	ReviewSpoiler bool               `bson:"review_spoiler,omitempty" json:"review_spoiler,omitempty"` // la reseña cuenta partes de la historia
+	Image         string             `bson:"image" json:"image"`
+	Variants      map[string]string  `bson:"variants,omitempty" json:"variants,omitempty"` // thumb, card, full (WebP reducidas)
+	Link          string             `bson:"link" json:"link"`                             // link donde lo miro
+	Description   string             `bson:"description" json:"description"`
+	Genre         []string           `bson:"genre" json:"genre"`
+	UserID        primitive.ObjectID `bson:"user_id,omitempty" json:"user_id"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+
+	// Datos de la serie (todos opcionales)
+	AltTitles        []AltTitle  `bson:"alt_titles,omitempty" json:"alt_titles,omitempty"`
+	Authors          []string    `bson:"authors,omitempty" json:"authors,omitempty"` // guion
+	Artists          []string    `bson:"artists,omitempty" json:"artists,omitempty"` // dibujo
+	Type             SeriesType  `bson:"type,omitempty" json:"type,omitempty"`
+	Demographic      Demographic `bson:"demographic,omitempty" json:"demographic,omitempty"`
+	OriginalLanguage string      `bson:"original_language,omitempty" json:"original_language,omitempty"` // ISO 639-1
+	StartYear        int         `bson:"start_year,omitempty" json:"start_year,omitempty"`
+	EndYear          int         `bson:"end_year,omitempty" json:"end_year,omitempty"`
+	Sources          []Source    `bson:"sources,omitempty" json:"sources,omitempty"`
+}
+
+// Facets son los conteos por tipo, estado y género de un listado filtrado (para tabs y chips)
+type Facets struct {
+	Kinds      map[MediaKind]int     `bson:"-" json:"kinds"`
+	States     map[MangaState]int    `bson:"-" json:"states"`
+	Categories map[StateCategory]int `bson:"-" json:"categories"` // según la categoría de cada estado
+	Genres     []GenreCount          `bson:"-" json:"genres"`     // de más a menos usados
+	AvgScore   *float64              `bson:"-" json:"avg_score,omitempty"`
+	Scored     int                   `bson:"-" json:"scored"` // cuántos tienen puntaje
+}
+
+func NewFacets() *Facets {
+	return &Facets{Kinds: map[MediaKind]int{}, States: map[MangaState]int{}, Categories: map[StateCategory]int{}, Genres: []GenreCount{}}
+}
+
+// FillStates completa con 0 los estados del usuario que no aparecen (así los tabs vacíos también
+// se muestran) y suma los conteos por categoría
+func (f *Facets) FillStates(states []ReadingState) {
+	category := make(map[MangaState]StateCategory, len(states))
+	for _, s := range states {
+		category[s.Key] = s.Category
+		if _, ok := f.States[s.Key]; !ok {
+			f.States[s.Key] = 0
+		}
+	}
+	f.Categories = map[StateCategory]int{CategoryActive: 0, CategoryFinished: 0, CategoryInactive: 0}
+	for key, n := range f.States {
+		if c, ok := category[key]; ok {
+			f.Categories[c] += n
+		}
+	}
+}
+
+type GenreCount struct {
+	Genre    string   `bson:"_id" json:"genre"`
+	Count    int      `bson:"count" json:"count"`
+	AvgScore *float64 `bson:"avg_score" json:"avg_score,omitempty"` // de los que tienen puntaje; nil si ninguno
+}
+
+// SmartList es una búsqueda guardada: se evalúa cada vez que se abre, así siempre está al día
+type SmartList struct {
+	ID        primitive.ObjectID   `bson:"_id,omitempty" json:"_id"`
+	UserID    primitive.ObjectID   `bson:"user_id" json:"user_id"`
+	Name      string               `bson:"name" json:"name"`
+	Query     string               `bson:"query" json:"query"`   // lenguaje de filtros (internal/query)
+	Sort      string               `bson:"sort" json:"sort"`     // ej: "-updated", "name"; vacío = por defecto
+	Pinned    []primitive.ObjectID `bson:"pinned" json:"pinned"` // mangas que van primero, en este orden
+	CreatedAt time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time            `bson:"updated_at" json:"updated_at"`
+}
+
+// Collection es un estante armado por el usuario ("Favoritos", "Tomos físicos"...).
+// Un manga puede estar en varias; el orden se guarda como posición (ver CollectionItem).
+type Collection struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
-	Name        string             `bson:"name,omitempty" json:"name"`
-	State       MangaState         `bson:"state" json:"state"`
-	Chapter     uint16             `bson:"chapter,min=0" json:"chapter"` // cap en el que lo dejé
-	Image       string             `bson:"image" json:"image"`
-	Link        string             `bson:"link" json:"link"` // link donde lo miro
+	UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Name        string             `bson:"name" json:"name"`
 	Description string             `bson:"description" json:"description"`
-	Genre       []string           `bson:"genre" json:"genre"`
-	UserID      primitive.ObjectID `bson:"user_id,omitempty" json:"user_id"`
+	Position    float64            `bson:"position" json:"position"` // orden entre las colecciones del usuario
+	Count       int                `bson:"-" json:"count"`           // mangas que tiene (se calcula al listar)
 	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
 }
 
+// CollectionItem es la pertenencia de un manga a una colección. Position es fraccionaria:
+// al arrastrar un manga entre otros dos toma el punto medio, así no se reescribe toda la lista.
+type CollectionItem struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	CollectionID primitive.ObjectID `bson:"collection_id" json:"collection_id"`
+	MangaID      primitive.ObjectID `bson:"manga_id" json:"manga_id"`
+	UserID       primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Position     float64            `bson:"position" json:"position"`
+	AddedAt      time.Time          `bson:"added_at" json:"added_at"`
+}
+
+// ImageRef lleva la cuenta de cuántos mangas usan un archivo guardado por contenido
+type ImageRef struct {
+	Key         string `bson:"_id" json:"key"` // user_<id>/<sha256>.<ext>
+	UserID      string `bson:"user_id" json:"user_id"`
+	Size        int64  `bson:"size" json:"size"`
+	Refs        int    `bson:"refs" json:"refs"`
+	HasVariants bool   `bson:"has_variants" json:"has_variants"`
+	// Variantes que no se guardaron porque no achicaban el original: en su lugar se usa el original
+	SkippedVariants []string `bson:"skipped_variants,omitempty" json:"skipped_variants,omitempty"`
+	// El archivo todavía no está escrito (o se está borrando): quien tiene Writer lo está haciendo
+	Pending   bool      `bson:"pending,omitempty" json:"pending,omitempty"`
+	Writer    string    `bson:"writer,omitempty" json:"-"`
+	WritingAt time.Time `bson:"writing_at,omitempty" json:"-"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
 type User struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
 	Username    string             `bson:"username,omitempty" json:"username"`
 	Email       string             `bson:"email,omitempty" json:"email"`
 	Password    string             `bson:"password,omitempty" json:"-"`
 	DateOfBirth time.Time          `bson:"date_of_birth,omitempty" json:"date_of_birth"`
+	StorageUsed int64              `bson:"storage_used" json:"storage_used"`         // bytes de imágenes (originales + variantes)
+	States      []ReadingState     `bson:"states,omitempty" json:"-"`                // vacío = los por defecto (ver GET /api/states)
+	ScoreScale  ScoreScale         `bson:"score_scale,omitempty" json:"score_scale"` // vacío = DefaultScoreScale
 }
 
 type UserBakup struct {
@@ -42,13 +407,31 @@ type UserBakup struct {
 	Mangas []Manga `bson:"mangas" json:"mangas"`
 }
 
-func IsValidMangaState(s MangaState) bool {
-	switch s {
-	case MangaStateReading,
-		MangaStateCompleted,
-		MangaStateDropped,
-		MangaStateOnHold:
-		return true
-	}
-	return false
+// -------------------- JOBS --------------------
+
+type JobStatus string
+
+const (
+	JobStatusPending JobStatus = "pending"
+	JobStatusRunning JobStatus = "running"
+	JobStatusDone    JobStatus = "done"
+	JobStatusDead    JobStatus = "dead" // agotó los reintentos
+)
+
+// Job es una tarea persistida en Mongo, así sobrevive a un reinicio del server
+type Job struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	Type        string             `bson:"type" json:"type"`
+	Payload     map[string]string  `bson:"payload" json:"payload"`
+	Result      map[string]string  `bson:"result,omitempty" json:"result,omitempty"`
+	Status      JobStatus          `bson:"status" json:"status"`
+	Attempts    int                `bson:"attempts" json:"attempts"`
+	MaxAttempts int                `bson:"max_attempts" json:"max_attempts"`
+	LastError   string             `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	UserID      primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	RunAt       time.Time          `bson:"run_at" json:"run_at"`             // no corre antes de esta fecha (backoff)
+	LockedUntil time.Time          `bson:"locked_until" json:"locked_until"` // si vence estando running, se retoma
+	LeaseOwner  string             `bson:"lease_owner,omitempty" json:"-"`   // quién lo tomó: solo ese lo puede cerrar
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
 }
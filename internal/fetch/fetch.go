@@ -0,0 +1,174 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+	"view-list/internal/imaging"
+)
+
+var (
+	ErrFetch       = errors.New("Could not fetch remote image")
+	ErrInvalidURL  = fmt.Errorf("%w: only http and https URLs are allowed", ErrFetch)
+	ErrBlockedHost = fmt.Errorf("%w: the address is not allowed", ErrFetch)
+	ErrBadStatus   = fmt.Errorf("%w: the server did not return the image", ErrFetch)
+	ErrRedirects   = fmt.Errorf("%w: too many redirects", ErrFetch)
+)
+
+const maxRedirects = 3 // redirects que se siguen, sin contar el pedido original
+
+// Options de la descarga. AllowPrivate deja pasar loopback y redes internas (solo para desarrollo o tests).
+type Options struct {
+	Timeout      time.Duration
+	MaxBytes     int64
+	AllowPrivate bool
+}
+
+// Fetcher baja imágenes de URLs que pega el usuario. Como el request sale del server,
+// se bloquea cualquier IP interna (SSRF) chequeando la IP ya resuelta al conectar,
+// así no se puede esquivar con DNS que cambia ni con redirects.
+type Fetcher struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+func NewFetcher(opts Options) *Fetcher {
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	if !opts.AllowPrivate {
+		dialer.Control = blockPrivate
+	}
+
+	transport := &http.Transport{
+		Proxy:                 nil, // un proxy resolvería por nosotros y saltearía el chequeo
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   opts.Timeout,
+		ResponseHeaderTimeout: opts.Timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   opts.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			// via trae los pedidos anteriores: el primero más un redirect por cada uno ya seguido
+			if len(via) > maxRedirects {
+				return ErrRedirects
+			}
+			return checkScheme(req.URL)
+		},
+	}
+	return &Fetcher{client: client, maxBytes: opts.MaxBytes}
+}
+
+// Fetch descarga la URL y devuelve los bytes. El contenido real se valida después con imaging.Sanitize.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+	if err := checkScheme(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+	req.Header.Set("Accept", "image/jpeg, image/png, image/webp, image/gif")
+	req.Header.Set("User-Agent", "view-list/1.0 (cover fetcher)")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		// Los errores del dial y de los redirects vienen envueltos en url.Error / net.OpError
+		for _, known := range []error{ErrBlockedHost, ErrInvalidURL, ErrRedirects} {
+			if errors.Is(err, known) {
+				return nil, known
+			}
+		}
+		return nil, fmt.Errorf("%w: %v", ErrFetch, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w (status %d)", ErrBadStatus, resp.StatusCode)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "image/") {
+		return nil, imaging.ErrUnsupportedFormat
+	}
+	if resp.ContentLength > f.maxBytes {
+		return nil, imaging.ErrTooLarge
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFetch, err)
+	}
+	if int64(len(data)) > f.maxBytes {
+		return nil, imaging.ErrTooLarge
+	}
+	return data, nil
+}
+
+func checkScheme(u *url.URL) error {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+// Se llama con la IP ya resuelta, justo antes de conectar
+func blockPrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return ErrBlockedHost
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublic(ip) {
+		return ErrBlockedHost
+	}
+	return nil
+}
+
+// CGNAT (100.64.0.0/10) y "this network" (0.0.0.0/8) no entran en los helpers de net
+var extraBlocked = []*net.IPNet{
+	mustCIDR("100.64.0.0/10"),
+	mustCIDR("0.0.0.0/8"),
+	mustCIDR("192.0.0.0/24"),
+	mustCIDR("198.18.0.0/15"),
+	mustCIDR("64:ff9b::/96"), // NAT64 puede apuntar a IPv4 internas
+}
+
+func isPublic(ip net.IP) bool {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4 // IPv4 mapeada en IPv6 (::ffff:127.0.0.1)
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range extraBlocked {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func mustCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
@@ -0,0 +1,166 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// -------------------- EXIF Orientation --------------------
+
+// Las cámaras guardan la foto como sale del sensor y anotan en el EXIF cómo hay que girarla.
+// Como al limpiar se tira el EXIF, antes hay que aplicar el giro a los píxeles.
+
+// orientation devuelve el valor del tag Orientation (1 a 8) o 1 si no hay o no se entiende
+func orientation(format string, data []byte) int {
+	var tiff []byte
+	switch format {
+	case FormatJPEG:
+		tiff = jpegExif(data)
+	case FormatPNG:
+		tiff = pngChunk(data, "eXIf")
+	case FormatWebP:
+		tiff = webpChunk(data, "EXIF")
+	}
+	// Algunos programas dejan el prefijo de JPEG también en PNG y WebP
+	tiff = bytes.TrimPrefix(tiff, []byte("Exif\x00\x00"))
+
+	if o := exifOrientation(tiff); o >= 1 && o <= 8 {
+		return o
+	}
+	return 1
+}
+
+// Del 5 al 8 la imagen está acostada: ancho y alto se cambian
+func swapsAxes(o int) bool {
+	return o >= 5
+}
+
+// Busca el segmento APP1 con EXIF antes de los datos comprimidos
+func jpegExif(data []byte) []byte {
+	i := 2
+	for i+4 <= len(data) && data[i] == 0xFF {
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil
+		}
+		if seg := data[i+4 : end]; marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return seg
+		}
+		i = end
+	}
+	return nil
+}
+
+func pngChunk(data []byte, want string) []byte {
+	for i := 8; i+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i : i+4]))
+		typ := string(data[i+4 : i+8])
+		end := i + 8 + length
+		if length < 0 || end > len(data) || typ == "IDAT" || typ == "IEND" {
+			return nil
+		}
+		if typ == want {
+			return data[i+8 : end]
+		}
+		i = end + 4 // CRC
+	}
+	return nil
+}
+
+func webpChunk(data []byte, want string) []byte {
+	for i := 12; i+8 <= len(data); {
+		id := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4 : i+8]))
+		end := i + 8 + size
+		if size < 0 || end > len(data) {
+			return nil
+		}
+		if id == want {
+			return data[i+8 : end]
+		}
+		i = end + size%2
+	}
+	return nil
+}
+
+// Lee el tag 0x0112 del primer IFD de un bloque TIFF (II o MM)
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd : ifd+2]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8 : entry+10])) // SHORT, va en el campo del valor
+		}
+	}
+	return 0
+}
+
+// orient devuelve la imagen como se tiene que ver según el tag Orientation
+func orient(src image.Image, o int) image.Image {
+	if o <= 1 || o > 8 {
+		return src
+	}
+
+	b := src.Bounds()
+	in := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(in, in.Bounds(), src, b.Min, draw.Src)
+
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if swapsAxes(o) {
+		dw, dh = h, w
+	}
+	out := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// De qué píxel del original sale (x, y) del resultado
+			sx, sy := x, y
+			switch o {
+			case 2: // espejo horizontal
+				sx = w - 1 - x
+			case 3: // 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // espejo vertical
+				sy = h - 1 - y
+			case 5: // transpuesta
+				sx, sy = y, x
+			case 6: // 90° horario
+				sx, sy = y, h-1-x
+			case 7: // transversa
+				sx, sy = w-1-y, h-1-x
+			case 8: // 90° antihorario
+				sx, sy = w-1-y, x
+			}
+			copy(out.Pix[out.PixOffset(x, y):out.PixOffset(x, y)+4], in.Pix[in.PixOffset(sx, sy):in.PixOffset(sx, sy)+4])
+		}
+	}
+	return out
+}
@@ -0,0 +1,371 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/webp"
+)
+
+var (
+	ErrInvalidImage      = errors.New("Invalid image")
+	ErrTooLarge          = fmt.Errorf("%w: file is too large", ErrInvalidImage)
+	ErrUnsupportedFormat = fmt.Errorf("%w: unsupported format, use JPEG, PNG, WebP or GIF", ErrInvalidImage)
+	ErrDimensions        = fmt.Errorf("%w: dimensions are too large", ErrInvalidImage)
+	ErrCorrupt           = fmt.Errorf("%w: file is corrupt or truncated", ErrInvalidImage)
+	ErrPolyglot          = fmt.Errorf("%w: file contains extra data after the image", ErrInvalidImage)
+	ErrTooManyFrames     = fmt.Errorf("%w: animation has too many frames", ErrInvalidImage)
+)
+
+// Tope de un GIF animado antes de decodificarlo: DecodeAll reserva ancho×alto por cada frame
+const (
+	MaxGIFFrames = 300
+	MaxGIFPixels = 64 << 20 // ancho × alto × frames
+)
+
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatGIF  = "gif"
+	FormatWebP = "webp"
+)
+
+type Limits struct {
+	MaxBytes  int64
+	MaxWidth  int
+	MaxHeight int
+}
+
+// Image es el resultado ya validado y limpio, listo para guardar.
+type Image struct {
+	Data        []byte
+	Format      string
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+}
+
+// Read lee como máximo MaxBytes del reader y sanitiza el contenido.
+func Read(r io.Reader, limits Limits) (*Image, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limits.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	return Sanitize(data, limits)
+}
+
+// Sanitize detecta el formato por los bytes (no por la extensión ni el mime declarado),
+// valida tamaño y dimensiones, rechaza archivos con datos extra (polyglots) y
+// devuelve la imagen sin metadatos (EXIF, GPS, XMP, comentarios). La orientación del EXIF
+// se aplica a los píxeles antes de tirarlo, así la foto no queda acostada.
+func Sanitize(data []byte, limits Limits) (*Image, error) {
+	if int64(len(data)) > limits.MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	format := sniff(data)
+	if format == "" {
+		return nil, ErrUnsupportedFormat
+	}
+
+	// Primero solo el header: no decodifico una bomba de 50000x50000
+	cfg, err := decodeConfig(format, data)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	o := orientation(format, data)
+	if swapsAxes(o) {
+		cfg.Width, cfg.Height = cfg.Height, cfg.Width
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > limits.MaxWidth || cfg.Height > limits.MaxHeight {
+		return nil, fmt.Errorf("%w (%dx%d, max %dx%d)", ErrDimensions, cfg.Width, cfg.Height, limits.MaxWidth, limits.MaxHeight)
+	}
+	if format == FormatGIF {
+		if err := checkGIFFrames(data, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if hasTrailingData(format, data) {
+		return nil, ErrPolyglot
+	}
+
+	clean, err := reencode(format, data, o)
+	if err != nil {
+		return nil, err
+	}
+
+	img := &Image{Data: clean, Format: format, Width: cfg.Width, Height: cfg.Height}
+	img.ContentType, img.Ext = formatInfo(format)
+	return img, nil
+}
+
+func formatInfo(format string) (contentType, ext string) {
+	switch format {
+	case FormatJPEG:
+		return "image/jpeg", ".jpg"
+	case FormatPNG:
+		return "image/png", ".png"
+	case FormatGIF:
+		return "image/gif", ".gif"
+	default:
+		return "image/webp", ".webp"
+	}
+}
+
+func sniff(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return FormatJPEG
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return FormatGIF
+	case len(data) >= 12 && bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return FormatWebP
+	}
+	return ""
+}
+
+func decodeConfig(format string, data []byte) (image.Config, error) {
+	r := bytes.NewReader(data)
+	switch format {
+	case FormatJPEG:
+		return jpeg.DecodeConfig(r)
+	case FormatPNG:
+		return png.DecodeConfig(r)
+	case FormatGIF:
+		return gif.DecodeConfig(r)
+	default:
+		return webp.DecodeConfig(r)
+	}
+}
+
+// Decodifica todo (valida que la imagen esté completa) y la vuelve a codificar:
+// lo que sale son solo píxeles, sin ningún chunk ni segmento del original.
+func reencode(format string, data []byte, o int) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch format {
+	case FormatJPEG:
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrCorrupt
+		}
+		if err := jpeg.Encode(&buf, orient(img, o), &jpeg.Options{Quality: 90}); err != nil {
+			return nil, err
+		}
+
+	case FormatPNG:
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrCorrupt
+		}
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := enc.Encode(&buf, orient(img, o)); err != nil {
+			return nil, err
+		}
+
+	case FormatGIF:
+		// EncodeAll mantiene la animación y descarta comentarios y extensiones de aplicación
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrCorrupt
+		}
+		if err := gif.EncodeAll(&buf, g); err != nil {
+			return nil, err
+		}
+
+	case FormatWebP:
+		// Sin giro no hace falta recodificar: valido decodificando y limpio los chunks del contenedor.
+		// Con giro se recodifica (lossless, es el encoder que hay en Go puro).
+		img, err := webp.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrCorrupt
+		}
+		if o == 1 {
+			return stripWebPMetadata(data)
+		}
+		if err := nativewebp.Encode(&buf, orient(img, o), nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// -------------------- GIF --------------------
+
+// checkGIFFrames cuenta los frames recorriendo los bloques, sin decodificar nada, y rechaza
+// los GIF que a DecodeAll le harían reservar más de MaxGIFPixels
+func checkGIFFrames(data []byte, cfg image.Config) error {
+	frames, err := gifFrames(data)
+	if err != nil {
+		return ErrCorrupt
+	}
+	if frames > MaxGIFFrames || int64(cfg.Width)*int64(cfg.Height)*int64(frames) > MaxGIFPixels {
+		return fmt.Errorf("%w (%d frames of %dx%d)", ErrTooManyFrames, frames, cfg.Width, cfg.Height)
+	}
+	return nil
+}
+
+func gifFrames(data []byte) (int, error) {
+	if len(data) < 13 {
+		return 0, ErrCorrupt
+	}
+	i := 13 // header + logical screen descriptor
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << (flags&0x07 + 1) // tabla de colores global
+	}
+
+	frames := 0
+	for i < len(data) {
+		switch data[i] {
+		case 0x21: // extensión: label y sub-bloques
+			i += 2
+		case 0x2C: // imagen: descriptor, tabla local, tamaño mínimo de código LZW y sub-bloques
+			if i+10 > len(data) {
+				return 0, ErrCorrupt
+			}
+			frames++
+			if flags := data[i+9]; flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1)
+			}
+			i += 11
+		case 0x3B: // trailer
+			return frames, nil
+		default:
+			return 0, ErrCorrupt
+		}
+		// Sub-bloques: largo + datos, hasta uno de largo 0
+		for {
+			if i >= len(data) {
+				return 0, ErrCorrupt
+			}
+			n := int(data[i])
+			i += 1 + n
+			if n == 0 {
+				break
+			}
+		}
+	}
+	return 0, ErrCorrupt
+}
+
+// -------------------- polyglots --------------------
+
+// Un polyglot es un archivo válido como imagen que además lleva otro contenido
+// (HTML, zip, script) pegado al final. Se detecta buscando el fin real de la imagen.
+func hasTrailingData(format string, data []byte) bool {
+	end := -1
+	switch format {
+	case FormatJPEG:
+		end = jpegEnd(data)
+	case FormatPNG:
+		end = pngEnd(data)
+	case FormatGIF:
+		if n := len(bytes.TrimRight(data, "\x00")); n > 0 && data[n-1] == 0x3B {
+			end = n
+		}
+	case FormatWebP:
+		end = 8 + int(binary.LittleEndian.Uint32(data[4:8]))
+	}
+	if end < 0 || end > len(data) {
+		return true
+	}
+
+	// Tolero relleno con ceros que agregan algunos programas
+	return len(bytes.TrimRight(data[end:], "\x00")) > 0
+}
+
+// Recorre los segmentos del JPEG hasta el EOI (FFD9) real, saltando los datos comprimidos
+func jpegEnd(data []byte) int {
+	i := 2
+	for i+2 <= len(data) {
+		if data[i] != 0xFF {
+			return -1
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xD9: // EOI
+			return i + 2
+		case marker == 0xFF: // relleno
+			i++
+			continue
+		case marker >= 0xD0 && marker <= 0xD7, marker == 0x01:
+			i += 2
+			continue
+		}
+
+		if i+4 > len(data) {
+			return -1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		i += 2 + length
+		if marker != 0xDA { // SOS: después vienen los datos comprimidos
+			continue
+		}
+		for i+1 < len(data) {
+			if data[i] == 0xFF && data[i+1] != 0x00 && (data[i+1] < 0xD0 || data[i+1] > 0xD7) {
+				break
+			}
+			i++
+		}
+	}
+	return -1
+}
+
+// Recorre los chunks del PNG hasta IEND (largo + tipo + datos + CRC)
+func pngEnd(data []byte) int {
+	i := 8
+	for i+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[i : i+4]))
+		typ := string(data[i+4 : i+8])
+		i += 12 + length
+		if typ == "IEND" {
+			return i
+		}
+	}
+	return -1
+}
+
+// -------------------- WebP --------------------
+
+// Chunks que hacen falta para mostrar la imagen; el resto (EXIF, XMP, desconocidos) se descarta
+var webpKeep = map[string]bool{"VP8 ": true, "VP8L": true, "VP8X": true, "ALPH": true, "ANIM": true, "ANMF": true, "ICCP": true}
+
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	out.Write([]byte("RIFF\x00\x00\x00\x00WEBP"))
+
+	for i := 12; i+8 <= len(data); {
+		id := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4 : i+8]))
+		end := i + 8 + size + size%2 // los chunks se alinean a 2 bytes
+		if end > len(data) {
+			return nil, ErrCorrupt
+		}
+
+		if webpKeep[id] {
+			chunk := append([]byte(nil), data[i:end]...)
+			if id == "VP8X" && size >= 1 {
+				chunk[8] &^= 0x04 | 0x08 // flags de EXIF y XMP
+			}
+			out.Write(chunk)
+		}
+		i = end
+	}
+
+	clean := out.Bytes()
+	binary.LittleEndian.PutUint32(clean[4:8], uint32(len(clean)-8))
+	return clean, nil
+}
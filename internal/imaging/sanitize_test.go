@@ -0,0 +1,369 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/webp"
+)
+
+var testLimits = Limits{MaxBytes: 1 << 20, MaxWidth: 200, MaxHeight: 200}
+
+// Mitad izquierda roja y mitad derecha azul: alcanza para ver si se giró
+func halves(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.NRGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeWebP(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := nativewebp.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeGIF(t *testing.T, w, h, frames int) []byte {
+	t.Helper()
+	g := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, w, h), color.Palette{color.Black, color.White})
+		frame.SetColorIndex(i%w, 0, 1)
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Bloque TIFF mínimo con el tag Orientation (y un texto para ver que no sobrevive)
+func exifTIFF(orientation uint16) []byte {
+	b := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	b = binary.BigEndian.AppendUint16(b, 1)      // una entrada
+	b = binary.BigEndian.AppendUint16(b, 0x0112) // Orientation
+	b = binary.BigEndian.AppendUint16(b, 3)      // SHORT
+	b = binary.BigEndian.AppendUint32(b, 1)
+	b = binary.BigEndian.AppendUint16(b, orientation)
+	b = append(b, 0, 0, 0, 0, 0, 0)
+	return append(b, "GPS -34.6037,-58.3816"...)
+}
+
+// Mete un APP1 con EXIF después del SOI
+func withJPEGExif(data []byte, orientation uint16) []byte {
+	seg := append([]byte("Exif\x00\x00"), exifTIFF(orientation)...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(seg)+2))
+	out := append([]byte{}, data[:2]...)
+	out = append(out, app1...)
+	out = append(out, seg...)
+	return append(out, data[2:]...)
+}
+
+// Mete un chunk antes del primer IDAT
+func withPNGChunk(data []byte, typ string, payload []byte) []byte {
+	i := bytes.Index(data, []byte("IDAT")) - 4
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	chunk = append(chunk, typ...)
+	chunk = append(chunk, payload...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	out := append([]byte{}, data[:i]...)
+	out = append(out, chunk...)
+	return append(out, data[i:]...)
+}
+
+// Agrega un chunk al final del contenedor RIFF y corrige su tamaño
+func withWebPChunk(data []byte, id string, payload []byte) []byte {
+	out := append([]byte{}, data...)
+	out = append(out, id...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(payload)))
+	out = append(out, payload...)
+	if len(payload)%2 == 1 {
+		out = append(out, 0)
+	}
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out
+}
+
+func TestSanitizeFormats(t *testing.T) {
+	src := halves(20, 10)
+	tests := []struct {
+		name        string
+		data        []byte
+		format      string
+		contentType string
+		ext         string
+	}{
+		{"jpeg", encodeJPEG(t, src), FormatJPEG, "image/jpeg", ".jpg"},
+		{"png", encodePNG(t, src), FormatPNG, "image/png", ".png"},
+		{"gif", encodeGIF(t, 20, 10, 2), FormatGIF, "image/gif", ".gif"},
+		{"webp", encodeWebP(t, src), FormatWebP, "image/webp", ".webp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := Sanitize(tt.data, testLimits)
+			if err != nil {
+				t.Fatalf("Sanitize: %v", err)
+			}
+			if img.Format != tt.format || img.ContentType != tt.contentType || img.Ext != tt.ext {
+				t.Errorf("got %s %s %s", img.Format, img.ContentType, img.Ext)
+			}
+			if img.Width != 20 || img.Height != 10 {
+				t.Errorf("dimensions %dx%d, want 20x10", img.Width, img.Height)
+			}
+			// Lo que sale se vuelve a aceptar igual (el hash de la dedup depende de eso)
+			again, err := Sanitize(img.Data, testLimits)
+			if err != nil || !bytes.Equal(again.Data, img.Data) {
+				t.Errorf("sanitizing the output again: %v, same bytes: %v", err, err == nil && bytes.Equal(again.Data, img.Data))
+			}
+		})
+	}
+}
+
+func TestSanitizeRejects(t *testing.T) {
+	png := encodePNG(t, halves(20, 10))
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrUnsupportedFormat},
+		{"text", []byte("<html><script>alert(1)</script></html>"), ErrUnsupportedFormat},
+		{"bmp", append([]byte("BM"), make([]byte, 64)...), ErrUnsupportedFormat},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), ErrUnsupportedFormat},
+		{"too large", append(png, make([]byte, testLimits.MaxBytes)...), ErrTooLarge},
+		{"too wide", encodePNG(t, halves(201, 10)), ErrDimensions},
+		{"too tall", encodeJPEG(t, halves(10, 201)), ErrDimensions},
+		{"bad header", append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 32)...), ErrCorrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Sanitize(tt.data, testLimits); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if _, err := Sanitize(tt.data, testLimits); !errors.Is(err, ErrInvalidImage) {
+				t.Fatalf("%v does not wrap ErrInvalidImage", err)
+			}
+		})
+	}
+}
+
+func TestSanitizeTruncated(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"jpeg": encodeJPEG(t, halves(20, 10)),
+		"png":  encodePNG(t, halves(20, 10)),
+		"gif":  encodeGIF(t, 20, 10, 2),
+	} {
+		if _, err := Sanitize(data[:len(data)-10], testLimits); !errors.Is(err, ErrInvalidImage) {
+			t.Errorf("%s cut short: got %v, want an invalid image", name, err)
+		}
+	}
+}
+
+func TestSanitizePolyglots(t *testing.T) {
+	src := halves(20, 10)
+	payloads := map[string][]byte{
+		"html": []byte("<html><script>alert(document.cookie)</script></html>"),
+		"zip":  append([]byte("PK\x03\x04"), make([]byte, 30)...),
+	}
+	images := map[string][]byte{
+		"jpeg": encodeJPEG(t, src),
+		"png":  encodePNG(t, src),
+		"gif":  encodeGIF(t, 20, 10, 1),
+		"webp": encodeWebP(t, src),
+	}
+	for format, data := range images {
+		for kind, payload := range payloads {
+			polyglot := append(append([]byte{}, data...), payload...)
+			if _, err := Sanitize(polyglot, testLimits); !errors.Is(err, ErrPolyglot) {
+				t.Errorf("%s + %s: got %v, want ErrPolyglot", format, kind, err)
+			}
+		}
+		// Relleno con ceros al final: lo agregan algunos programas, se tolera
+		padded := append(append([]byte{}, data...), make([]byte, 16)...)
+		if _, err := Sanitize(padded, testLimits); err != nil {
+			t.Errorf("%s with zero padding: %v", format, err)
+		}
+	}
+}
+
+func TestSanitizeStripsMetadata(t *testing.T) {
+	secret := []byte("GPS -34.6037,-58.3816")
+	src := halves(20, 10)
+	tests := map[string][]byte{
+		"jpeg exif": withJPEGExif(encodeJPEG(t, src), 1),
+		"png text":  withPNGChunk(encodePNG(t, src), "tEXt", append([]byte("Comment\x00"), secret...)),
+		"png exif":  withPNGChunk(encodePNG(t, src), "eXIf", exifTIFF(1)),
+		"webp exif": withWebPChunk(encodeWebP(t, src), "EXIF", exifTIFF(1)),
+		"webp xmp":  withWebPChunk(encodeWebP(t, src), "XMP ", secret),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if !bytes.Contains(data, secret) {
+				t.Fatal("the test image does not carry the metadata")
+			}
+			img, err := Sanitize(data, testLimits)
+			if err != nil {
+				t.Fatalf("Sanitize: %v", err)
+			}
+			if bytes.Contains(img.Data, secret) {
+				t.Fatal("metadata survived")
+			}
+		})
+	}
+}
+
+func TestSanitizeAppliesOrientation(t *testing.T) {
+	src := halves(40, 20) // rojo a la izquierda, azul a la derecha
+	red := func(c color.Color) bool {
+		r, _, b, _ := c.RGBA()
+		return r > 0xc000 && b < 0x4000
+	}
+
+	tests := []struct {
+		name        string
+		data        []byte
+		w, h        int
+		redAt       image.Point // un punto que tiene que quedar rojo
+		blueAt      image.Point
+		decode      func([]byte) (image.Image, error)
+		orientation int
+	}{
+		// 6: girar 90° horario, lo que estaba a la izquierda queda arriba
+		{name: "jpeg 6", data: withJPEGExif(encodeJPEG(t, src), 6), w: 20, h: 40, redAt: image.Pt(10, 5), blueAt: image.Pt(10, 35)},
+		// 8: girar 90° antihorario, lo de la izquierda queda abajo
+		{name: "png 8", data: withPNGChunk(encodePNG(t, src), "eXIf", exifTIFF(8)), w: 20, h: 40, redAt: image.Pt(10, 35), blueAt: image.Pt(10, 5)},
+		// 3: 180°, se invierte izquierda y derecha
+		{name: "jpeg 3", data: withJPEGExif(encodeJPEG(t, src), 3), w: 40, h: 20, redAt: image.Pt(35, 10), blueAt: image.Pt(5, 10)},
+		// 2: espejo horizontal
+		{name: "webp 2", data: withWebPChunk(encodeWebP(t, src), "EXIF", exifTIFF(2)), w: 40, h: 20, redAt: image.Pt(35, 10), blueAt: image.Pt(5, 10)},
+		{name: "jpeg 1", data: withJPEGExif(encodeJPEG(t, src), 1), w: 40, h: 20, redAt: image.Pt(5, 10), blueAt: image.Pt(35, 10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := Sanitize(tt.data, testLimits)
+			if err != nil {
+				t.Fatalf("Sanitize: %v", err)
+			}
+			if img.Width != tt.w || img.Height != tt.h {
+				t.Fatalf("reported %dx%d, want %dx%d", img.Width, img.Height, tt.w, tt.h)
+			}
+
+			var out image.Image
+			switch img.Format {
+			case FormatJPEG:
+				out, err = jpeg.Decode(bytes.NewReader(img.Data))
+			case FormatPNG:
+				out, err = png.Decode(bytes.NewReader(img.Data))
+			case FormatWebP:
+				out, err = webp.Decode(bytes.NewReader(img.Data))
+			}
+			if err != nil {
+				t.Fatalf("decoding the output: %v", err)
+			}
+			if b := out.Bounds(); b.Dx() != tt.w || b.Dy() != tt.h {
+				t.Fatalf("output is %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.w, tt.h)
+			}
+			if !red(out.At(tt.redAt.X, tt.redAt.Y)) || red(out.At(tt.blueAt.X, tt.blueAt.Y)) {
+				t.Fatalf("wrong orientation: %v at %v, %v at %v", out.At(tt.redAt.X, tt.redAt.Y), tt.redAt, out.At(tt.blueAt.X, tt.blueAt.Y), tt.blueAt)
+			}
+		})
+	}
+}
+
+func TestSanitizeOrientationChecksRotatedDimensions(t *testing.T) {
+	// 300x100 cabe acostada pero no parada en un límite de 200x400
+	data := withJPEGExif(encodeJPEG(t, halves(300, 100)), 6)
+	limits := Limits{MaxBytes: 1 << 20, MaxWidth: 200, MaxHeight: 400}
+	img, err := Sanitize(data, limits)
+	if err != nil {
+		t.Fatalf("Sanitize: %v", err)
+	}
+	if img.Width != 100 || img.Height != 300 {
+		t.Fatalf("got %dx%d, want 100x300", img.Width, img.Height)
+	}
+	if _, err := Sanitize(encodeJPEG(t, halves(300, 100)), limits); !errors.Is(err, ErrDimensions) {
+		t.Fatalf("without rotation: got %v, want ErrDimensions", err)
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	little := []byte("II\x2a\x00\x08\x00\x00\x00\x01\x00\x12\x01\x03\x00\x01\x00\x00\x00\x06\x00\x00\x00")
+	tests := map[string]struct {
+		tiff []byte
+		want int
+	}{
+		"big endian":    {exifTIFF(8), 8},
+		"little endian": {little, 6},
+		"empty":         {nil, 0},
+		"bad order":     {[]byte("XX\x00\x2a\x00\x00\x00\x08"), 0},
+		"ifd past end":  {[]byte("MM\x00\x2a\x00\x00\xff\xff"), 0},
+		"truncated":     {exifTIFF(6)[:14], 0},
+	}
+	for name, tt := range tests {
+		if got := exifOrientation(tt.tiff); got != tt.want {
+			t.Errorf("%s: got %d, want %d", name, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeGIFFrames(t *testing.T) {
+	if n, err := gifFrames(encodeGIF(t, 10, 10, 7)); err != nil || n != 7 {
+		t.Fatalf("gifFrames = %d, %v; want 7", n, err)
+	}
+
+	if _, err := Sanitize(encodeGIF(t, 4, 4, MaxGIFFrames), testLimits); err != nil {
+		t.Fatalf("%d frames: %v", MaxGIFFrames, err)
+	}
+	if _, err := Sanitize(encodeGIF(t, 4, 4, MaxGIFFrames+1), testLimits); !errors.Is(err, ErrTooManyFrames) {
+		t.Fatalf("%d frames: got %v, want ErrTooManyFrames", MaxGIFFrames+1, err)
+	}
+
+	// Pantalla lógica de 8000x8000 con frames chicos: DecodeAll reservaría 8000x8000 por frame
+	bomb := encodeGIF(t, 4, 4, 2)
+	binary.LittleEndian.PutUint16(bomb[6:8], 8000)
+	binary.LittleEndian.PutUint16(bomb[8:10], 8000)
+	big := Limits{MaxBytes: 1 << 20, MaxWidth: 8000, MaxHeight: 8000}
+	if _, err := Sanitize(bomb, big); !errors.Is(err, ErrTooManyFrames) {
+		t.Fatalf("8000x8000x2: got %v, want ErrTooManyFrames", err)
+	}
+}
@@ -0,0 +1,97 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"path"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+)
+
+// Variant es una versión reducida de la portada para no bajar el original en cada vista.
+type Variant struct {
+	Name     string
+	MaxWidth int
+}
+
+// Variantes que se generan al guardar una imagen: la lista, las cards y el detalle
+var Variants = []Variant{
+	{Name: "thumb", MaxWidth: 160},
+	{Name: "card", MaxWidth: 400},
+	{Name: "full", MaxWidth: 1200},
+}
+
+// Las variantes siempre se guardan en WebP. El único encoder en Go puro (sin cgo) es lossless,
+// así que una variante puede salir más pesada que un JPEG original: esas no se guardan.
+const (
+	VariantExt         = ".webp"
+	VariantContentType = "image/webp"
+)
+
+// VariantKey arma la key de una variante al lado del original: user_x/abc.jpg -> user_x/abc_thumb.webp
+func VariantKey(key, name string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + "_" + name + VariantExt
+}
+
+// IsVariantKey dice si una key es de una variante y no de un original
+func IsVariantKey(key string) bool {
+	if path.Ext(key) != VariantExt {
+		return false
+	}
+	for _, v := range Variants {
+		if strings.HasSuffix(key, "_"+v.Name+VariantExt) {
+			return true
+		}
+	}
+	return false
+}
+
+// MakeVariants decodifica el original (de un GIF animado usa el primer frame)
+// y devuelve cada variante codificada, por nombre. Las que no pesan menos que el original
+// no vienen: para esas conviene servir el original (ver SkippedVariants).
+func MakeVariants(data []byte) (map[string][]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+
+	out := make(map[string][]byte, len(Variants))
+	for _, v := range Variants {
+		var buf bytes.Buffer
+		if err := nativewebp.Encode(&buf, Resize(src, v.MaxWidth), nil); err != nil {
+			return nil, err
+		}
+		if buf.Len() >= len(data) {
+			continue
+		}
+		out[v.Name] = buf.Bytes()
+	}
+	return out, nil
+}
+
+// SkippedVariants son los nombres que MakeVariants no generó
+func SkippedVariants(rendered map[string][]byte) []string {
+	var skipped []string
+	for _, v := range Variants {
+		if _, ok := rendered[v.Name]; !ok {
+			skipped = append(skipped, v.Name)
+		}
+	}
+	return skipped
+}
+
+// Resize achica la imagen al ancho dado manteniendo la proporción. Nunca agranda.
+func Resize(src image.Image, maxWidth int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > maxWidth {
+		h = max(1, h*maxWidth/w)
+		w = maxWidth
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+	return dst
+}
@@ -0,0 +1,247 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"view-list/internal/domain"
+	"view-list/internal/worker"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Handler ejecuta un job. Lo que devuelva se guarda como resultado.
+type Handler func(ctx context.Context, job *domain.Job) (map[string]string, error)
+
+type Options struct {
+	MaxAttempts  int           // intentos antes de pasar a dead
+	BaseBackoff  time.Duration // espera después del primer fallo, se duplica en cada intento
+	MaxBackoff   time.Duration
+	PollInterval time.Duration // cada cuánto se busca trabajo si la cola está vacía
+	Lease        time.Duration // tiempo máximo que un job puede quedar running antes de retomarse
+	Concurrency  int           // jobs corriendo a la vez dentro del worker pool
+}
+
+// Queue es una cola de jobs persistida en Mongo. Los jobs se ejecutan en el worker pool,
+// así el shutdown espera a los que estén corriendo.
+type Queue struct {
+	repo     domain.JobRepo
+	pool     *worker.Pool
+	opts     Options
+	handlers map[string]Handler
+
+	slots  chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+	mu     sync.RWMutex
+	wakeup chan struct{}
+}
+
+func NewQueue(repo domain.JobRepo, pool *worker.Pool, opts Options) *Queue {
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 1
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	return &Queue{
+		repo:     repo,
+		pool:     pool,
+		opts:     opts,
+		handlers: map[string]Handler{},
+		slots:    make(chan struct{}, opts.Concurrency),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		wakeup:   make(chan struct{}, 1),
+	}
+}
+
+// Register asocia un tipo de job con su handler. Se llama antes de Start.
+func (q *Queue) Register(jobType string, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = h
+}
+
+// Enqueue persiste un job nuevo para correr lo antes posible.
+func (q *Queue) Enqueue(ctx context.Context, jobType string, userID primitive.ObjectID, payload map[string]string) (*domain.Job, error) {
+	now := time.Now()
+	job := &domain.Job{
+		ID:          primitive.NewObjectID(),
+		Type:        jobType,
+		Payload:     payload,
+		Status:      domain.JobStatusPending,
+		MaxAttempts: q.opts.MaxAttempts,
+		UserID:      userID,
+		RunAt:       now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := q.repo.Create(ctx, job); err != nil {
+		return nil, err
+	}
+
+	// Despierto al dispatcher para no esperar al próximo poll
+	select {
+	case q.wakeup <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+func (q *Queue) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.Job, error) {
+	return q.repo.GetByID(ctx, id)
+}
+
+func (q *Queue) List(ctx context.Context, status domain.JobStatus, limit int64) ([]domain.Job, error) {
+	return q.repo.List(ctx, status, limit)
+}
+
+// Start arranca el dispatcher que va tomando jobs de Mongo.
+func (q *Queue) Start() {
+	go q.dispatch()
+}
+
+// Schedule encola jobType cada "every" hasta que se llame a Stop. El job corre por la cola
+// como cualquier otro, así queda registrado y se reintenta si falla.
+func (q *Queue) Schedule(jobType string, every time.Duration) {
+	go func() {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := q.Enqueue(context.Background(), jobType, primitive.NilObjectID, nil); err != nil {
+					log.Printf("⚠ Error scheduling job %s: %v\n", jobType, err)
+				}
+			case <-q.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop deja de tomar jobs nuevos. Los que ya están corriendo los espera el Shutdown del pool.
+func (q *Queue) Stop(ctx context.Context) error {
+	q.once.Do(func() { close(q.stop) })
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) dispatch() {
+	defer close(q.done)
+
+	for {
+		// Espero un lugar libre antes de tomar un job
+		select {
+		case q.slots <- struct{}{}:
+		case <-q.stop:
+			return
+		}
+
+		job, err := q.repo.ClaimNext(context.Background(), time.Now(), q.opts.Lease)
+		if err != nil {
+			log.Printf("⚠ Error claiming job: %v\n", err)
+		}
+		if job == nil {
+			<-q.slots
+			select {
+			case <-time.After(q.opts.PollInterval):
+			case <-q.wakeup:
+			case <-q.stop:
+				return
+			}
+			continue
+		}
+
+		err = q.pool.Submit("job "+job.Type+" "+job.ID.Hex(), func(ctx context.Context) error {
+			defer func() { <-q.slots }()
+			q.run(ctx, job)
+			return nil
+		})
+		if err != nil {
+			// El pool se está cerrando: el job vuelve a la cola para el próximo arranque
+			<-q.slots
+			q.release(job)
+			return
+		}
+	}
+}
+
+func (q *Queue) run(ctx context.Context, job *domain.Job) {
+	q.mu.RLock()
+	h, ok := q.handlers[job.Type]
+	q.mu.RUnlock()
+
+	var (
+		result map[string]string
+		err    error
+	)
+	if !ok {
+		err = fmt.Errorf("no handler registered for job type %q", job.Type)
+	} else {
+		result, err = safeRun(ctx, h, job)
+	}
+
+	// Las actualizaciones van con un contexto propio: el de la tarea puede estar cancelado
+	dbCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err == nil {
+		if err := q.repo.Complete(dbCtx, job.ID, job.LeaseOwner, result); err != nil {
+			log.Printf("⚠ Error completing job %s: %v\n", job.ID.Hex(), err)
+		}
+		return
+	}
+
+	// Cortado por el shutdown: no cuenta como intento
+	if ctx.Err() != nil {
+		q.release(job)
+		return
+	}
+
+	dead := !ok || job.Attempts >= job.MaxAttempts
+	runAt := time.Now().Add(q.backoff(job.Attempts))
+	if dead {
+		log.Printf("⚠ Job %s (%s) is dead after %d attempts: %v\n", job.ID.Hex(), job.Type, job.Attempts, err)
+	}
+	if err := q.repo.Fail(dbCtx, job.ID, job.LeaseOwner, err.Error(), runAt, dead); err != nil {
+		log.Printf("⚠ Error failing job %s: %v\n", job.ID.Hex(), err)
+	}
+}
+
+func (q *Queue) release(job *domain.Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := q.repo.Release(ctx, job.ID, job.LeaseOwner); err != nil {
+		log.Printf("⚠ Error releasing job %s: %v\n", job.ID.Hex(), err)
+	}
+}
+
+// Backoff exponencial: base, 2*base, 4*base... hasta MaxBackoff
+func (q *Queue) backoff(attempts int) time.Duration {
+	d := q.opts.BaseBackoff
+	for i := 1; i < attempts && d < q.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	if q.opts.MaxBackoff > 0 && d > q.opts.MaxBackoff {
+		d = q.opts.MaxBackoff
+	}
+	return d
+}
+
+func safeRun(ctx context.Context, h Handler, job *domain.Job) (result map[string]string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(ctx, job)
+}
@@ -0,0 +1,174 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	collectionName = "schema_migrations"
+	lockID         = "lock"
+	lockLease      = 10 * time.Minute // si el proceso muere con el lock, otro lo toma después de esto
+)
+
+var ErrLocked = errors.New("migrations are locked by another instance")
+
+// Migration es un cambio de esquema o de datos. Version es única y creciente; una vez
+// aplicada no se vuelve a correr, así que Up no se edita: los cambios nuevos van en otra versión.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+}
+
+type Applied struct {
+	Version   int       `bson:"_id" json:"version"`
+	Name      string    `bson:"name" json:"name"`
+	AppliedAt time.Time `bson:"applied_at" json:"applied_at"`
+}
+
+type Status struct {
+	Version int        `json:"version"`
+	Name    string     `json:"name"`
+	Applied *time.Time `json:"applied_at"` // nil si está pendiente
+}
+
+// Runner aplica en orden las migraciones pendientes y anota cada una en schema_migrations.
+// Varias instancias pueden arrancar a la vez: solo la que toma el lock corre las migraciones.
+type Runner struct {
+	db         *mongo.Database
+	col        *mongo.Collection
+	migrations []Migration
+}
+
+func NewRunner(db *mongo.Database, migrations []Migration) *Runner {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return &Runner{db: db, col: db.Collection(collectionName), migrations: sorted}
+}
+
+// Up corre las pendientes y devuelve cuántas aplicó. Si otra instancia tiene el lock
+// espera hasta que lo suelte (o hasta que se cancele ctx).
+func (r *Runner) Up(ctx context.Context) (int, error) {
+	if err := r.validate(); err != nil {
+		return 0, err
+	}
+	if err := r.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer r.unlock()
+
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range r.migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		start := time.Now()
+		if err := m.Up(ctx, r.db); err != nil {
+			return count, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		doc := Applied{Version: m.Version, Name: m.Name, AppliedAt: time.Now().UTC()}
+		if _, err := r.col.InsertOne(ctx, doc); err != nil {
+			return count, fmt.Errorf("migration %d (%s) ran but could not be recorded: %w", m.Version, m.Name, err)
+		}
+		log.Printf("Migration %d (%s) applied in %s\n", m.Version, m.Name, time.Since(start).Round(time.Millisecond))
+		count++
+	}
+	return count, nil
+}
+
+// Status lista todas las migraciones conocidas y cuándo se aplicó cada una
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Status, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		s := Status{Version: m.Version, Name: m.Name}
+		if a, ok := applied[m.Version]; ok {
+			at := a.AppliedAt
+			s.Applied = &at
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func (r *Runner) validate() error {
+	for i, m := range r.migrations {
+		if m.Version <= 0 || m.Up == nil {
+			return fmt.Errorf("invalid migration %d (%s)", m.Version, m.Name)
+		}
+		if i > 0 && r.migrations[i-1].Version == m.Version {
+			return fmt.Errorf("duplicated migration version %d", m.Version)
+		}
+	}
+	return nil
+}
+
+func (r *Runner) applied(ctx context.Context) (map[int]Applied, error) {
+	cursor, err := r.col.Find(ctx, bson.M{"_id": bson.M{"$type": "number"}})
+	if err != nil {
+		return nil, err
+	}
+	var docs []Applied
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	out := make(map[int]Applied, len(docs))
+	for _, d := range docs {
+		out[d.Version] = d
+	}
+	return out, nil
+}
+
+// El lock es un documento con _id fijo: el upsert solo matchea si está libre o vencido,
+// y si está tomado el insert choca con el _id y da duplicate key.
+func (r *Runner) lock(ctx context.Context) error {
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("%s:%d", host, os.Getpid())
+
+	for {
+		now := time.Now()
+		filter := bson.M{"_id": lockID, "locked_until": bson.M{"$lt": now}}
+		update := bson.M{"$set": bson.M{"owner": owner, "locked_until": now.Add(lockLease)}}
+		_, err := r.col.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if err == nil {
+			return nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+
+		log.Println("Waiting for another instance to finish the migrations...")
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %v", ErrLocked, ctx.Err())
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+func (r *Runner) unlock() {
+	// Con otro contexto: si ctx se canceló igual hay que soltar el lock
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := r.col.DeleteOne(ctx, bson.M{"_id": lockID}); err != nil {
+		log.Println("Error releasing migrations lock:", err)
+	}
+}
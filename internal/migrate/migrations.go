@@ -0,0 +1,175 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"view-list/internal/domain"
+	"view-list/internal/repository"
+	"view-list/internal/service"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// All devuelve las migraciones de la app en orden. Las nuevas se agregan al final con la versión siguiente.
+func All(images *service.ImageService) []Migration {
+	return []Migration{
+		{Version: 1, Name: "create_indexes", Up: createIndexes},
+		{Version: 2, Name: "image_keys", Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := service.MigrateImageKeys(ctx, repository.NewMangaRepo(db), images)
+			return err
+		}},
+		{Version: 3, Name: "smart_lists_indexes", Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("smart_lists").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "name", Value: 1}},
+				Options: options.Index().SetName("user_name"),
+			})
+			return err
+		}},
+		{Version: 4, Name: "collections_indexes", Up: collectionsIndexes},
+		{Version: 5, Name: "seed_reading_states", Up: seedReadingStates},
+		{Version: 6, Name: "series_text_index", Up: seriesTextIndex},
+		{Version: 7, Name: "media_kind", Up: mediaKind},
+		{Version: 8, Name: "drop_text_indexes", Up: dropTextIndexes},
+	}
+}
+
+// Si ya hay emails repetidos el índice único falla: hay que resolverlos a mano y volver a arrancar
+func createIndexes(ctx context.Context, db *mongo.Database) error {
+	indexes := map[string][]mongo.IndexModel{
+		"users": {
+			{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetName("email_unique").SetUnique(true)},
+		},
+		"mangas": {
+			// Listado del usuario ordenado por fecha, con y sin filtro de estado
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "updated_at", Value: -1}}, Options: options.Index().SetName("user_updated")},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "state", Value: 1}}, Options: options.Index().SetName("user_state")},
+			{Keys: bson.D{{Key: "name", Value: "text"}}, Options: options.Index().SetName("name_text")},
+		},
+		"jobs": {
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "run_at", Value: 1}}, Options: options.Index().SetName("status_run_at")},
+		},
+	}
+
+	for collection, models := range indexes {
+		if _, err := db.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func collectionsIndexes(ctx context.Context, db *mongo.Database) error {
+	if _, err := db.Collection("collections").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "position", Value: 1}},
+		Options: options.Index().SetName("user_position"),
+	}); err != nil {
+		return err
+	}
+	_, err := db.Collection("collection_items").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// Un manga una sola vez por colección
+		{Keys: bson.D{{Key: "collection_id", Value: 1}, {Key: "manga_id", Value: 1}}, Options: options.Index().SetName("collection_manga_unique").SetUnique(true)},
+		{Keys: bson.D{{Key: "collection_id", Value: 1}, {Key: "position", Value: 1}}, Options: options.Index().SetName("collection_position")},
+		{Keys: bson.D{{Key: "manga_id", Value: 1}}, Options: options.Index().SetName("manga")},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}, Options: options.Index().SetName("user")},
+	})
+	return err
+}
+
+// Cada usuario sin estados recibe los por defecto, más los que ya usan sus mangas y no están
+// entre esos (datos viejos o cargados a mano), así ningún manga queda con un estado inválido.
+func seedReadingStates(ctx context.Context, db *mongo.Database) error {
+	users := db.Collection("users")
+	mangas := db.Collection("mangas")
+
+	cursor, err := users.Find(ctx, bson.M{"states": bson.M{"$exists": false}}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	var ids []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &ids); err != nil {
+		return err
+	}
+
+	for _, u := range ids {
+		states := domain.DefaultReadingStates()
+		known := map[domain.MangaState]bool{}
+		for _, s := range states {
+			known[s.Key] = true
+		}
+
+		used, err := mangas.Distinct(ctx, "state", bson.M{"user_id": u.ID})
+		if err != nil {
+			return err
+		}
+		for _, v := range used {
+			key, ok := v.(string)
+			if !ok || key == "" || known[domain.MangaState(key)] {
+				continue
+			}
+			known[domain.MangaState(key)] = true
+			states = append(states, domain.ReadingState{Key: domain.MangaState(key), Label: key, Color: "#a3a3a3", Category: domain.CategoryInactive})
+		}
+
+		if _, err := users.UpdateOne(ctx, bson.M{"_id": u.ID}, bson.M{"$set": bson.M{"states": states}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Mongo deja un solo índice de texto por colección: el de name se cambia por uno que también
+// cubre títulos alternativos y autores, con más peso para los títulos
+func seriesTextIndex(ctx context.Context, db *mongo.Database) error {
+	indexes := db.Collection("mangas").Indexes()
+	if _, err := indexes.DropOne(ctx, "name_text"); err != nil && !isIndexNotFound(err) {
+		return err
+	}
+	_, err := indexes.CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "name", Value: "text"},
+			{Key: "alt_titles.title", Value: "text"},
+			{Key: "authors", Value: "text"},
+			{Key: "artists", Value: "text"},
+		},
+		Options: options.Index().SetName("series_text").
+			SetWeights(bson.M{"name": 3, "alt_titles.title": 3, "authors": 2, "artists": 2}).
+			SetDefaultLanguage("none"), // sin stemming: los títulos mezclan idiomas
+	})
+	return err
+}
+
+// Base nueva (la colección todavía no existe) o índice ya borrado a mano
+func isIndexNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && (cmdErr.Code == 26 || cmdErr.Code == 27) // NamespaceNotFound, IndexNotFound
+}
+
+// Todo lo que había antes de los tipos es manga. El índice es para /api/mangas, que filtra por tipo.
+func mediaKind(ctx context.Context, db *mongo.Database) error {
+	mangas := db.Collection("mangas")
+	if _, err := mangas.UpdateMany(ctx, bson.M{"kind": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"kind": domain.KindManga}}); err != nil {
+		return err
+	}
+	_, err := mangas.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "kind", Value: 1}, {Key: "updated_at", Value: -1}},
+		Options: options.Index().SetName("user_kind_updated"),
+	})
+	return err
+}
+
+// La búsqueda libre se puntúa en memoria (internal/search) y nunca usó los índices de texto:
+// solo ocupaban lugar y hacían más lenta cada escritura
+func dropTextIndexes(ctx context.Context, db *mongo.Database) error {
+	indexes := db.Collection("mangas").Indexes()
+	for _, name := range []string{"name_text", "series_text"} {
+		if _, err := indexes.DropOne(ctx, name); err != nil && !isIndexNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
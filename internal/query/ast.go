@@ -0,0 +1,198 @@
+// Package query define el lenguaje de filtros de los listados (ej: `genre:isekai state:reading chapter>100`)
+// y el árbol en que se parsea. El árbol no sabe nada de Mongo: cada repo lo traduce a su manera.
+package query
+
+import "time"
+
+type Node interface{ node() }
+
+// And: tienen que cumplirse todos
+type And struct{ Nodes []Node }
+
+// Or: alcanza con uno
+type Or struct{ Nodes []Node }
+
+type Not struct{ Node Node }
+
+// Text es búsqueda libre (difusa, ver internal/search); los repos no la aplican
+type Text struct{ Value string }
+
+type Field string
+
+const (
+	FieldKind        Field = "kind" // manga, anime, etc.
+	FieldState       Field = "state"
+	FieldGenre       Field = "genre"
+	FieldChapter     Field = "chapter"
+	FieldScore       Field = "score"  // en la escala del usuario hasta que el servicio lo normaliza
+	FieldAuthor      Field = "author" // autores o artistas
+	FieldType        Field = "type"
+	FieldDemographic Field = "demographic"
+	FieldLanguage    Field = "lang" // idioma original
+	FieldYear        Field = "year" // año de inicio
+	FieldCreated     Field = "created"
+	FieldUpdated     Field = "updated"
+	FieldLink        Field = "link"   // solo con OpExists (has:link)
+	FieldImage       Field = "image"  // solo con OpExists (has:image)
+	FieldReview      Field = "review" // solo con OpExists (has:review)
+)
+
+type Op string
+
+const (
+	OpIn     Op = "in"  // alguno de Strings
+	OpAll    Op = "all" // todos los de Strings (géneros)
+	OpEq     Op = "="
+	OpLt     Op = "<"
+	OpLte    Op = "<="
+	OpGt     Op = ">"
+	OpGte    Op = ">="
+	OpExists Op = "exists" // campo no vacío
+)
+
+// Cond es una condición sobre un campo. Según el campo se usa Strings (kind, state, genre, author, type,
+// demographic, lang), Number (chapter, score, year) o Time (created, updated).
+type Cond struct {
+	Field   Field
+	Op      Op
+	Strings []string
+	Number  float64
+	Time    time.Time
+}
+
+func (And) node()  {}
+func (Or) node()   {}
+func (Not) node()  {}
+func (Text) node() {}
+func (Cond) node() {}
+
+// Walk recorre el árbol en profundidad; si fn devuelve false no baja a los hijos de ese nodo
+func Walk(n Node, fn func(Node) bool) {
+	if n == nil || !fn(n) {
+		return
+	}
+	switch v := n.(type) {
+	case And:
+		for _, c := range v.Nodes {
+			Walk(c, fn)
+		}
+	case Or:
+		for _, c := range v.Nodes {
+			Walk(c, fn)
+		}
+	case Not:
+		Walk(v.Node, fn)
+	}
+}
+
+// MapConds devuelve una copia del árbol con cada condición cambiada por fn
+func MapConds(n Node, fn func(Cond) Cond) Node {
+	switch v := n.(type) {
+	case And:
+		nodes := make([]Node, len(v.Nodes))
+		for i, c := range v.Nodes {
+			nodes[i] = MapConds(c, fn)
+		}
+		return And{Nodes: nodes}
+	case Or:
+		nodes := make([]Node, len(v.Nodes))
+		for i, c := range v.Nodes {
+			nodes[i] = MapConds(c, fn)
+		}
+		return Or{Nodes: nodes}
+	case Not:
+		return Not{Node: MapConds(v.Node, fn)}
+	case Cond:
+		return fn(v)
+	}
+	return n
+}
+
+// HasText dice si hay búsqueda libre en algún lado del árbol
+func HasText(n Node) bool {
+	found := false
+	Walk(n, func(n Node) bool {
+		if _, ok := n.(Text); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// PositiveText junta las búsquedas libres que no están negadas, para ordenar por relevancia
+func PositiveText(n Node) []string {
+	var out []string
+	Walk(n, func(n Node) bool {
+		switch v := n.(type) {
+		case Not:
+			return false
+		case Text:
+			out = append(out, v.Value)
+		}
+		return true
+	})
+	return out
+}
+
+// Combine une con AND los nodos que no son nil (nil si no queda ninguno)
+func Combine(nodes ...Node) Node {
+	var out []Node
+	for _, n := range nodes {
+		if n != nil {
+			out = append(out, n)
+		}
+	}
+	switch len(out) {
+	case 0:
+		return nil
+	case 1:
+		return out[0]
+	}
+	return And{Nodes: out}
+}
+
+// HasField dice si alguna condición del árbol es sobre field
+func HasField(n Node, field Field) bool {
+	found := false
+	Walk(n, func(n Node) bool {
+		if c, ok := n.(Cond); ok && c.Field == field {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// Without saca las condiciones sobre field, como si no estuvieran (nil si no queda nada).
+// Sirve para contar las otras opciones de un campo que ya está filtrado (ej: las pestañas de estados).
+func Without(n Node, field Field) Node {
+	switch v := n.(type) {
+	case And:
+		var nodes []Node
+		for _, c := range v.Nodes {
+			nodes = append(nodes, Without(c, field))
+		}
+		return Combine(nodes...)
+	case Or:
+		nodes := make([]Node, 0, len(v.Nodes))
+		for _, c := range v.Nodes {
+			m := Without(c, field)
+			if m == nil {
+				return nil // una rama sin condiciones cumple siempre
+			}
+			nodes = append(nodes, m)
+		}
+		return Or{Nodes: nodes}
+	case Not:
+		if m := Without(v.Node, field); m != nil {
+			return Not{Node: m}
+		}
+		return nil
+	case Cond:
+		if v.Field == field {
+			return nil
+		}
+	}
+	return n
+}
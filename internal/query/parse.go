@@ -0,0 +1,484 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var ErrSyntax = errors.New("invalid query")
+
+const (
+	maxLength = 1000
+	maxTerms  = 50
+	maxDepth  = 10
+)
+
+const dateLayout = "2006-01-02"
+
+// Parse convierte la consulta en un árbol. Gramática:
+//
+//	consulta  = or
+//	or        = and { ("OR" | "|") and }
+//	and       = unario { ["AND"] unario }
+//	unario    = "-" unario | "NOT" unario | "(" or ")" | término
+//	término   = campo ":" valor | campo op valor | has:link | texto
+//
+// Campos: kind, state, genre, author, type, demographic, lang, chapter, score, year, created, updated y has.
+// En los de texto "a,b" es cualquiera y en genre "a+b" son todos. chapter, score, year, created y
+// updated aceptan <, <=, >, >= y rangos "a..b";
+// las fechas van como 2006-01-02 o relativas a hoy (now-30d). Los valores con espacios van entre comillas.
+// Una consulta vacía devuelve nil.
+func Parse(input string) (Node, error) {
+	if len(input) > maxLength {
+		return nil, fmt.Errorf("%w: too long (max %d characters)", ErrSyntax, maxLength)
+	}
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	p := &parser{tokens: tokens}
+	n, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrSyntax, p.peek().text)
+	}
+	return n, nil
+}
+
+// -------------------- LEXER --------------------
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokLParen
+	tokRParen
+	tokOr
+	tokAnd
+	tokNot
+)
+
+type token struct {
+	kind tokenKind
+	text string // palabra ya sin comillas
+}
+
+func lex(input string) ([]token, error) {
+	var tokens []token
+	r := []rune(input)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")"})
+			i++
+		case c == '|':
+			tokens = append(tokens, token{kind: tokOr, text: "|"})
+			i++
+		case c == '-' && i+1 < len(r) && !unicode.IsSpace(r[i+1]) && (i == 0 || !isWordRune(r[i-1])):
+			tokens = append(tokens, token{kind: tokNot, text: "-"})
+			i++
+		default:
+			// Palabra: hasta un espacio o paréntesis; lo que está entre comillas va entero
+			var b strings.Builder
+			for i < len(r) && !unicode.IsSpace(r[i]) && r[i] != '(' && r[i] != ')' {
+				if r[i] == '"' {
+					end := indexRune(r, i+1, '"')
+					if end < 0 {
+						return nil, fmt.Errorf("%w: unclosed quote", ErrSyntax)
+					}
+					b.WriteString(string(r[i+1 : end]))
+					i = end + 1
+					continue
+				}
+				b.WriteRune(r[i])
+				i++
+			}
+			word := b.String()
+			switch word {
+			case "OR":
+				tokens = append(tokens, token{kind: tokOr, text: word})
+			case "AND":
+				tokens = append(tokens, token{kind: tokAnd, text: word})
+			case "NOT":
+				tokens = append(tokens, token{kind: tokNot, text: word})
+			default:
+				tokens = append(tokens, token{kind: tokWord, text: word})
+			}
+		}
+		if len(tokens) > maxTerms*2 {
+			return nil, fmt.Errorf("%w: too many terms (max %d)", ErrSyntax, maxTerms)
+		}
+	}
+	return tokens, nil
+}
+
+func isWordRune(c rune) bool {
+	return !unicode.IsSpace(c) && c != '(' && c != '|'
+}
+
+func indexRune(r []rune, from int, c rune) int {
+	for i := from; i < len(r); i++ {
+		if r[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// -------------------- PARSER --------------------
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool          { return p.pos >= len(p.tokens) }
+func (p *parser) peek() token         { return p.tokens[p.pos] }
+func (p *parser) next() token         { t := p.tokens[p.pos]; p.pos++; return t }
+func (p *parser) is(k tokenKind) bool { return !p.done() && p.peek().kind == k }
+
+func (p *parser) parseOr(depth int) (Node, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("%w: too deeply nested", ErrSyntax)
+	}
+	first, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Node{first}
+	for p.is(tokOr) {
+		p.next()
+		n, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	if len(nodes) == 1 {
+		return first, nil
+	}
+	return Or{Nodes: nodes}, nil
+}
+
+func (p *parser) parseAnd(depth int) (Node, error) {
+	var nodes []Node
+	for !p.done() && !p.is(tokOr) && !p.is(tokRParen) {
+		if p.is(tokAnd) {
+			p.next()
+			continue
+		}
+		n, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	if len(nodes) == 0 {
+		if p.done() {
+			return nil, fmt.Errorf("%w: missing term at the end", ErrSyntax)
+		}
+		return nil, fmt.Errorf("%w: missing term before %q", ErrSyntax, p.peek().text)
+	}
+	return Combine(mergeText(nodes)...), nil
+}
+
+func (p *parser) parseUnary(depth int) (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNot:
+		if p.done() {
+			return nil, fmt.Errorf("%w: nothing to negate", ErrSyntax)
+		}
+		n, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Not{Node: n}, nil
+	case tokLParen:
+		n, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if !p.is(tokRParen) {
+			return nil, fmt.Errorf("%w: missing )", ErrSyntax)
+		}
+		p.next()
+		return n, nil
+	case tokWord:
+		return parseTerm(t.text)
+	}
+	return nil, fmt.Errorf("%w: unexpected %q", ErrSyntax, t.text)
+}
+
+// Las palabras sueltas seguidas se buscan juntas ("one piece" y no "one" AND "piece" por separado)
+func mergeText(nodes []Node) []Node {
+	var out []Node
+	for _, n := range nodes {
+		if t, ok := n.(Text); ok && len(out) > 0 {
+			if prev, ok := out[len(out)-1].(Text); ok {
+				out[len(out)-1] = Text{Value: prev.Value + " " + t.Value}
+				continue
+			}
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+// -------------------- TÉRMINOS --------------------
+
+var comparisons = []Op{OpGte, OpLte, OpGt, OpLt} // los de dos caracteres primero
+
+func parseTerm(word string) (Node, error) {
+	name, op, value, ok := splitTerm(word)
+	if !ok {
+		return Text{Value: word}, nil
+	}
+
+	switch name {
+	case "has":
+		if op != OpEq {
+			return nil, fmt.Errorf("%w: has only supports has:link, has:image, has:score or has:review", ErrSyntax)
+		}
+		switch strings.ToLower(value) {
+		case "link":
+			return Cond{Field: FieldLink, Op: OpExists}, nil
+		case "image", "cover":
+			return Cond{Field: FieldImage, Op: OpExists}, nil
+		case "score", "rating":
+			return Cond{Field: FieldScore, Op: OpExists}, nil
+		case "review":
+			return Cond{Field: FieldReview, Op: OpExists}, nil
+		}
+		return nil, fmt.Errorf("%w: unknown has:%s (use link, image, score or review)", ErrSyntax, value)
+
+	case "language":
+		return parseTerm(string(FieldLanguage) + word[len(name):])
+
+	case "current": // el nombre genérico del progreso en /api/media
+		return parseTerm(string(FieldChapter) + word[len(name):])
+
+	case string(FieldKind), string(FieldState), string(FieldGenre), string(FieldAuthor), string(FieldType), string(FieldDemographic), string(FieldLanguage):
+		if op != OpEq {
+			return nil, fmt.Errorf("%w: %s only supports %s:value", ErrSyntax, name, name)
+		}
+		field := Field(name)
+		sep, setOp := ",", OpIn
+		if field == FieldGenre && strings.Contains(value, "+") {
+			sep, setOp = "+", OpAll
+		}
+		values := splitList(value, sep)
+		if len(values) == 0 {
+			return nil, fmt.Errorf("%w: empty value for %s", ErrSyntax, name)
+		}
+		for i, v := range values {
+			switch field {
+			case FieldState, FieldType:
+				values[i] = normalizeState(v) // on_hold, light-novel
+			case FieldKind, FieldDemographic, FieldLanguage:
+				values[i] = strings.ToLower(v)
+			}
+		}
+		return Cond{Field: field, Op: setOp, Strings: values}, nil
+
+	case string(FieldChapter), string(FieldScore), string(FieldYear):
+		return parseRange(Field(name), op, value, func(s string) (Cond, error) {
+			n, err := strconv.ParseFloat(s, 64)
+			if err != nil || n < 0 {
+				return Cond{}, fmt.Errorf("%w: invalid %s %q", ErrSyntax, name, s)
+			}
+			return Cond{Number: n}, nil
+		})
+
+	case string(FieldCreated), string(FieldUpdated):
+		return parseDateRange(Field(name), op, value)
+	}
+
+	// Campo desconocido: "re:zero" es una búsqueda, no un error
+	return Text{Value: word}, nil
+}
+
+// splitTerm separa "campo:valor" o "campo>=valor"
+func splitTerm(word string) (name string, op Op, value string, ok bool) {
+	for i, c := range word {
+		switch c {
+		case ':':
+			name, value = strings.ToLower(word[:i]), word[i+1:]
+			// "chapter:>100" también vale
+			for _, cmp := range comparisons {
+				if strings.HasPrefix(value, string(cmp)) {
+					return name, cmp, value[len(cmp):], name != ""
+				}
+			}
+			return name, OpEq, value, name != ""
+		case '<', '>':
+			name = strings.ToLower(word[:i])
+			for _, cmp := range comparisons {
+				if strings.HasPrefix(word[i:], string(cmp)) {
+					return name, cmp, word[i+len(cmp):], name != ""
+				}
+			}
+		}
+		if !unicode.IsLetter(c) {
+			return "", "", "", false
+		}
+	}
+	return "", "", "", false
+}
+
+// "a..b" es un rango cerrado; ":" sin rango es igualdad
+func parseRange(field Field, op Op, value string, parse func(string) (Cond, error)) (Node, error) {
+	if op == OpEq {
+		if from, to, isRange := strings.Cut(value, ".."); isRange {
+			var nodes []Node
+			if from != "" {
+				c, err := parse(from)
+				if err != nil {
+					return nil, err
+				}
+				c.Field, c.Op = field, OpGte
+				nodes = append(nodes, c)
+			}
+			if to != "" {
+				c, err := parse(to)
+				if err != nil {
+					return nil, err
+				}
+				c.Field, c.Op = field, OpLte
+				nodes = append(nodes, c)
+			}
+			if len(nodes) == 0 {
+				return nil, fmt.Errorf("%w: empty range for %s", ErrSyntax, field)
+			}
+			return Combine(nodes...), nil
+		}
+	}
+	c, err := parse(value)
+	if err != nil {
+		return nil, err
+	}
+	c.Field, c.Op = field, op
+	return c, nil
+}
+
+// Las fechas son días enteros (UTC): updated:2024-05-01 es todo ese día y updated<=2024-05-01 lo incluye.
+// Las relativas (now-30d) se comparan contra el instante exacto.
+func parseDateRange(field Field, op Op, value string) (Node, error) {
+	day := func(op Op, s string) (Node, error) {
+		if t, ok, err := parseRelative(s); ok || err != nil {
+			if err != nil {
+				return nil, err
+			}
+			if op != OpEq {
+				return Cond{Field: field, Op: op, Time: t}, nil
+			}
+			s = t.Format(dateLayout) // updated:now-1d es todo el día de ayer
+		}
+		t, err := time.Parse(dateLayout, s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid date %q (use YYYY-MM-DD or now-30d)", ErrSyntax, s)
+		}
+		next := t.AddDate(0, 0, 1)
+		switch op {
+		case OpEq:
+			return And{Nodes: []Node{Cond{Field: field, Op: OpGte, Time: t}, Cond{Field: field, Op: OpLt, Time: next}}}, nil
+		case OpLte:
+			return Cond{Field: field, Op: OpLt, Time: next}, nil
+		case OpGt:
+			return Cond{Field: field, Op: OpGte, Time: next}, nil
+		}
+		return Cond{Field: field, Op: op, Time: t}, nil
+	}
+
+	if op == OpEq {
+		if from, to, isRange := strings.Cut(value, ".."); isRange {
+			var nodes []Node
+			if from != "" {
+				n, err := day(OpGte, from)
+				if err != nil {
+					return nil, err
+				}
+				nodes = append(nodes, n)
+			}
+			if to != "" {
+				n, err := day(OpLte, to)
+				if err != nil {
+					return nil, err
+				}
+				nodes = append(nodes, n)
+			}
+			if len(nodes) == 0 {
+				return nil, fmt.Errorf("%w: empty range for %s", ErrSyntax, field)
+			}
+			return Combine(nodes...), nil
+		}
+	}
+	return day(op, value)
+}
+
+// Now se puede pisar para tener fechas relativas fijas
+var Now = time.Now
+
+// parseRelative entiende "now" y "now-<n><unidad>" con h (horas), d (días), w (semanas), m (meses) e y (años)
+func parseRelative(s string) (time.Time, bool, error) {
+	rest, ok := strings.CutPrefix(strings.ToLower(s), "now")
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	now := Now().UTC()
+	if rest == "" {
+		return now, true, nil
+	}
+	invalid := fmt.Errorf("%w: invalid relative date %q (e.g. now-30d)", ErrSyntax, s)
+	if !strings.HasPrefix(rest, "-") || len(rest) < 3 {
+		return time.Time{}, true, invalid
+	}
+	n, err := strconv.Atoi(rest[1 : len(rest)-1])
+	if err != nil || n < 0 || n > 100000 {
+		return time.Time{}, true, invalid
+	}
+	switch rest[len(rest)-1] {
+	case 'h':
+		return now.Add(-time.Duration(n) * time.Hour), true, nil
+	case 'd':
+		return now.AddDate(0, 0, -n), true, nil
+	case 'w':
+		return now.AddDate(0, 0, -7*n), true, nil
+	case 'm':
+		return now.AddDate(0, -n, 0), true, nil
+	case 'y':
+		return now.AddDate(-n, 0, 0), true, nil
+	}
+	return time.Time{}, true, invalid
+}
+
+func splitList(value, sep string) []string {
+	var out []string
+	for _, v := range strings.Split(value, sep) {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// "on_hold", "on-hold" y "ON HOLD" son el estado "on hold"
+func normalizeState(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.NewReplacer("_", " ", "-", " ").Replace(s)
+}
@@ -0,0 +1,214 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func in(field Field, values ...string) Cond {
+	return Cond{Field: field, Op: OpIn, Strings: values}
+}
+
+func num(field Field, op Op, n float64) Cond {
+	return Cond{Field: field, Op: op, Number: n}
+}
+
+func at(field Field, op Op, t time.Time) Cond {
+	return Cond{Field: field, Op: op, Time: t}
+}
+
+func TestParse(t *testing.T) {
+	now := time.Date(2024, 5, 10, 15, 30, 0, 0, time.UTC)
+	Now = func() time.Time { return now }
+	defer func() { Now = time.Now }()
+
+	tests := []struct {
+		input string
+		want  Node
+	}{
+		{"", nil},
+		{"   ", nil},
+
+		// Texto libre: las palabras seguidas van juntas
+		{"one piece", Text{Value: "one piece"}},
+		{`"one piece" genre:action`, And{Nodes: []Node{Text{Value: "one piece"}, in(FieldGenre, "action")}}},
+		{"re:zero", Text{Value: "re:zero"}}, // campo desconocido
+		{"spy-family", Text{Value: "spy-family"}},
+
+		// Campos de texto
+		{"genre:isekai", in(FieldGenre, "isekai")},
+		{"GENRE:Isekai", in(FieldGenre, "Isekai")},
+		{"genre:action,comedy", in(FieldGenre, "action", "comedy")},
+		{"genre:action+comedy", Cond{Field: FieldGenre, Op: OpAll, Strings: []string{"action", "comedy"}}},
+		{"state:on_hold", in(FieldState, "on hold")},
+		{`state:"Plan to read"`, in(FieldState, "plan to read")},
+		{"kind:ANIME", in(FieldKind, "anime")},
+		{"type:light-novel", in(FieldType, "light novel")},
+		{"language:JA", in(FieldLanguage, "ja")},
+		{"author:Oda", in(FieldAuthor, "Oda")},
+
+		// Números y rangos
+		{"chapter>100", num(FieldChapter, OpGt, 100)},
+		{"chapter:>=100", num(FieldChapter, OpGte, 100)},
+		{"current<=12.5", num(FieldChapter, OpLte, 12.5)},
+		{"score:8", num(FieldScore, OpEq, 8)},
+		{"year:2010..2015", And{Nodes: []Node{num(FieldYear, OpGte, 2010), num(FieldYear, OpLte, 2015)}}},
+		{"year:2010..", num(FieldYear, OpGte, 2010)},
+		{"chapter:..50", num(FieldChapter, OpLte, 50)},
+
+		// Fechas: días enteros, las relativas al instante
+		{"updated:2024-05-01", And{Nodes: []Node{at(FieldUpdated, OpGte, day("2024-05-01")), at(FieldUpdated, OpLt, day("2024-05-02"))}}},
+		{"updated<=2024-05-01", at(FieldUpdated, OpLt, day("2024-05-02"))},
+		{"updated>2024-05-01", at(FieldUpdated, OpGte, day("2024-05-02"))},
+		{"created<2024-05-01", at(FieldCreated, OpLt, day("2024-05-01"))},
+		{"created:2024-01-01..2024-01-31", And{Nodes: []Node{at(FieldCreated, OpGte, day("2024-01-01")), at(FieldCreated, OpLt, day("2024-02-01"))}}},
+		{"updated>now-30d", at(FieldUpdated, OpGt, now.AddDate(0, 0, -30))},
+		{"updated>now-2w", at(FieldUpdated, OpGt, now.AddDate(0, 0, -14))},
+		{"updated>now-6h", at(FieldUpdated, OpGt, now.Add(-6*time.Hour))},
+		{"updated:now-1d", And{Nodes: []Node{at(FieldUpdated, OpGte, day("2024-05-09")), at(FieldUpdated, OpLt, day("2024-05-10"))}}},
+
+		// has:
+		{"has:link", Cond{Field: FieldLink, Op: OpExists}},
+		{"has:cover", Cond{Field: FieldImage, Op: OpExists}},
+		{"has:rating", Cond{Field: FieldScore, Op: OpExists}},
+		{"-has:review", Not{Node: Cond{Field: FieldReview, Op: OpExists}}},
+
+		// Operadores y precedencia: AND antes que OR
+		{"genre:a genre:b", And{Nodes: []Node{in(FieldGenre, "a"), in(FieldGenre, "b")}}},
+		{"genre:a AND genre:b", And{Nodes: []Node{in(FieldGenre, "a"), in(FieldGenre, "b")}}},
+		{"genre:a OR genre:b", Or{Nodes: []Node{in(FieldGenre, "a"), in(FieldGenre, "b")}}},
+		{"genre:a | genre:b genre:c", Or{Nodes: []Node{in(FieldGenre, "a"), And{Nodes: []Node{in(FieldGenre, "b"), in(FieldGenre, "c")}}}}},
+		{"(genre:a | genre:b) genre:c", And{Nodes: []Node{Or{Nodes: []Node{in(FieldGenre, "a"), in(FieldGenre, "b")}}, in(FieldGenre, "c")}}},
+		{"-state:dropped", Not{Node: in(FieldState, "dropped")}},
+		{"NOT (state:dropped OR state:completed)", Not{Node: Or{Nodes: []Node{in(FieldState, "dropped"), in(FieldState, "completed")}}}},
+		{"berserk -genre:horror", And{Nodes: []Node{Text{Value: "berserk"}, Not{Node: in(FieldGenre, "horror")}}}},
+		{"- berserk", Text{Value: "- berserk"}}, // un guion suelto no niega
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Parse(%q)\n got: %#v\nwant: %#v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		`"unclosed`,
+		"(genre:a",
+		"genre:a)",
+		"genre:a OR",
+		"OR genre:a",
+		"NOT",
+		"()",
+		"genre:",
+		"genre:,",
+		"genre>3",
+		"chapter:abc",
+		"chapter>-1",
+		"year:..",
+		"updated:2024-13-01",
+		"updated>now+1d",
+		"updated>now-3x",
+		"has:friends",
+		"has>1",
+		strings.Repeat("(", maxDepth+2) + "a" + strings.Repeat(")", maxDepth+2),
+		strings.Repeat("a ", maxTerms*2+1),
+		strings.Repeat("a", maxLength+1),
+	}
+	for _, input := range tests {
+		name := input
+		if len(name) > 40 {
+			name = name[:40]
+		}
+		t.Run(name, func(t *testing.T) {
+			if n, err := Parse(input); !errors.Is(err, ErrSyntax) {
+				t.Fatalf("Parse(%q) = %#v, %v; want ErrSyntax", input, n, err)
+			}
+		})
+	}
+}
+
+func TestPositiveText(t *testing.T) {
+	n, err := Parse(`one piece -"two piece" (genre:a | "three")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := PositiveText(n); !reflect.DeepEqual(got, []string{"one piece", "three"}) {
+		t.Fatalf("PositiveText = %q", got)
+	}
+	if !HasText(n) {
+		t.Fatal("HasText = false")
+	}
+	if n, _ := Parse("genre:a"); HasText(n) {
+		t.Fatal("HasText(genre:a) = true")
+	}
+}
+
+func TestMapConds(t *testing.T) {
+	n, err := Parse("score>8 OR -score:5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := MapConds(n, func(c Cond) Cond {
+		c.Number *= 10
+		return c
+	})
+	want := Or{Nodes: []Node{num(FieldScore, OpGt, 80), Not{Node: num(FieldScore, OpEq, 50)}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("MapConds\n got: %#v\nwant: %#v", got, want)
+	}
+	// El árbol original no cambia
+	if !reflect.DeepEqual(n, Or{Nodes: []Node{num(FieldScore, OpGt, 8), Not{Node: num(FieldScore, OpEq, 5)}}}) {
+		t.Fatalf("MapConds changed the original tree: %#v", n)
+	}
+}
+
+func TestWithout(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Node
+	}{
+		{"state:reading", nil},
+		{"genre:a", in(FieldGenre, "a")},
+		{"state:reading genre:a", in(FieldGenre, "a")},
+		{"-state:dropped genre:a chapter>10", And{Nodes: []Node{in(FieldGenre, "a"), num(FieldChapter, OpGt, 10)}}},
+		// Una rama del OR sin condiciones cumple siempre
+		{"state:reading | genre:a", nil},
+		{"(state:reading state:completed) | genre:a", nil},
+		{"(state:reading genre:b) | genre:a", Or{Nodes: []Node{in(FieldGenre, "b"), in(FieldGenre, "a")}}},
+		{"berserk state:reading", Text{Value: "berserk"}},
+	}
+	for _, tt := range tests {
+		n, err := Parse(tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Without(n, FieldState); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Without(%q)\n got: %#v\nwant: %#v", tt.input, got, tt.want)
+		}
+		if HasField(Without(n, FieldState), FieldState) {
+			t.Errorf("Without(%q) kept a state condition", tt.input)
+		}
+	}
+	if n, _ := Parse("genre:a (chapter>1 | -state:dropped)"); !HasField(n, FieldState) {
+		t.Error("HasField did not find the nested state condition")
+	}
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"view-list/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoCollectionRepo struct {
+	db    *mongo.Collection
+	items *mongo.Collection
+}
+
+func NewCollectionRepo(db *mongo.Database) domain.CollectionRepo {
+	return &MongoCollectionRepo{db: db.Collection("collections"), items: db.Collection("collection_items")}
+}
+
+func (r *MongoCollectionRepo) Create(ctx context.Context, c *domain.Collection) error {
+	_, err := r.db.InsertOne(ctx, c)
+	return err
+}
+
+func (r *MongoCollectionRepo) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.Collection, error) {
+	var c domain.Collection
+	if err := r.db.FindOne(ctx, bson.M{"_id": id}).Decode(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *MongoCollectionRepo) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]domain.Collection, error) {
+	cols := []domain.Collection{}
+	cursor, err := r.db.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "position", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &cols); err != nil {
+		return nil, err
+	}
+
+	// Cantidad de mangas de cada una en un solo aggregate
+	counts, err := r.items.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID}}},
+		{{Key: "$group", Value: bson.M{"_id": "$collection_id", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Count int                `bson:"count"`
+	}
+	if err := counts.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	byID := make(map[primitive.ObjectID]int, len(rows))
+	for _, row := range rows {
+		byID[row.ID] = row.Count
+	}
+	for i := range cols {
+		cols[i].Count = byID[cols[i].ID]
+	}
+	return cols, nil
+}
+
+func (r *MongoCollectionRepo) Update(ctx context.Context, id primitive.ObjectID, updates bson.M) error {
+	_, err := r.db.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": updates})
+	return err
+}
+
+func (r *MongoCollectionRepo) Delete(ctx context.Context, id primitive.ObjectID) error {
+	// Primero los items: si falla a la mitad queda la colección y se puede reintentar
+	if _, err := r.items.DeleteMany(ctx, bson.M{"collection_id": id}); err != nil {
+		return err
+	}
+	_, err := r.db.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (r *MongoCollectionRepo) SetPositions(ctx context.Context, positions map[primitive.ObjectID]float64) error {
+	models := make([]mongo.WriteModel, 0, len(positions))
+	for id, pos := range positions {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": id}).
+			SetUpdate(bson.M{"$set": bson.M{"position": pos}}))
+	}
+	if len(models) == 0 {
+		return nil
+	}
+	_, err := r.db.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (r *MongoCollectionRepo) AddItem(ctx context.Context, item *domain.CollectionItem) error {
+	_, err := r.items.InsertOne(ctx, item)
+	if mongo.IsDuplicateKeyError(err) {
+		return domain.ErrDuplicate // índice único {collection_id, manga_id}
+	}
+	return err
+}
+
+func (r *MongoCollectionRepo) RemoveItem(ctx context.Context, collectionID, mangaID primitive.ObjectID) (bool, error) {
+	res, err := r.items.DeleteOne(ctx, bson.M{"collection_id": collectionID, "manga_id": mangaID})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
+
+func (r *MongoCollectionRepo) Items(ctx context.Context, collectionID primitive.ObjectID) ([]domain.CollectionItem, error) {
+	items := []domain.CollectionItem{}
+	opts := options.Find().SetSort(bson.D{{Key: "position", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.items.Find(ctx, bson.M{"collection_id": collectionID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// positions va por manga_id dentro de la colección
+func (r *MongoCollectionRepo) SetItemPositions(ctx context.Context, collectionID primitive.ObjectID, positions map[primitive.ObjectID]float64) error {
+	models := make([]mongo.WriteModel, 0, len(positions))
+	for mangaID, pos := range positions {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"collection_id": collectionID, "manga_id": mangaID}).
+			SetUpdate(bson.M{"$set": bson.M{"position": pos}}))
+	}
+	if len(models) == 0 {
+		return nil
+	}
+	_, err := r.items.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (r *MongoCollectionRepo) CollectionsOf(ctx context.Context, mangaID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	var items []domain.CollectionItem
+	cursor, err := r.items.Find(ctx, bson.M{"manga_id": mangaID}, options.Find().SetProjection(bson.M{"collection_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(items))
+	for i, it := range items {
+		ids[i] = it.CollectionID
+	}
+	return ids, nil
+}
+
+func (r *MongoCollectionRepo) RemoveManga(ctx context.Context, mangaID primitive.ObjectID) error {
+	_, err := r.items.DeleteMany(ctx, bson.M{"manga_id": mangaID})
+	return err
+}
+
+func (r *MongoCollectionRepo) RemoveUserItems(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.items.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"view-list/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoImageRefRepo struct {
+	db *mongo.Collection
+}
+
+func NewImageRefRepo(db *mongo.Database) domain.ImageRefRepo {
+	return &MongoImageRefRepo{db: db.Collection("image_refs")}
+}
+
+func (r *MongoImageRefRepo) Acquire(ctx context.Context, key, userID string) (*domain.ImageRef, error) {
+	now := time.Now()
+	update := bson.M{
+		"$inc":         bson.M{"refs": 1},
+		"$set":         bson.M{"updated_at": now},
+		"$setOnInsert": bson.M{"user_id": userID, "size": 0, "has_variants": false, "pending": true, "created_at": now},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var ref domain.ImageRef
+	if err := r.db.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&ref); err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
+
+func (r *MongoImageRefRepo) Release(ctx context.Context, key string) (*domain.ImageRef, bool, error) {
+	update := bson.M{"$inc": bson.M{"refs": -1}, "$set": bson.M{"updated_at": time.Now()}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var ref domain.ImageRef
+	err := r.db.FindOneAndUpdate(ctx, bson.M{"_id": key, "refs": bson.M{"$gt": 0}}, update, opts).Decode(&ref)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// Sin conteo no hay forma de saber si alguien más la usa: no se borra.
+		// Si quedó huérfana la levanta el GC de uploads (o recalc-storage arma el conteo).
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if ref.Refs > 0 {
+		return &ref, false, nil
+	}
+
+	// Solo borra si nadie la volvió a tomar entre medio
+	res, err := r.db.DeleteOne(ctx, bson.M{"_id": key, "refs": bson.M{"$lte": 0}})
+	if err != nil {
+		return nil, false, err
+	}
+	return &ref, res.DeletedCount == 1, nil
+}
+
+func (r *MongoImageRefRepo) SetVariants(ctx context.Context, key string, size int64, skipped []string) (*domain.ImageRef, error) {
+	update := bson.M{"$set": bson.M{"has_variants": true, "skipped_variants": skipped, "size": size, "updated_at": time.Now()}}
+
+	var prev domain.ImageRef
+	err := r.db.FindOneAndUpdate(ctx, bson.M{"_id": key}, update).Decode(&prev)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &prev, nil
+}
+
+func (r *MongoImageRefRepo) Remove(ctx context.Context, key string) (*domain.ImageRef, error) {
+	var ref domain.ImageRef
+	err := r.db.FindOneAndDelete(ctx, bson.M{"_id": key}).Decode(&ref)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
+
+func (r *MongoImageRefRepo) Get(ctx context.Context, key string) (*domain.ImageRef, error) {
+	var ref domain.ImageRef
+	err := r.db.FindOne(ctx, bson.M{"_id": key}).Decode(&ref)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
+
+// Nadie la tiene, o el que la tenía se colgó
+func claimable(token string, staleBefore time.Time) bson.A {
+	return bson.A{
+		bson.M{"writer": bson.M{"$exists": false}},
+		bson.M{"writer": token},
+		bson.M{"writing_at": bson.M{"$lt": staleBefore}},
+	}
+}
+
+func (r *MongoImageRefRepo) ClaimWrite(ctx context.Context, key, token string, staleBefore time.Time) (bool, error) {
+	filter := bson.M{"_id": key, "pending": true, "$or": claimable(token, staleBefore)}
+	res, err := r.db.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"writer": token, "writing_at": time.Now()}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+func (r *MongoImageRefRepo) FinishWrite(ctx context.Context, key, token string, size int64, hasVariants bool, skipped []string) (*domain.ImageRef, error) {
+	update := bson.M{
+		"$set":   bson.M{"size": size, "has_variants": hasVariants, "skipped_variants": skipped, "updated_at": time.Now()},
+		"$unset": bson.M{"pending": "", "writer": "", "writing_at": ""},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var ref domain.ImageRef
+	err := r.db.FindOneAndUpdate(ctx, bson.M{"_id": key, "writer": token}, update, opts).Decode(&ref)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("write of %s was taken over by another writer", key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
+
+func (r *MongoImageRefRepo) AbortWrite(ctx context.Context, key, token string) error {
+	_, err := r.db.UpdateOne(ctx, bson.M{"_id": key, "writer": token}, bson.M{"$unset": bson.M{"writer": "", "writing_at": ""}})
+	return err
+}
+
+func (r *MongoImageRefRepo) ClaimDelete(ctx context.Context, key, userID, token string, staleBefore time.Time) (bool, error) {
+	now := time.Now()
+	// Sin registro (lo normal después de soltar la última referencia): lo creo como marca del borrado
+	_, err := r.db.InsertOne(ctx, bson.M{
+		"_id": key, "user_id": userID, "size": 0, "refs": 0, "has_variants": false,
+		"pending": true, "writer": token, "writing_at": now, "created_at": now, "updated_at": now,
+	})
+	if err == nil {
+		return true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return false, err
+	}
+
+	// Ya hay registro: solo si sigue sin referencias (ej: un reintento de este mismo borrado)
+	filter := bson.M{"_id": key, "refs": bson.M{"$lte": 0}, "$or": claimable(token, staleBefore)}
+	res, err := r.db.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"pending": true, "writer": token, "writing_at": now}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+func (r *MongoImageRefRepo) FinishDelete(ctx context.Context, key, token string) error {
+	res, err := r.db.DeleteOne(ctx, bson.M{"_id": key, "writer": token, "refs": bson.M{"$lte": 0}})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 1 {
+		return nil
+	}
+	// La tomó un guardado mientras se borraba: queda pendiente para que la escriba
+	return r.AbortWrite(ctx, key, token)
+}
+
+func (r *MongoImageRefRepo) List(ctx context.Context) ([]domain.ImageRef, error) {
+	cursor, err := r.db.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var refs []domain.ImageRef
+	if err := cursor.All(ctx, &refs); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+func (r *MongoImageRefRepo) Upsert(ctx context.Context, ref *domain.ImageRef) error {
+	_, err := r.db.ReplaceOne(ctx, bson.M{"_id": ref.Key}, ref, options.Replace().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"view-list/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoJobRepo struct {
+	db *mongo.Collection
+}
+
+func NewJobRepo(db *mongo.Database) domain.JobRepo {
+	return &MongoJobRepo{db: db.Collection("jobs")}
+}
+
+func (r *MongoJobRepo) Create(ctx context.Context, job *domain.Job) error {
+	_, err := r.db.InsertOne(ctx, job)
+	return err
+}
+
+func (r *MongoJobRepo) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.Job, error) {
+	var job domain.Job
+	if err := r.db.FindOne(ctx, bson.M{"_id": id}).Decode(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Devuelve nil, nil si no hay nada para correr
+func (r *MongoJobRepo) ClaimNext(ctx context.Context, now time.Time, lease time.Duration) (*domain.Job, error) {
+	filter := bson.M{"$or": []bson.M{
+		{"status": domain.JobStatusPending, "run_at": bson.M{"$lte": now}},
+		// El proceso murió con el job tomado
+		{"status": domain.JobStatusRunning, "locked_until": bson.M{"$lt": now}},
+	}}
+	// Update con pipeline para que sea atómico: solo cuenta como intento si venía de pending.
+	// Retomar un lock vencido no es un fallo del job (se cayó el proceso), igual que en Release.
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"status":       domain.JobStatusRunning,
+		"locked_until": now.Add(lease),
+		"lease_owner":  primitive.NewObjectID().Hex(),
+		"updated_at":   now,
+		"attempts": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$status", domain.JobStatusPending}},
+			bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$attempts", 0}}, 1}},
+			"$attempts",
+		}},
+	}}}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.M{"run_at": 1}).
+		SetReturnDocument(options.After)
+
+	var job domain.Job
+	err := r.db.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Solo el que tiene el lock: si venció y el job lo retomó otro, el resultado de este ya no cuenta
+func leased(id primitive.ObjectID, owner string) bson.M {
+	return bson.M{"_id": id, "status": domain.JobStatusRunning, "lease_owner": owner}
+}
+
+func leaseResult(res *mongo.UpdateResult, err error) error {
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return domain.ErrLeaseLost
+	}
+	return nil
+}
+
+func (r *MongoJobRepo) Complete(ctx context.Context, id primitive.ObjectID, owner string, result map[string]string) error {
+	return leaseResult(r.db.UpdateOne(ctx, leased(id, owner), bson.M{
+		"$set": bson.M{
+			"status":     domain.JobStatusDone,
+			"result":     result,
+			"last_error": "",
+			"updated_at": time.Now(),
+		},
+		"$unset": bson.M{"lease_owner": ""},
+	}))
+}
+
+func (r *MongoJobRepo) Fail(ctx context.Context, id primitive.ObjectID, owner, errMsg string, runAt time.Time, dead bool) error {
+	status := domain.JobStatusPending
+	if dead {
+		status = domain.JobStatusDead
+	}
+	return leaseResult(r.db.UpdateOne(ctx, leased(id, owner), bson.M{
+		"$set": bson.M{
+			"status":     status,
+			"last_error": errMsg,
+			"run_at":     runAt,
+			"updated_at": time.Now(),
+		},
+		"$unset": bson.M{"lease_owner": ""},
+	}))
+}
+
+func (r *MongoJobRepo) Release(ctx context.Context, id primitive.ObjectID, owner string) error {
+	return leaseResult(r.db.UpdateOne(ctx, leased(id, owner), bson.M{
+		"$set":   bson.M{"status": domain.JobStatusPending, "updated_at": time.Now()},
+		"$inc":   bson.M{"attempts": -1},
+		"$unset": bson.M{"lease_owner": ""},
+	}))
+}
+
+// Los más recientes primero. status vacío trae todos
+func (r *MongoJobRepo) List(ctx context.Context, status domain.JobStatus, limit int64) ([]domain.Job, error) {
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(limit)
+
+	var jobs []domain.Job
+	cursor, err := r.db.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
@@ -32,20 +32,14 @@ func (r *MongoMangaRepo) GetByID(ctx context.Context, id primitive.ObjectID) (*d
 }
 
 // Esto trae por user_id mediante jwt, no me trae todos,
-func (r *MongoMangaRepo) List(ctx context.Context, userID primitive.ObjectID, state, search string) ([]domain.Manga, error) {
+// La búsqueda por texto no pasa por acá: se rankea en service (ver internal/search)
+func (r *MongoMangaRepo) List(ctx context.Context, userID primitive.ObjectID, state string) ([]domain.Manga, error) {
 	filter := bson.M{"user_id": userID}
 
 	if state != "" {
 		filter["state"] = state
 	}
 
-	if search != "" {
-		filter["name"] = bson.M{
-			"$regex":   search,
-			"$options": "i", // quito el case sensitive
-		}
-	}
-
 	// Ordenar por fecha (descendente, más recientes primero)
 	opts := options.Find().SetSort(bson.M{"updated_at": -1})
 
@@ -85,3 +79,67 @@ func (r *MongoMangaRepo) BulkInsert(ctx context.Context, mangas []domain.Manga)
 	_, err := r.db.InsertMany(ctx, docs)
 	return err
 }
+
+// Solo los del usuario; los IDs que no existen o son de otro se ignoran
+func (r *MongoMangaRepo) GetByIDs(ctx context.Context, userID primitive.ObjectID, ids []primitive.ObjectID) ([]domain.Manga, error) {
+	mangas := []domain.Manga{}
+	if len(ids) == 0 {
+		return mangas, nil
+	}
+	cursor, err := r.db.Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &mangas); err != nil {
+		return nil, err
+	}
+	return mangas, nil
+}
+
+func (r *MongoMangaRepo) CountByState(ctx context.Context, userID primitive.ObjectID) (map[domain.MangaState]int, error) {
+	cursor, err := r.db.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID}}},
+		{{Key: "$group", Value: bson.M{"_id": "$state", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		State domain.MangaState `bson:"_id"`
+		Count int               `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	counts := make(map[domain.MangaState]int, len(rows))
+	for _, row := range rows {
+		counts[row.State] = row.Count
+	}
+	return counts, nil
+}
+
+func (r *MongoMangaRepo) ReassignState(ctx context.Context, userID primitive.ObjectID, from, to domain.MangaState) (int64, error) {
+	res, err := r.db.UpdateMany(ctx, bson.M{"user_id": userID, "state": from}, bson.M{"$set": bson.M{"state": to}})
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// Lo usa el recolector de uploads huérfanos, trae solo lo necesario de todos los usuarios
+func (r *MongoMangaRepo) ListWithImage(ctx context.Context) ([]domain.Manga, error) {
+	filter := bson.M{"image": bson.M{"$nin": []any{"", nil}}}
+	opts := options.Find().SetProjection(bson.M{"_id": 1, "user_id": 1, "image": 1, "variants": 1})
+
+	var mangas []domain.Manga
+	cursor, err := r.db.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &mangas); err != nil {
+		return nil, err
+	}
+	return mangas, nil
+}
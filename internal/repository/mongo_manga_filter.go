@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"view-list/internal/domain"
+	"view-list/internal/query"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var mangaFields = map[query.Field]string{
+	query.FieldKind:    "kind",
+	query.FieldState:   "state",
+	query.FieldGenre:   "genre",
+	query.FieldChapter: "chapter",
+	query.FieldScore:   "score",
+	query.FieldCreated: "created_at",
+	query.FieldUpdated: "updated_at",
+	query.FieldLink:    "link",
+	query.FieldImage:   "image",
+	query.FieldReview:  "review",
+
+	query.FieldType:        "type",
+	query.FieldDemographic: "demographic",
+	query.FieldLanguage:    "original_language",
+	query.FieldYear:        "start_year",
+}
+
+// $avg ignora los null: así los sin puntaje (0 o ausente) no bajan el promedio
+var scoredOrNull = bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$score", 0}}, "$score", nil}}
+
+// Sin distinguir mayúsculas ni acentos en los campos de texto ("Acción" == "accion")
+var filterCollation = &options.Collation{Locale: "es", Strength: 1}
+
+// Filter trae los mangas del usuario que cumplen el filtro, más recientes primero. La búsqueda
+// libre (query.Text) no se aplica: donde aparece el filtro se relaja, así que puede traer de más
+// y el que llama tiene que terminar de filtrar.
+func (r *MongoMangaRepo) Filter(ctx context.Context, userID primitive.ObjectID, f query.Node) ([]domain.Manga, error) {
+	opts := options.Find().SetSort(bson.M{"updated_at": -1}).SetCollation(filterCollation)
+
+	var mangas []domain.Manga
+	cursor, err := r.db.Find(ctx, userFilter(userID, f), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &mangas); err != nil {
+		return nil, err
+	}
+	return mangas, nil
+}
+
+// FilterFacets hace lo mismo que Filter en un solo aggregate: $facet arma los resultados y los
+// conteos. Los estados se cuentan sin las condiciones de estado, así cada pestaña muestra cuántos
+// tendría aunque haya otra elegida; el resto se cuenta sobre el filtro completo.
+// Con búsqueda libre los conteos también incluyen de más.
+// Todo vuelve en un documento, así que vale para listas de un usuario (límite de 16MB).
+func (r *MongoMangaRepo) FilterFacets(ctx context.Context, userID primitive.ObjectID, f query.Node) ([]domain.Manga, *domain.Facets, error) {
+	// El $match de afuera es el más amplio; dentro de cada faceta se termina de filtrar
+	selected := bson.M{"$match": bson.M{}}
+	if f != nil {
+		selected = bson.M{"$match": filterToBSON(f)}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: userFilter(userID, query.Without(f, query.FieldState))}},
+		{{Key: "$facet", Value: bson.M{
+			"results": bson.A{selected, bson.M{"$sort": bson.M{"updated_at": -1}}},
+			"states":  bson.A{bson.M{"$group": bson.M{"_id": "$state", "count": bson.M{"$sum": 1}}}},
+			"kinds":   bson.A{selected, bson.M{"$group": bson.M{"_id": bson.M{"$ifNull": bson.A{"$kind", domain.KindManga}}, "count": bson.M{"$sum": 1}}}},
+			"scores": bson.A{
+				selected,
+				bson.M{"$match": bson.M{"score": bson.M{"$gt": 0}}},
+				bson.M{"$group": bson.M{"_id": nil, "avg": bson.M{"$avg": "$score"}, "count": bson.M{"$sum": 1}}},
+			},
+			"genres": bson.A{
+				selected,
+				bson.M{"$unwind": "$genre"},
+				bson.M{"$group": bson.M{"_id": "$genre", "count": bson.M{"$sum": 1}, "avg_score": bson.M{"$avg": scoredOrNull}}},
+				bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+			},
+		}}},
+	}
+
+	cursor, err := r.db.Aggregate(ctx, pipeline, options.Aggregate().SetCollation(filterCollation))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var out []struct {
+		Results []domain.Manga `bson:"results"`
+		States  []struct {
+			State domain.MangaState `bson:"_id"`
+			Count int               `bson:"count"`
+		} `bson:"states"`
+		Kinds []struct {
+			Kind  domain.MediaKind `bson:"_id"`
+			Count int              `bson:"count"`
+		} `bson:"kinds"`
+		Scores []struct {
+			Avg   float64 `bson:"avg"`
+			Count int     `bson:"count"`
+		} `bson:"scores"`
+		Genres []domain.GenreCount `bson:"genres"`
+	}
+	if err := cursor.All(ctx, &out); err != nil {
+		return nil, nil, err
+	}
+
+	facets := domain.NewFacets()
+	if len(out) == 0 {
+		return []domain.Manga{}, facets, nil
+	}
+	for _, s := range out[0].States {
+		facets.States[s.State] = s.Count
+	}
+	for _, k := range out[0].Kinds {
+		facets.Kinds[k.Kind] = k.Count
+	}
+	if len(out[0].Scores) > 0 {
+		facets.AvgScore = &out[0].Scores[0].Avg
+		facets.Scored = out[0].Scores[0].Count
+	}
+	facets.Genres = append(facets.Genres, out[0].Genres...)
+	return out[0].Results, facets, nil
+}
+
+func userFilter(userID primitive.ObjectID, f query.Node) bson.M {
+	filter := bson.M{"user_id": userID}
+	if f != nil {
+		if cond := filterToBSON(f); len(cond) > 0 {
+			filter = bson.M{"$and": bson.A{filter, cond}}
+		}
+	}
+	return filter
+}
+
+// Un bson.M vacío matchea todo. Los nodos con texto libre se cambian por eso (también
+// negados), así el resultado siempre incluye a los que cumplen el filtro completo.
+func filterToBSON(n query.Node) bson.M {
+	switch v := n.(type) {
+	case query.And:
+		parts := bson.A{}
+		for _, c := range v.Nodes {
+			if m := filterToBSON(c); len(m) > 0 {
+				parts = append(parts, m)
+			}
+		}
+		switch len(parts) {
+		case 0:
+			return bson.M{}
+		case 1:
+			return parts[0].(bson.M)
+		}
+		return bson.M{"$and": parts}
+
+	case query.Or:
+		parts := bson.A{}
+		for _, c := range v.Nodes {
+			m := filterToBSON(c)
+			if len(m) == 0 {
+				return bson.M{} // una rama que matchea todo hace que el OR matchee todo
+			}
+			parts = append(parts, m)
+		}
+		return bson.M{"$or": parts}
+
+	case query.Not:
+		if query.HasText(v.Node) {
+			return bson.M{}
+		}
+		return bson.M{"$nor": bson.A{filterToBSON(v.Node)}}
+
+	case query.Cond:
+		return condToBSON(v)
+	}
+	return bson.M{} // query.Text
+}
+
+func condToBSON(c query.Cond) bson.M {
+	if c.Field == query.FieldAuthor {
+		// Autor vale tanto para guion como para dibujo
+		return bson.M{"$or": bson.A{bson.M{"authors": bson.M{"$in": c.Strings}}, bson.M{"artists": bson.M{"$in": c.Strings}}}}
+	}
+	field := mangaFields[c.Field]
+	switch c.Op {
+	case query.OpIn:
+		if c.Field == query.FieldKind && slices.Contains(c.Strings, string(domain.KindManga)) {
+			// Los documentos sin kind son mangas (por si la migración media_kind todavía no corrió)
+			return bson.M{field: bson.M{"$in": append(bson.A{nil}, toA(c.Strings)...)}}
+		}
+		return bson.M{field: bson.M{"$in": c.Strings}}
+	case query.OpAll:
+		return bson.M{field: bson.M{"$all": c.Strings}}
+	case query.OpExists:
+		if c.Field == query.FieldScore {
+			return bson.M{field: bson.M{"$gt": 0}}
+		}
+		return bson.M{field: bson.M{"$nin": bson.A{"", nil}}}
+	}
+
+	var value any = c.Number
+	if c.Field == query.FieldCreated || c.Field == query.FieldUpdated {
+		value = c.Time
+	}
+	ops := map[query.Op]string{query.OpEq: "$eq", query.OpLt: "$lt", query.OpLte: "$lte", query.OpGt: "$gt", query.OpGte: "$gte"}
+	if c.Field == query.FieldScore || c.Field == query.FieldYear {
+		// Sin dato (0 o ausente) no cumple ninguna comparación: score<5 no trae los sin puntaje
+		return bson.M{"$and": bson.A{bson.M{field: bson.M{"$gt": 0}}, bson.M{field: bson.M{ops[c.Op]: value}}}}
+	}
+	return bson.M{field: bson.M{ops[c.Op]: value}}
+}
+
+func toA(values []string) bson.A {
+	a := make(bson.A, len(values))
+	for i, v := range values {
+		a[i] = v
+	}
+	return a
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"view-list/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoSmartListRepo struct {
+	db *mongo.Collection
+}
+
+func NewSmartListRepo(db *mongo.Database) domain.SmartListRepo {
+	return &MongoSmartListRepo{db: db.Collection("smart_lists")}
+}
+
+func (r *MongoSmartListRepo) Create(ctx context.Context, list *domain.SmartList) error {
+	_, err := r.db.InsertOne(ctx, list)
+	return err
+}
+
+func (r *MongoSmartListRepo) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.SmartList, error) {
+	var list domain.SmartList
+	if err := r.db.FindOne(ctx, bson.M{"_id": id}).Decode(&list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+func (r *MongoSmartListRepo) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]domain.SmartList, error) {
+	opts := options.Find().SetSort(bson.M{"name": 1})
+
+	lists := []domain.SmartList{}
+	cursor, err := r.db.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &lists); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+func (r *MongoSmartListRepo) CountByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return r.db.CountDocuments(ctx, bson.M{"user_id": userID})
+}
+
+func (r *MongoSmartListRepo) Update(ctx context.Context, id primitive.ObjectID, updates bson.M) error {
+	_, err := r.db.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": updates})
+	return err
+}
+
+func (r *MongoSmartListRepo) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.db.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
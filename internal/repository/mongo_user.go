@@ -19,6 +19,9 @@ func NewUserRepo(db *mongo.Database) domain.UserRepo {
 
 func (r *MongoUserRepo) Create(ctx context.Context, user *domain.User) error {
 	_, err := r.collection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return domain.ErrDuplicate // índice único de email
+	}
 	return err
 }
 
@@ -41,3 +44,48 @@ func (r *MongoUserRepo) GetByID(ctx context.Context, id primitive.ObjectID) (*do
 
 	return &u, nil
 }
+
+func (r *MongoUserRepo) AddStorageUsed(ctx context.Context, id primitive.ObjectID, delta, limit int64) (bool, error) {
+	filter := bson.M{"_id": id}
+	if delta > 0 && limit > 0 {
+		if delta > limit {
+			return false, nil
+		}
+		// Los usuarios viejos no tienen el campo: cuentan como 0
+		filter["$or"] = bson.A{
+			bson.M{"storage_used": bson.M{"$lte": limit - delta}},
+			bson.M{"storage_used": bson.M{"$exists": false}},
+		}
+	}
+
+	// Nunca por debajo de 0, aunque el contador esté desfasado
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"storage_used": bson.M{"$max": bson.A{0, bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$storage_used", 0}}, delta}}}},
+	}}}}
+
+	res, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+func (r *MongoUserRepo) SetStorageUsed(ctx context.Context, id primitive.ObjectID, bytes int64) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"storage_used": bytes}})
+	return err
+}
+
+func (r *MongoUserRepo) SetStates(ctx context.Context, id primitive.ObjectID, states []domain.ReadingState) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"states": states}})
+	return err
+}
+
+func (r *MongoUserRepo) SetScoreScale(ctx context.Context, id primitive.ObjectID, scale domain.ScoreScale) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"score_scale": scale}})
+	return err
+}
+
+func (r *MongoUserRepo) ResetStorageUsed(ctx context.Context) error {
+	_, err := r.collection.UpdateMany(ctx, bson.M{}, bson.M{"$set": bson.M{"storage_used": int64(0)}})
+	return err
+}
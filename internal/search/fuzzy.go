@@ -0,0 +1,74 @@
+package search
+
+// Levenshtein devuelve la distancia de edición entre a y b, o max+1 si se pasa de max
+// (corta antes, así comparar contra una descripción larga no cuesta de más).
+func Levenshtein(a, b []rune, max int) int {
+	if abs(len(a)-len(b)) > max {
+		return max + 1
+	}
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// Trigrams de la palabra con bordes (" ab", "abc", "bc ") para que el inicio y el final pesen
+func Trigrams(word string) map[string]struct{} {
+	r := []rune(" " + word + " ")
+	out := make(map[string]struct{}, len(r))
+	for i := 0; i+3 <= len(r); i++ {
+		out[string(r[i:i+3])] = struct{}{}
+	}
+	return out
+}
+
+// Similarity es el coeficiente de Jaccard entre los trigramas (0 a 1)
+func Similarity(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for g := range a {
+		if _, ok := b[g]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// Errores de tipeo que se toleran según el largo de la palabra buscada
+func maxEdits(length int) int {
+	switch {
+	case length <= 3:
+		return 0
+	case length <= 7:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
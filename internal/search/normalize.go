@@ -0,0 +1,31 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize pasa a minúsculas y saca los acentos y diacríticos ("Pokémon" -> "pokemon").
+// Todo lo que no es letra o número queda como espacio.
+func Normalize(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range norm.NFD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// marca combinante (tilde, diéresis...): se descarta
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteByte(' ')
+		}
+	}
+	return b.String()
+}
+
+// Tokens normaliza y separa en palabras
+func Tokens(s string) []string {
+	return strings.Fields(Normalize(s))
+}
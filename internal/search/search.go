@@ -0,0 +1,121 @@
+package search
+
+import "strings"
+
+const (
+	maxQueryLen    = 200 // caracteres; el resto se ignora
+	maxQueryTokens = 8
+	minTrigramSim  = 0.45
+)
+
+// Field es un texto donde buscar con su peso (ej: el nombre pesa más que la descripción)
+type Field struct {
+	Text   string
+	Weight float64
+}
+
+type term struct {
+	word  string
+	runes []rune
+	grams map[string]struct{}
+}
+
+// Query es una búsqueda ya normalizada, lista para comparar contra muchos documentos.
+// El texto del usuario nunca llega a Mongo: se compara acá, así no hay regex ni operadores que inyectar.
+type Query struct {
+	phrase string
+	terms  []term
+}
+
+func Parse(raw string) *Query {
+	if r := []rune(raw); len(r) > maxQueryLen {
+		raw = string(r[:maxQueryLen])
+	}
+	words := Tokens(raw)
+	if len(words) > maxQueryTokens {
+		words = words[:maxQueryTokens]
+	}
+	q := &Query{phrase: strings.Join(words, " ")}
+	for _, w := range words {
+		q.terms = append(q.terms, term{word: w, runes: []rune(w), grams: Trigrams(w)})
+	}
+	return q
+}
+
+func (q *Query) Empty() bool { return len(q.terms) == 0 }
+
+// Score devuelve la relevancia del documento (0 = no coincide). Cada palabra buscada tiene
+// que aparecer en algún campo, exacta, como prefijo o con errores de tipeo.
+func (q *Query) Score(fields []Field) float64 {
+	if q.Empty() {
+		return 0
+	}
+
+	type normField struct {
+		text   string
+		words  []string
+		weight float64
+	}
+	norm := make([]normField, 0, len(fields))
+	for _, f := range fields {
+		if f.Text == "" {
+			continue
+		}
+		words := Tokens(f.Text)
+		norm = append(norm, normField{text: " " + strings.Join(words, " ") + " ", words: words, weight: f.Weight})
+	}
+
+	total := 0.0
+	for _, t := range q.terms {
+		best := 0.0
+		for _, f := range norm {
+			for _, w := range f.words {
+				if s := matchWord(t, w) * f.weight; s > best {
+					best = s
+				}
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+		total += best
+	}
+
+	// La frase completa tal cual suma, más si es el comienzo del campo
+	if len(q.terms) > 1 {
+		for _, f := range norm {
+			if i := strings.Index(f.text, " "+q.phrase+" "); i >= 0 {
+				bonus := f.weight
+				if i == 0 {
+					bonus *= 1.5
+				}
+				total += bonus
+				break
+			}
+		}
+	}
+	return total / float64(len(q.terms))
+}
+
+// 1 exacta, 0.9 prefijo, después errores de tipeo (Levenshtein) y por último trigramas
+func matchWord(t term, word string) float64 {
+	if word == t.word {
+		return 1
+	}
+	if len(t.runes) >= 2 && strings.HasPrefix(word, t.word) {
+		return 0.9
+	}
+
+	runes := []rune(word)
+	if edits := maxEdits(len(t.runes)); edits > 0 {
+		if d := Levenshtein(t.runes, runes, edits); d <= edits {
+			return 0.8 - 0.15*float64(d-1)
+		}
+	}
+	if len(t.runes) >= 4 {
+		if sim := Similarity(t.grams, Trigrams(word)); sim >= minTrigramSim {
+			return 0.6 * sim
+		}
+	}
+	return 0
+}
@@ -0,0 +1,129 @@
+package search
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"Pokémon":              "pokemon",
+		"ÑANDÚ":                "nandu",
+		"Re:Zero − Kara":       "re zero   kara",
+		"Shingeki no Kyojin 2": "shingeki no kyojin 2",
+	}
+	for in, want := range tests {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := Tokens("  Spy×Family: Code White "); !reflect.DeepEqual(got, []string{"spy", "family", "code", "white"}) {
+		t.Errorf("Tokens = %q", got)
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		max  int
+		want int
+	}{
+		{"naruto", "naruto", 2, 0},
+		{"naruto", "narutp", 2, 1},
+		{"naruto", "nartuo", 2, 2},
+		{"berserk", "bersek", 2, 1},
+		{"kitten", "sitting", 3, 3},
+		{"kitten", "sitting", 2, 3}, // se pasa: max+1
+		{"a", "abcdef", 2, 3},       // solo por el largo ya se pasa
+		{"", "abc", 5, 3},
+	}
+	for _, tt := range tests {
+		if got := Levenshtein([]rune(tt.a), []rune(tt.b), tt.max); got != tt.want {
+			t.Errorf("Levenshtein(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	if got := Similarity(Trigrams("berserk"), Trigrams("berserk")); got != 1 {
+		t.Errorf("same word: %v", got)
+	}
+	if got := Similarity(Trigrams("berserk"), Trigrams("naruto")); got != 0 {
+		t.Errorf("unrelated words: %v", got)
+	}
+	if got := Similarity(Trigrams("abc"), map[string]struct{}{}); got != 0 {
+		t.Errorf("empty: %v", got)
+	}
+}
+
+func TestMatchWord(t *testing.T) {
+	tests := []struct {
+		query, word string
+		want        float64
+	}{
+		{"naruto", "naruto", 1},
+		{"nar", "naruto", 0.9},    // prefijo
+		{"n", "naruto", 0},        // un solo carácter no alcanza para prefijo
+		{"narutp", "naruto", 0.8}, // 1 error
+		{"frieren", "frirren", 0.8},
+		{"shingeki", "shingkei", 0.65}, // 2 errores en una palabra larga
+		{"one", "ono", 0},              // palabras cortas: sin errores
+		{"kimetsu", "naruto", 0},
+	}
+	for _, tt := range tests {
+		q := Parse(tt.query)
+		if got := matchWord(q.terms[0], tt.word); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("matchWord(%q, %q) = %v, want %v", tt.query, tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	fields := func(name, description string) []Field {
+		return []Field{{Text: name, Weight: 3}, {Text: description, Weight: 1}}
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		fields []Field
+		want   float64
+	}{
+		{"exact name", "berserk", fields("Berserk", ""), 3},
+		{"accents and case", "pokemon", fields("POKÉMON Adventures", ""), 3},
+		{"only in description", "berserk", fields("Other", "like berserk"), 1},
+		{"best field wins", "berserk", fields("Berserk", "berserk"), 3},
+		{"every word must match", "one piece", fields("One Punch Man", ""), 0},
+		// (3 + 3) / 2 palabras + frase al comienzo del nombre (3 * 1.5) / 2
+		{"phrase at the start", "one piece", fields("One Piece", ""), (3 + 3 + 4.5) / 2},
+		{"phrase in the middle", "piece film", fields("One Piece Film Red", ""), (3.0 + 3 + 3) / 2},
+		{"words apart", "one red", fields("One Piece Film Red", ""), 3},
+		{"typo", "berserc", fields("Berserk", ""), 3 * 0.8},
+		{"no match", "naruto", fields("Bleach", "shinigami"), 0},
+		{"empty query", "", fields("Bleach", ""), 0},
+		{"empty fields", "bleach", fields("", ""), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.query).Score(tt.fields); math.Abs(got-tt.want) > 1e-9 {
+				t.Fatalf("Score(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	q := Parse(strings.Repeat("word ", 20))
+	if len(q.terms) != maxQueryTokens {
+		t.Errorf("terms = %d, want %d", len(q.terms), maxQueryTokens)
+	}
+	q = Parse(strings.Repeat("a", maxQueryLen+50))
+	if len(q.terms) != 1 || len(q.terms[0].runes) != maxQueryLen {
+		t.Errorf("long query not truncated to %d runes", maxQueryLen)
+	}
+	if !Parse(" ¿? ").Empty() {
+		t.Error("punctuation only should be an empty query")
+	}
+}
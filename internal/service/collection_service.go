@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"view-list/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxCollections        = 200 // por usuario
+	maxCollectionItems    = 10000
+	maxCollectionName     = 100
+	maxCollectionDescribe = 1000
+)
+
+var (
+	ErrCollectionNotFound  = errors.New("Collection not found")
+	ErrInvalidCollection   = errors.New("Invalid collection")
+	ErrAlreadyInCollection = errors.New("Manga is already in the collection")
+	ErrNotInCollection     = errors.New("Manga is not in the collection")
+)
+
+type CollectionInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type CollectionService struct {
+	repo   domain.CollectionRepo
+	mangas *MangaService
+}
+
+func NewCollectionService(repo domain.CollectionRepo, mangas *MangaService) *CollectionService {
+	return &CollectionService{repo: repo, mangas: mangas}
+}
+
+func (s *CollectionService) List(ctx context.Context, userID string) ([]domain.Collection, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListByUser(ctx, objID)
+}
+
+// Get trae la colección solo si es del usuario; si no, responde como si no existiera
+func (s *CollectionService) Get(ctx context.Context, id primitive.ObjectID, userID string) (*domain.Collection, error) {
+	c, err := s.repo.GetByID(ctx, id)
+	if err != nil || c.UserID.Hex() != userID {
+		return nil, ErrCollectionNotFound
+	}
+	return c, nil
+}
+
+// Create la agrega al final
+func (s *CollectionService) Create(ctx context.Context, userID string, in CollectionInput) (*domain.Collection, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateCollection(&in); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.ListByUser(ctx, objID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxCollections {
+		return nil, fmt.Errorf("%w: limit of %d collections reached", ErrInvalidCollection, maxCollections)
+	}
+	position := positionStep
+	if n := len(existing); n > 0 {
+		position = existing[n-1].Position + positionStep
+	}
+
+	now := time.Now()
+	c := &domain.Collection{
+		ID:          primitive.NewObjectID(),
+		UserID:      objID,
+		Name:        in.Name,
+		Description: in.Description,
+		Position:    position,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.repo.Create(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *CollectionService) Update(ctx context.Context, id primitive.ObjectID, userID string, in CollectionInput) (*domain.Collection, error) {
+	c, err := s.Get(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateCollection(&in); err != nil {
+		return nil, err
+	}
+
+	c.Name, c.Description, c.UpdatedAt = in.Name, in.Description, time.Now()
+	if err := s.repo.Update(ctx, id, bson.M{"name": c.Name, "description": c.Description, "updated_at": c.UpdatedAt}); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Delete borra la colección y sus pertenencias; los mangas quedan
+func (s *CollectionService) Delete(ctx context.Context, id primitive.ObjectID, userID string) error {
+	if _, err := s.Get(ctx, id, userID); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, id)
+}
+
+// Move pone la colección después de after (vacío = primera)
+func (s *CollectionService) Move(ctx context.Context, id primitive.ObjectID, userID, after string) error {
+	if _, err := s.Get(ctx, id, userID); err != nil {
+		return err
+	}
+	cols, err := s.List(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	ordered := make([]positioned, len(cols))
+	for i, c := range cols {
+		ordered[i] = positioned{id: c.ID, pos: c.Position}
+	}
+	updates, err := reorder(ordered, id, after)
+	if errors.Is(err, errAfterNotFound) {
+		return fmt.Errorf("%w: unknown collection %q to move after", ErrInvalidCollection, after)
+	}
+	if err != nil {
+		return err
+	}
+	return s.repo.SetPositions(ctx, updates)
+}
+
+// Mangas devuelve la colección y sus mangas en el orden guardado
+func (s *CollectionService) Mangas(ctx context.Context, id primitive.ObjectID, userID string) (*domain.Collection, []domain.Manga, error) {
+	c, err := s.Get(ctx, id, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	items, err := s.repo.Items(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(items))
+	for i, it := range items {
+		ids[i] = it.MangaID
+	}
+	found, err := s.mangas.mgRepo.GetByIDs(ctx, c.UserID, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	byID := make(map[primitive.ObjectID]domain.Manga, len(found))
+	for _, m := range found {
+		byID[m.ID] = m
+	}
+
+	// Un item cuyo manga ya no existe (ej: falló la limpieza al borrarlo) simplemente no aparece
+	mangas := make([]domain.Manga, 0, len(found))
+	for _, id := range ids {
+		if m, ok := byID[id]; ok {
+			mangas = append(mangas, m)
+		}
+	}
+	c.Count = len(mangas)
+	return c, mangas, nil
+}
+
+// AddManga lo agrega al final de la colección
+func (s *CollectionService) AddManga(ctx context.Context, id primitive.ObjectID, userID string, mangaID primitive.ObjectID) error {
+	c, err := s.Get(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.mangas.GetOwned(ctx, mangaID, userID); err != nil {
+		return err
+	}
+
+	items, err := s.repo.Items(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(items) >= maxCollectionItems {
+		return fmt.Errorf("%w: limit of %d mangas per collection reached", ErrInvalidCollection, maxCollectionItems)
+	}
+	position := positionStep
+	if n := len(items); n > 0 {
+		position = items[n-1].Position + positionStep
+	}
+
+	err = s.repo.AddItem(ctx, &domain.CollectionItem{
+		ID:           primitive.NewObjectID(),
+		CollectionID: id,
+		MangaID:      mangaID,
+		UserID:       c.UserID,
+		Position:     position,
+		AddedAt:      time.Now(),
+	})
+	if errors.Is(err, domain.ErrDuplicate) {
+		return ErrAlreadyInCollection
+	}
+	return err
+}
+
+func (s *CollectionService) RemoveManga(ctx context.Context, id primitive.ObjectID, userID string, mangaID primitive.ObjectID) error {
+	if _, err := s.Get(ctx, id, userID); err != nil {
+		return err
+	}
+	removed, err := s.repo.RemoveItem(ctx, id, mangaID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrNotInCollection
+	}
+	return nil
+}
+
+// MoveManga lo pone después del manga after dentro de la colección (vacío = primero)
+func (s *CollectionService) MoveManga(ctx context.Context, id primitive.ObjectID, userID string, mangaID primitive.ObjectID, after string) error {
+	if _, err := s.Get(ctx, id, userID); err != nil {
+		return err
+	}
+	items, err := s.repo.Items(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	ordered := make([]positioned, len(items))
+	for i, it := range items {
+		ordered[i] = positioned{id: it.MangaID, pos: it.Position}
+	}
+	updates, err := reorder(ordered, mangaID, after)
+	switch {
+	case errors.Is(err, errMovingNotFound):
+		return ErrNotInCollection
+	case errors.Is(err, errAfterNotFound):
+		return fmt.Errorf("%w: manga %q to move after is not in the collection", ErrInvalidCollection, after)
+	case err != nil:
+		return err
+	}
+	return s.repo.SetItemPositions(ctx, id, updates)
+}
+
+// CollectionsOf devuelve en qué colecciones está el manga
+func (s *CollectionService) CollectionsOf(ctx context.Context, mangaID primitive.ObjectID, userID string) ([]primitive.ObjectID, error) {
+	if _, err := s.mangas.GetOwned(ctx, mangaID, userID); err != nil {
+		return nil, err
+	}
+	ids, err := s.repo.CollectionsOf(ctx, mangaID)
+	if err != nil {
+		return nil, err
+	}
+	if ids == nil {
+		ids = []primitive.ObjectID{}
+	}
+	return ids, nil
+}
+
+func validateCollection(in *CollectionInput) error {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Description = strings.TrimSpace(in.Description)
+	if in.Name == "" || utf8.RuneCountInString(in.Name) > maxCollectionName {
+		return fmt.Errorf("%w: name is required (max %d characters)", ErrInvalidCollection, maxCollectionName)
+	}
+	if utf8.RuneCountInString(in.Description) > maxCollectionDescribe {
+		return fmt.Errorf("%w: description too long (max %d characters)", ErrInvalidCollection, maxCollectionDescribe)
+	}
+	return nil
+}
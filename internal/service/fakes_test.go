@@ -0,0 +1,318 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"view-list/internal/domain"
+	"view-list/internal/storage"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Repos en memoria con la misma semántica que los de Mongo (internal/repository), para probar
+// los servicios sin una base. Cada método es atómico, como el update de Mongo que imita.
+
+// fakeRefs imita a MongoImageRefRepo
+type fakeRefs struct {
+	mu   sync.Mutex
+	refs map[string]*domain.ImageRef
+}
+
+func newFakeRefs() *fakeRefs {
+	return &fakeRefs{refs: map[string]*domain.ImageRef{}}
+}
+
+func cloneRef(ref *domain.ImageRef) *domain.ImageRef {
+	if ref == nil {
+		return nil
+	}
+	c := *ref
+	c.SkippedVariants = append([]string(nil), ref.SkippedVariants...)
+	return &c
+}
+
+// get es para las aserciones de los tests
+func (f *fakeRefs) get(key string) *domain.ImageRef {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return cloneRef(f.refs[key])
+}
+
+func (f *fakeRefs) Acquire(ctx context.Context, key, userID string) (*domain.ImageRef, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ref, ok := f.refs[key]
+	if !ok {
+		ref = &domain.ImageRef{Key: key, UserID: userID, Pending: true, CreatedAt: time.Now()}
+		f.refs[key] = ref
+	}
+	ref.Refs++
+	ref.UpdatedAt = time.Now()
+	return cloneRef(ref), nil
+}
+
+func (f *fakeRefs) Release(ctx context.Context, key string) (*domain.ImageRef, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ref, ok := f.refs[key]
+	if !ok || ref.Refs <= 0 {
+		return nil, false, nil
+	}
+	ref.Refs--
+	if ref.Refs > 0 {
+		return cloneRef(ref), false, nil
+	}
+	delete(f.refs, key)
+	return cloneRef(ref), true, nil
+}
+
+func (f *fakeRefs) SetVariants(ctx context.Context, key string, size int64, skipped []string) (*domain.ImageRef, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ref, ok := f.refs[key]
+	if !ok {
+		return nil, nil
+	}
+	prev := cloneRef(ref)
+	ref.HasVariants, ref.SkippedVariants, ref.Size = true, skipped, size
+	return prev, nil
+}
+
+func (f *fakeRefs) Remove(ctx context.Context, key string) (*domain.ImageRef, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ref := f.refs[key]
+	delete(f.refs, key)
+	return cloneRef(ref), nil
+}
+
+func (f *fakeRefs) Get(ctx context.Context, key string) (*domain.ImageRef, error) {
+	return f.get(key), nil
+}
+
+func claimableRef(ref *domain.ImageRef, token string, staleBefore time.Time) bool {
+	return ref.Writer == "" || ref.Writer == token || ref.WritingAt.Before(staleBefore)
+}
+
+func (f *fakeRefs) ClaimWrite(ctx context.Context, key, token string, staleBefore time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ref, ok := f.refs[key]
+	if !ok || !ref.Pending || !claimableRef(ref, token, staleBefore) {
+		return false, nil
+	}
+	ref.Writer, ref.WritingAt = token, time.Now()
+	return true, nil
+}
+
+func (f *fakeRefs) FinishWrite(ctx context.Context, key, token string, size int64, hasVariants bool, skipped []string) (*domain.ImageRef, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ref, ok := f.refs[key]
+	if !ok || ref.Writer != token {
+		return nil, fmt.Errorf("write of %s was taken over by another writer", key)
+	}
+	ref.Size, ref.HasVariants, ref.SkippedVariants = size, hasVariants, skipped
+	ref.Pending, ref.Writer, ref.WritingAt = false, "", time.Time{}
+	return cloneRef(ref), nil
+}
+
+func (f *fakeRefs) AbortWrite(ctx context.Context, key, token string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if ref, ok := f.refs[key]; ok && ref.Writer == token {
+		ref.Writer, ref.WritingAt = "", time.Time{}
+	}
+	return nil
+}
+
+func (f *fakeRefs) ClaimDelete(ctx context.Context, key, userID, token string, staleBefore time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	ref, ok := f.refs[key]
+	if !ok {
+		f.refs[key] = &domain.ImageRef{Key: key, UserID: userID, Pending: true, Writer: token, WritingAt: now, CreatedAt: now}
+		return true, nil
+	}
+	if ref.Refs > 0 || !claimableRef(ref, token, staleBefore) {
+		return false, nil
+	}
+	ref.Pending, ref.Writer, ref.WritingAt = true, token, now
+	return true, nil
+}
+
+func (f *fakeRefs) FinishDelete(ctx context.Context, key, token string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ref, ok := f.refs[key]
+	if !ok || ref.Writer != token {
+		return nil
+	}
+	if ref.Refs <= 0 {
+		delete(f.refs, key)
+		return nil
+	}
+	// La tomó un guardado mientras se borraba: queda pendiente para que la escriba
+	ref.Writer, ref.WritingAt = "", time.Time{}
+	return nil
+}
+
+func (f *fakeRefs) List(ctx context.Context) ([]domain.ImageRef, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []domain.ImageRef
+	for _, ref := range f.refs {
+		out = append(out, *cloneRef(ref))
+	}
+	return out, nil
+}
+
+func (f *fakeRefs) Upsert(ctx context.Context, ref *domain.ImageRef) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.refs[ref.Key] = cloneRef(ref)
+	return nil
+}
+
+// fakeUsers imita a MongoUserRepo, con el chequeo de cuota de AddStorageUsed
+type fakeUsers struct {
+	mu    sync.Mutex
+	users map[primitive.ObjectID]*domain.User
+}
+
+func newFakeUsers(users ...*domain.User) *fakeUsers {
+	f := &fakeUsers{users: map[primitive.ObjectID]*domain.User{}}
+	for _, u := range users {
+		f.users[u.ID] = u
+	}
+	return f
+}
+
+func (f *fakeUsers) used(id primitive.ObjectID) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.users[id].StorageUsed
+}
+
+func (f *fakeUsers) Create(ctx context.Context, user *domain.User) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[user.ID] = user
+	return nil
+}
+
+func (f *fakeUsers) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeUsers) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u, ok := f.users[id]
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+	c := *u
+	c.States = append([]domain.ReadingState(nil), u.States...)
+	return &c, nil
+}
+
+func (f *fakeUsers) AddStorageUsed(ctx context.Context, id primitive.ObjectID, delta, limit int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u, ok := f.users[id]
+	if !ok {
+		return false, nil
+	}
+	if delta > 0 && limit > 0 && u.StorageUsed+delta > limit {
+		return false, nil
+	}
+	u.StorageUsed = max(0, u.StorageUsed+delta)
+	return true, nil
+}
+
+func (f *fakeUsers) SetStorageUsed(ctx context.Context, id primitive.ObjectID, bytes int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[id].StorageUsed = bytes
+	return nil
+}
+
+func (f *fakeUsers) ResetStorageUsed(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, u := range f.users {
+		u.StorageUsed = 0
+	}
+	return nil
+}
+
+func (f *fakeUsers) SetStates(ctx context.Context, id primitive.ObjectID, states []domain.ReadingState) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[id].States = append([]domain.ReadingState(nil), states...)
+	return nil
+}
+
+func (f *fakeUsers) SetScoreScale(ctx context.Context, id primitive.ObjectID, scale domain.ScoreScale) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[id].ScoreScale = scale
+	return nil
+}
+
+// countingStore cuenta las escrituras de cada key y puede hacer fallar los Put
+type countingStore struct {
+	storage.ImageStore
+	mu      sync.Mutex
+	puts    map[string]int
+	failPut error
+}
+
+func newCountingStore(inner storage.ImageStore) *countingStore {
+	return &countingStore{ImageStore: inner, puts: map[string]int{}}
+}
+
+func (s *countingStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	s.mu.Lock()
+	err := s.failPut
+	s.puts[key]++
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.ImageStore.Put(ctx, key, r, size, contentType)
+}
+
+func (s *countingStore) putCount(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.puts[key]
+}
+
+// fakeMangas solo implementa lo que usa StateService; el resto de MangaRepo entra en pánico
+type fakeMangas struct {
+	domain.MangaRepo
+	counts     map[domain.MangaState]int
+	reassigned map[domain.MangaState]domain.MangaState
+}
+
+func (f *fakeMangas) CountByState(ctx context.Context, userID primitive.ObjectID) (map[domain.MangaState]int, error) {
+	return f.counts, nil
+}
+
+func (f *fakeMangas) ReassignState(ctx context.Context, userID primitive.ObjectID, from, to domain.MangaState) (int64, error) {
+	if f.reassigned == nil {
+		f.reassigned = map[domain.MangaState]domain.MangaState{}
+	}
+	f.reassigned[from] = to
+	n := f.counts[from]
+	f.counts[to] += n
+	delete(f.counts, from)
+	return int64(n), nil
+}
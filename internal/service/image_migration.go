@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"view-list/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MigrateImageKeys reescribe los mangas que todavía guardan la URL completa de la portada
+// (http://host:puerto/uploads/<key>) para que guarden solo la key, igual con las variantes.
+// Se puede correr más de una vez: los que ya tienen key se saltean.
+func MigrateImageKeys(ctx context.Context, mgRepo domain.MangaRepo, images *ImageService) (int, error) {
+	mangas, err := mgRepo.ListWithImage(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	for _, m := range mangas {
+		updates := bson.M{}
+		if key, ok := images.Key(m.Image, m.UserID.Hex()); ok && key != m.Image {
+			updates["image"] = key
+		}
+
+		variants := make(map[string]string, len(m.Variants))
+		changed := false
+		for name, v := range m.Variants {
+			key, ok := images.Key(v, m.UserID.Hex())
+			if !ok {
+				continue // no debería pasar: las variantes son siempre nuestras
+			}
+			variants[name] = key
+			changed = changed || key != v
+		}
+		if changed {
+			updates["variants"] = variants
+		}
+
+		if len(updates) == 0 {
+			continue
+		}
+		if err := mgRepo.Update(ctx, m.ID, updates); err != nil {
+			return migrated, fmt.Errorf("manga %s: %w", m.ID.Hex(), err)
+		}
+		migrated++
+	}
+
+	log.Printf("Image keys migration: %d of %d mangas rewritten\n", migrated, len(mangas))
+	return migrated, nil
+}
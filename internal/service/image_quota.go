@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrQuotaExceeded = errors.New("Storage quota exceeded")
+
+// StorageUsage es lo que ocupa un usuario y su límite (0 = sin límite)
+type StorageUsage struct {
+	Used  int64 `json:"used"`
+	Quota int64 `json:"quota"`
+}
+
+// Reserva bytes en la cuota antes de escribir; el chequeo y la suma son atómicos en Mongo
+func (s *ImageService) reserve(ctx context.Context, userID string, bytes int64) error {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+	ok, err := s.users.AddStorageUsed(ctx, objID, bytes, s.opts.Quota)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// Ajusta el uso sin chequear la cuota. Si falla queda desfasado hasta el próximo recálculo.
+func (s *ImageService) addUsage(ctx context.Context, userID string, delta int64) {
+	if delta == 0 {
+		return
+	}
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return
+	}
+	if _, err := s.users.AddStorageUsed(ctx, objID, delta, 0); err != nil {
+		log.Printf("warning: error updating storage usage of user %s: %v\n", userID, err)
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// storedSize es lo que ocupa data guardada (original + variantes), lo que se cobra a la cuota
+func storedSize(t *testing.T, data []byte) int64 {
+	f := newImageFixture(t, 0)
+	img, err := f.save(t, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f.refs.get(img.Key).Size
+}
+
+func TestImageQuota(t *testing.T) {
+	data := pngOf(t, 80)
+	size := storedSize(t, data)
+	name := keyHash(t, data)
+
+	tests := []struct {
+		name    string
+		quota   int64
+		used    int64 // uso previo
+		wantErr error
+	}{
+		{"no quota", 0, 1 << 40, nil},
+		{"fits", size * 2, 0, nil},
+		{"fits exactly", size * 2, size, nil},
+		{"one byte over", size * 2, size + 1, ErrQuotaExceeded},
+		{"larger than the quota", size - 1, 0, ErrQuotaExceeded},
+		{"already over the quota", size, size * 3, ErrQuotaExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newImageFixture(t, tt.quota)
+			f.users.users[f.userID].StorageUsed = tt.used
+
+			_, err := f.save(t, data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("save = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				if used := f.users.used(f.userID); used != tt.used+size {
+					t.Errorf("used %d, want %d", used, tt.used+size)
+				}
+				return
+			}
+
+			// Rechazada: no queda ni archivo, ni registro, ni uso reservado
+			refs, _ := f.refs.List(context.Background())
+			if len(refs) != 0 || f.store.putCount("user_"+f.userID.Hex()+"/"+name) != 0 || f.users.used(f.userID) != tt.used {
+				t.Errorf("refs %+v, used %d; want nothing charged", refs, f.users.used(f.userID))
+			}
+		})
+	}
+}
+
+// La misma imagen otra vez no ocupa espacio nuevo: entra aunque el usuario esté en el límite
+func TestImageQuotaDedup(t *testing.T) {
+	data := pngOf(t, 90)
+	size := storedSize(t, data)
+	f := newImageFixture(t, size)
+
+	img, err := f.save(t, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.save(t, data); err != nil {
+		t.Fatalf("second save of the same image = %v, want no quota error", err)
+	}
+	if _, err := f.save(t, pngOf(t, 91)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("save of another image = %v, want ErrQuotaExceeded", err)
+	}
+
+	// Soltar la última referencia libera el espacio
+	ctx := context.Background()
+	for range 2 {
+		if _, err := f.svc.Release(ctx, img.Key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if used := f.users.used(f.userID); used != 0 {
+		t.Fatalf("used %d after releasing everything, want 0", used)
+	}
+	if _, err := f.save(t, data); err != nil {
+		t.Errorf("save after freeing space = %v", err)
+	}
+}
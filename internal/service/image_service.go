@@ -0,0 +1,499 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+	"view-list/internal/auth"
+	"view-list/internal/domain"
+	"view-list/internal/fetch"
+	"view-list/internal/imaging"
+	"view-list/internal/storage"
+	"view-list/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ImageService guarda y lee las portadas a través del ImageStore configurado (disco o S3).
+// Las URLs públicas siempre apuntan a /uploads/<key> del server, que las sirve o redirige.
+// Antes de guardar, toda imagen se valida por contenido y se limpia de metadatos (ver imaging.Sanitize).
+// Los archivos se nombran por el hash del contenido: la misma portada subida dos veces es un solo
+// archivo, y refs lleva la cuenta de cuántos mangas lo usan.
+// Cada archivo nuevo cuenta para la cuota de su dueño (ver image_quota.go).
+type ImageService struct {
+	store storage.ImageStore
+	refs  domain.ImageRefRepo
+	users domain.UserRepo
+	opts  ImageOptions
+}
+
+type ImageOptions struct {
+	Limits    imaging.Limits
+	Quota     int64           // bytes por usuario, 0 = sin límite
+	Fetcher   *fetch.Fetcher  // nil si no se permite bajar portadas de URLs (ej: comandos)
+	Signer    *auth.URLSigner // nil = URLs sin firma (comandos)
+	PublicURL string
+}
+
+func NewImageService(store storage.ImageStore, refs domain.ImageRefRepo, users domain.UserRepo, opts ImageOptions) *ImageService {
+	return &ImageService{store: store, refs: refs, users: users, opts: opts}
+}
+
+// StoredImage es una imagen ya guardada: la key del original y las de sus variantes por nombre.
+// En la db se guardan las keys; la URL pública se arma al responder (ver ResolveURL).
+type StoredImage struct {
+	Key      string
+	Variants map[string]string
+}
+
+// SaveBase64 guarda una imagen base64 en la carpeta del usuario junto con sus variantes
+func (s *ImageService) SaveBase64(ctx context.Context, userID, base64Data string) (*StoredImage, error) {
+	if base64Data == "" {
+		return &StoredImage{}, nil
+	}
+
+	// El header del data URI no se usa: el formato sale del contenido
+	data, _, err := utils.DecodeBase64Image(base64Data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", imaging.ErrInvalidImage, err)
+	}
+
+	img, err := imaging.Sanitize(data, s.opts.Limits)
+	if err != nil {
+		return nil, err
+	}
+	return s.save(ctx, userID, img)
+}
+
+// SaveStream guarda una imagen binaria (multipart o body crudo) sin pasarla por base64.
+// El Content-Type declarado se ignora, manda lo que diga el contenido.
+func (s *ImageService) SaveStream(ctx context.Context, userID string, r io.Reader) (*StoredImage, error) {
+	img, err := imaging.Read(r, s.opts.Limits)
+	if err != nil {
+		return nil, err
+	}
+	return s.save(ctx, userID, img)
+}
+
+// SaveRemote baja una imagen de una URL externa y la guarda como si la hubiera subido el usuario
+func (s *ImageService) SaveRemote(ctx context.Context, userID, rawURL string) (*StoredImage, error) {
+	if s.opts.Fetcher == nil {
+		return nil, fetch.ErrFetch
+	}
+	data, err := s.opts.Fetcher.Fetch(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := imaging.Sanitize(data, s.opts.Limits)
+	if err != nil {
+		return nil, err
+	}
+	return s.save(ctx, userID, img)
+}
+
+func (s *ImageService) save(ctx context.Context, userID string, img *imaging.Image) (*StoredImage, error) {
+	// El re-encode de Sanitize es determinístico, así que la misma imagen da el mismo hash
+	sum := sha256.Sum256(img.Data)
+	key := "user_" + userID + "/" + hex.EncodeToString(sum[:]) + img.Ext
+
+	ref, err := s.refs.Acquire(ctx, key, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	wrote := false
+	ref, err = s.awaitWrite(ctx, key, ref, func() (written, error) {
+		wrote = true
+		return s.writeNew(ctx, userID, key, img)
+	})
+	if err != nil {
+		s.dropRef(ctx, key)
+		return nil, err
+	}
+	if ref.HasVariants {
+		return &StoredImage{Key: key, Variants: s.variantKeyMap(key, ref.SkippedVariants)}, nil
+	}
+	if wrote {
+		return &StoredImage{Key: key}, nil
+	}
+
+	// Ya existía sin variantes (de antes de las variantes o fallaron): no ocupa espacio nuevo salvo por ellas
+	variants, err := s.putVariants(ctx, key, img.Data)
+	if err != nil {
+		log.Printf("warning: error generating variants of %s: %v\n", key, err)
+	}
+	return &StoredImage{Key: key, Variants: variants}, nil
+}
+
+// Cuánto se espera a otro guardado de la misma imagen, y cuándo se lo da por colgado
+const (
+	writeLease = 2 * time.Minute
+	writePoll  = 100 * time.Millisecond
+)
+
+var ErrImageBusy = errors.New("the image is being saved by another request, try again")
+
+// Lo que dejó escrito un guardado: cuánto ocupa en total y qué variantes tiene
+type written struct {
+	size        int64
+	hasVariants bool
+	skipped     []string // variantes que no achicaban el original y no se guardaron
+}
+
+// awaitWrite devuelve el registro de key cuando su archivo ya está escrito. Si está pendiente y nadie
+// lo está escribiendo (o el que lo hacía se colgó), lo escribe este guardado con write; si lo está
+// escribiendo otro (o borrando un job), espera a que termine. Así un guardado concurrente de la misma
+// imagen no devuelve la key hasta que el archivo existe, aunque el primero falle por cuota o en el Put.
+func (s *ImageService) awaitWrite(ctx context.Context, key string, ref *domain.ImageRef, write func() (written, error)) (*domain.ImageRef, error) {
+	deadline := time.Now().Add(writeLease)
+	for ref.Pending {
+		token := primitive.NewObjectID().Hex()
+		claimed, err := s.refs.ClaimWrite(ctx, key, token, time.Now().Add(-writeLease))
+		if err != nil {
+			return nil, err
+		}
+		if claimed {
+			w, err := write()
+			if err != nil {
+				if err := s.refs.AbortWrite(ctx, key, token); err != nil {
+					log.Printf("warning: error releasing write of %s: %v\n", key, err)
+				}
+				return nil, err
+			}
+			return s.refs.FinishWrite(ctx, key, token, w.size, w.hasVariants, w.skipped)
+		}
+
+		if time.Now().After(deadline) {
+			return nil, ErrImageBusy
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(writePoll):
+		}
+		if ref, err = s.refs.Get(ctx, key); err != nil {
+			return nil, err
+		}
+		if ref == nil {
+			return nil, ErrImageBusy // no debería pasar: la referencia de este guardado lo mantiene
+		}
+	}
+	return ref, nil
+}
+
+// writeNew escribe un archivo nuevo y devuelve cuánto ocupa. Las variantes se generan antes para
+// reservar todo junto en la cuota; si fallan, el original igual sirve y el backfill las puede generar después.
+func (s *ImageService) writeNew(ctx context.Context, userID, key string, img *imaging.Image) (written, error) {
+	size := int64(len(img.Data))
+	rendered, err := imaging.MakeVariants(img.Data)
+	if err != nil {
+		log.Printf("warning: error generating variants of %s: %v\n", key, err)
+		rendered = nil
+	}
+	total := size + renderedSize(rendered)
+
+	if err := s.reserve(ctx, userID, total); err != nil {
+		return written{}, err
+	}
+	if err := s.store.Put(ctx, key, bytes.NewReader(img.Data), size, img.ContentType); err != nil {
+		s.addUsage(ctx, userID, -total)
+		return written{}, err
+	}
+	if rendered == nil {
+		return written{size: size}, nil
+	}
+	if err := s.putVariantFiles(ctx, key, rendered); err != nil {
+		log.Printf("warning: error saving variants of %s: %v\n", key, err)
+		s.addUsage(ctx, userID, -renderedSize(rendered))
+		return written{size: size}, nil
+	}
+	return written{size: total, hasVariants: true, skipped: imaging.SkippedVariants(rendered)}, nil
+}
+
+// Suelta la referencia tomada por un guardado que no llegó a completarse
+func (s *ImageService) dropRef(ctx context.Context, key string) {
+	if _, _, err := s.refs.Release(ctx, key); err != nil {
+		log.Printf("warning: error releasing reference of %s: %v\n", key, err)
+	}
+}
+
+// Release suma la baja de un manga que usaba la imagen. Devuelve true si no la usa nadie más
+// y el archivo (con sus variantes) se puede borrar; en ese caso ya descuenta su espacio.
+func (s *ImageService) Release(ctx context.Context, key string) (bool, error) {
+	ref, last, err := s.refs.Release(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if last {
+		s.addUsage(ctx, ref.UserID, -ref.Size)
+	}
+	return last, nil
+}
+
+// Forget saca el conteo de una imagen que se movió fuera del storage (ej: cuarentena)
+func (s *ImageService) Forget(ctx context.Context, key string) error {
+	ref, err := s.refs.Remove(ctx, key)
+	if err != nil {
+		return err
+	}
+	if ref != nil {
+		s.addUsage(ctx, ref.UserID, -ref.Size)
+	}
+	return nil
+}
+
+// GenerateVariants vuelve a generar las variantes de una imagen ya guardada (backfill)
+func (s *ImageService) GenerateVariants(ctx context.Context, key string) (map[string]string, error) {
+	rc, _, err := s.store.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s does not exist", imaging.ErrInvalidImage, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	return s.putVariants(ctx, key, data)
+}
+
+// Genera y guarda las variantes de un archivo que ya existe, ajustando el uso de su dueño
+// (sin aplicar la cuota: el original ya estaba aceptado)
+func (s *ImageService) putVariants(ctx context.Context, key string, data []byte) (map[string]string, error) {
+	rendered, err := imaging.MakeVariants(data)
+	if err != nil {
+		return nil, err
+	}
+
+	total := int64(len(data)) + renderedSize(rendered)
+	urls, prev, err := s.writeVariants(ctx, key, rendered, total)
+	if err != nil {
+		return nil, err
+	}
+	if prev != nil {
+		s.addUsage(ctx, prev.UserID, total-prev.Size)
+	}
+	return urls, nil
+}
+
+func (s *ImageService) writeVariants(ctx context.Context, key string, rendered map[string][]byte, total int64) (map[string]string, *domain.ImageRef, error) {
+	if err := s.putVariantFiles(ctx, key, rendered); err != nil {
+		return nil, nil, err
+	}
+	skipped := imaging.SkippedVariants(rendered)
+	prev, err := s.refs.SetVariants(ctx, key, total, skipped)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.variantKeyMap(key, skipped), prev, nil
+}
+
+func (s *ImageService) putVariantFiles(ctx context.Context, key string, rendered map[string][]byte) error {
+	for name, b := range rendered {
+		vKey := imaging.VariantKey(key, name)
+		if err := s.store.Put(ctx, vKey, bytes.NewReader(b), int64(len(b)), imaging.VariantContentType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renderedSize(rendered map[string][]byte) int64 {
+	var n int64
+	for _, b := range rendered {
+		n += int64(len(b))
+	}
+	return n
+}
+
+// Las keys de las variantes por nombre; las que no se guardaron (skipped) apuntan al original
+func (s *ImageService) variantKeyMap(key string, skipped []string) map[string]string {
+	keys := make(map[string]string, len(imaging.Variants))
+	for _, v := range imaging.Variants {
+		keys[v.Name] = imaging.VariantKey(key, v.Name)
+	}
+	for _, name := range skipped {
+		keys[name] = key
+	}
+	return keys
+}
+
+// VariantKeys son las keys de todas las variantes que puede tener un original
+func (s *ImageService) VariantKeys(key string) []string {
+	keys := make([]string, 0, len(imaging.Variants))
+	for _, v := range imaging.Variants {
+		keys = append(keys, imaging.VariantKey(key, v.Name))
+	}
+	return keys
+}
+
+func (s *ImageService) URL(key string) string {
+	return s.opts.PublicURL + "/uploads/" + key
+}
+
+// ResolveURL arma la URL pública de una imagen guardada, con la firma que vence para que el navegador
+// la pueda pedir sin el JWT (solo si es de ownerID). Los links externos y las imágenes vacías quedan igual.
+func (s *ImageService) ResolveURL(image, ownerID string) string {
+	key, ok := s.Key(image, ownerID)
+	if !ok {
+		return image
+	}
+	if s.opts.Signer == nil {
+		return s.URL(key)
+	}
+	return s.URL(key) + "?" + s.opts.Signer.Sign(key, time.Now()).Encode()
+}
+
+// Reuse suma una referencia a una imagen que el usuario ya tiene guardada (ej: copia la URL de otro manga)
+func (s *ImageService) Reuse(ctx context.Context, userID, key string) (*StoredImage, error) {
+	if OwnerOf(key) != userID {
+		return nil, ErrNotOwner
+	}
+	rc, _, err := s.store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	rc.Close()
+
+	ref, err := s.refs.Acquire(ctx, key, userID)
+	if err != nil {
+		return nil, err
+	}
+	// Sin registro escrito: o es de antes del conteo, o la está guardando (o borrando) otro.
+	// Si es de antes del conteo se registra con lo que ocupa de verdad y se le cobra al dueño,
+	// igual que haría recalc-storage: el archivo ya está en el storage, así que no pasa por la cuota.
+	legacy := false
+	ref, err = s.awaitWrite(ctx, key, ref, func() (written, error) {
+		legacy = ref.Refs == 1
+		return s.statStored(ctx, key)
+	})
+	if err != nil {
+		s.dropRef(ctx, key)
+		return nil, err
+	}
+	// Imagen de antes del conteo: el manga que ya la usaba también cuenta
+	if legacy {
+		s.addUsage(ctx, userID, ref.Size)
+		if ref, err = s.refs.Acquire(ctx, key, userID); err != nil {
+			return nil, err
+		}
+	}
+	img := &StoredImage{Key: key}
+	if ref.HasVariants {
+		img.Variants = s.variantKeyMap(key, ref.SkippedVariants)
+	}
+	return img, nil
+}
+
+// statStored mide un original ya guardado junto con sus variantes, como lo registra recalc-storage
+func (s *ImageService) statStored(ctx context.Context, key string) (written, error) {
+	rc, info, err := s.store.Get(ctx, key)
+	if err != nil {
+		return written{}, err
+	}
+	rc.Close()
+
+	w := written{size: info.Size}
+	var missing []string
+	for _, v := range imaging.Variants {
+		rc, info, err := s.store.Get(ctx, imaging.VariantKey(key, v.Name))
+		if err != nil {
+			missing = append(missing, v.Name)
+			continue
+		}
+		rc.Close()
+		w.size += info.Size
+		w.hasVariants = true
+	}
+	// Con alguna variante se generaron; las que faltan no achicaban el original
+	if w.hasVariants {
+		w.skipped = missing
+	}
+	return w, nil
+}
+
+var ErrNotOwner = fmt.Errorf("%w: the image belongs to another user", imaging.ErrInvalidImage)
+
+// OwnerOf devuelve el user id dueño de una key user_<id>/..., o "" si no tiene dueño
+func OwnerOf(key string) string {
+	userID, _ := keyOwner(key)
+	return userID
+}
+
+// Key devuelve la key de storage de una imagen de userID, o false si es un link externo o de otro usuario.
+// Acepta la key tal como se guarda y también URLs de /uploads (las viejas de la db o las que devuelve la API).
+func (s *ImageService) Key(image, userID string) (string, bool) {
+	if IsStorageKey(image) {
+		return image, userID != "" && OwnerOf(image) == userID
+	}
+	return utils.UploadKey(image, s.opts.PublicURL, userID)
+}
+
+// IsStorageKey dice si el valor guardado en Manga.Image es una key (user_<id>/...) y no una URL
+func IsStorageKey(image string) bool {
+	if !strings.HasPrefix(image, "user_") || strings.Contains(image, "://") {
+		return false
+	}
+	key, err := storage.CleanKey(image)
+	return err == nil && key == image
+}
+
+// Delete borra el original y sus variantes, sin mirar las referencias (eso lo hace Release antes)
+func (s *ImageService) Delete(ctx context.Context, key string) error {
+	for _, k := range append(s.VariantKeys(key), key) {
+		if err := s.store.Delete(ctx, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteIfUnused borra el original y sus variantes solo si nadie volvió a tomar la key desde que se
+// soltó su última referencia. Mientras borra deja la key pendiente en image_refs con token: un guardado
+// de la misma imagen que llegue en el medio espera y, al terminar el borrado, la vuelve a escribir.
+func (s *ImageService) DeleteIfUnused(ctx context.Context, key, token string) error {
+	claimed, err := s.refs.ClaimDelete(ctx, key, OwnerOf(key), token, time.Now().Add(-writeLease))
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil // la volvieron a usar
+	}
+
+	err = s.Delete(ctx, key)
+	if ferr := s.refs.FinishDelete(ctx, key, token); ferr != nil && err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// ToBase64 lee una imagen subida y la devuelve como data URI (para los backups)
+func (s *ImageService) ToBase64(ctx context.Context, image, userID string) (string, error) {
+	key, ok := s.Key(image, userID)
+	if !ok {
+		return "", fmt.Errorf("image %s is not a local upload", image)
+	}
+
+	rc, info, err := s.store.Get(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("error reading image %s: %w", key, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return "", err
+	}
+	return utils.EncodeBase64Image(data, info.ContentType), nil
+}
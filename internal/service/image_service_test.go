@@ -0,0 +1,404 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"view-list/internal/domain"
+	"view-list/internal/imaging"
+	"view-list/internal/storage"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type imageFixture struct {
+	svc    *ImageService
+	refs   *fakeRefs
+	users  *fakeUsers
+	store  *countingStore
+	userID primitive.ObjectID
+}
+
+func newImageFixture(t *testing.T, quota int64) *imageFixture {
+	user := &domain.User{ID: primitive.NewObjectID()}
+	f := &imageFixture{
+		refs:   newFakeRefs(),
+		users:  newFakeUsers(user),
+		store:  newCountingStore(storage.NewLocalStore(t.TempDir())),
+		userID: user.ID,
+	}
+	f.svc = NewImageService(f.store, f.refs, f.users, ImageOptions{
+		Limits: imaging.Limits{MaxBytes: 1 << 20, MaxWidth: 100, MaxHeight: 100},
+		Quota:  quota,
+	})
+	return f
+}
+
+// pngOf arma un PNG chico de un solo color: cada color da otro hash
+func pngOf(t *testing.T, c uint8) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := range img.Pix {
+		img.Pix[i] = c
+	}
+	img.Set(0, 0, color.NRGBA{A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func (f *imageFixture) save(t *testing.T, data []byte) (*StoredImage, error) {
+	t.Helper()
+	return f.svc.SaveStream(context.Background(), f.userID.Hex(), bytes.NewReader(data))
+}
+
+func (f *imageFixture) exists(key string) bool {
+	rc, _, err := f.store.Get(context.Background(), key)
+	if err != nil {
+		return false
+	}
+	rc.Close()
+	return true
+}
+
+func TestImageSaveDedup(t *testing.T) {
+	f := newImageFixture(t, 0)
+	ctx := context.Background()
+	data := pngOf(t, 10)
+
+	first, err := f.save(t, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := f.save(t, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Key != second.Key {
+		t.Fatalf("keys %q and %q, want the same file", first.Key, second.Key)
+	}
+	if n := f.store.putCount(first.Key); n != 1 {
+		t.Errorf("original written %d times, want 1", n)
+	}
+	ref := f.refs.get(first.Key)
+	if ref == nil || ref.Refs != 2 || ref.Pending {
+		t.Fatalf("ref = %+v, want 2 refs and written", ref)
+	}
+	if used := f.users.used(f.userID); used != ref.Size || used == 0 {
+		t.Errorf("used %d, want the size of one file (%d)", used, ref.Size)
+	}
+
+	tests := []struct {
+		last bool
+		refs int // -1 = sin registro
+		used int64
+	}{
+		{last: false, refs: 1, used: ref.Size},
+		{last: true, refs: -1, used: 0},
+		{last: false, refs: -1, used: 0}, // sin registro no se descuenta dos veces
+	}
+	for i, tt := range tests {
+		last, err := f.svc.Release(ctx, first.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := f.refs.get(first.Key)
+		refs := -1
+		if got != nil {
+			refs = got.Refs
+		}
+		if last != tt.last || refs != tt.refs || f.users.used(f.userID) != tt.used {
+			t.Errorf("release %d: last=%v refs=%d used=%d, want %v %d %d", i+1, last, refs, f.users.used(f.userID), tt.last, tt.refs, tt.used)
+		}
+	}
+
+	if err := f.svc.DeleteIfUnused(ctx, first.Key, "gc"); err != nil {
+		t.Fatal(err)
+	}
+	if f.exists(first.Key) || f.refs.get(first.Key) != nil {
+		t.Error("the file and its ref should be gone after the last release")
+	}
+}
+
+func TestImageSaveConcurrent(t *testing.T) {
+	f := newImageFixture(t, 0)
+	data := pngOf(t, 20)
+
+	const n = 5
+	keys := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			img, err := f.save(t, data)
+			if err == nil {
+				keys[i] = img.Key
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("save %d: %v", i, err)
+		}
+		if keys[i] != keys[0] {
+			t.Fatalf("save %d got key %q, want %q", i, keys[i], keys[0])
+		}
+	}
+	if n := f.store.putCount(keys[0]); n != 1 {
+		t.Errorf("original written %d times, want 1", n)
+	}
+	if ref := f.refs.get(keys[0]); ref == nil || ref.Refs != n || ref.Pending {
+		t.Errorf("ref = %+v, want %d refs and written", ref, n)
+	}
+	if used, ref := f.users.used(f.userID), f.refs.get(keys[0]); used != ref.Size {
+		t.Errorf("used %d, want %d (charged once)", used, ref.Size)
+	}
+}
+
+func TestImageDeleteRaces(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		// race corre entre que se suelta la última referencia y el borrado; devuelve el resultado del guardado
+		race      func(t *testing.T, f *imageFixture, key string, data []byte) error
+		wantFile  bool
+		wantRefs  int // -1 = sin registro
+		wantPuts  int
+		wantUsage bool
+	}{
+		{
+			name:     "nobody reuses it",
+			race:     func(t *testing.T, f *imageFixture, key string, data []byte) error { return nil },
+			wantFile: false, wantRefs: -1, wantPuts: 1,
+		},
+		{
+			name: "saved again before the delete claim",
+			race: func(t *testing.T, f *imageFixture, key string, data []byte) error {
+				_, err := f.save(t, data)
+				return err
+			},
+			wantFile: true, wantRefs: 1, wantPuts: 2, wantUsage: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newImageFixture(t, 0)
+			data := pngOf(t, 30)
+			img, err := f.save(t, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if last, err := f.svc.Release(ctx, img.Key); err != nil || !last {
+				t.Fatalf("Release = %v, %v; want last", last, err)
+			}
+
+			if err := tt.race(t, f, img.Key, data); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.svc.DeleteIfUnused(ctx, img.Key, "gc"); err != nil {
+				t.Fatal(err)
+			}
+			checkImage(t, f, img.Key, tt.wantFile, tt.wantRefs, tt.wantPuts, tt.wantUsage)
+		})
+	}
+}
+
+// Un guardado que llega mientras se borra el archivo espera y lo vuelve a escribir
+func TestImageSaveDuringDelete(t *testing.T) {
+	f := newImageFixture(t, 0)
+	ctx := context.Background()
+	data := pngOf(t, 40)
+	img, err := f.save(t, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.svc.Release(ctx, img.Key); err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err := f.refs.ClaimDelete(ctx, img.Key, f.userID.Hex(), "gc", time.Now().Add(-writeLease))
+	if err != nil || !claimed {
+		t.Fatalf("ClaimDelete = %v, %v", claimed, err)
+	}
+	// Con el borrado tomado nadie puede escribir la key
+	if ok, _ := f.refs.ClaimWrite(ctx, img.Key, "other", time.Now().Add(-writeLease)); ok {
+		t.Fatal("ClaimWrite succeeded while the delete was claimed")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := f.save(t, data)
+		done <- err
+	}()
+	waitFor(t, func() bool { ref := f.refs.get(img.Key); return ref != nil && ref.Refs == 1 })
+
+	// Una vez tomada, ClaimDelete de otro borrado no pasa
+	if ok, _ := f.refs.ClaimDelete(ctx, img.Key, f.userID.Hex(), "gc2", time.Now().Add(-writeLease)); ok {
+		t.Fatal("a second ClaimDelete succeeded with a live reference")
+	}
+
+	if err := f.svc.Delete(ctx, img.Key); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.refs.FinishDelete(ctx, img.Key, "gc"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the save never finished")
+	}
+	checkImage(t, f, img.Key, true, 1, 2, true)
+}
+
+func TestImageStaleWriterTakenOver(t *testing.T) {
+	f := newImageFixture(t, 0)
+	ctx := context.Background()
+	data := pngOf(t, 50)
+
+	// Otro guardado tomó la escritura y se colgó hace más de writeLease
+	key := "user_" + f.userID.Hex() + "/" + keyHash(t, data)
+	if _, err := f.refs.Acquire(ctx, key, f.userID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := f.refs.ClaimWrite(ctx, key, "hung", time.Now().Add(-writeLease)); err != nil || !ok {
+		t.Fatalf("ClaimWrite = %v, %v", ok, err)
+	}
+	ref := f.refs.get(key)
+	ref.WritingAt = time.Now().Add(-writeLease - time.Second)
+	if err := f.refs.Upsert(ctx, ref); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := f.save(t, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Key != key {
+		t.Fatalf("key %q, want %q", img.Key, key)
+	}
+	// El colgado ya no puede terminar su escritura
+	if _, err := f.refs.FinishWrite(ctx, key, "hung", 1, false, nil); err == nil {
+		t.Error("FinishWrite of the stale writer succeeded")
+	}
+	checkImage(t, f, key, true, 2, 1, true)
+}
+
+func TestImagePutFails(t *testing.T) {
+	f := newImageFixture(t, 0)
+	data := pngOf(t, 60)
+
+	f.store.failPut = errors.New("disk full")
+	if _, err := f.save(t, data); err == nil {
+		t.Fatal("save succeeded with a failing store")
+	}
+	refs, _ := f.refs.List(context.Background())
+	if len(refs) != 0 || f.users.used(f.userID) != 0 {
+		t.Fatalf("refs %+v, used %d; want nothing left behind", refs, f.users.used(f.userID))
+	}
+
+	f.store.failPut = nil
+	img, err := f.save(t, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImage(t, f, img.Key, true, 1, 2, true)
+}
+
+func TestImageReuseLegacy(t *testing.T) {
+	f := newImageFixture(t, 0)
+	ctx := context.Background()
+	data := pngOf(t, 70)
+
+	// Archivo de antes del conteo: está en el storage pero no en image_refs
+	key := "user_" + f.userID.Hex() + "/legacy.png"
+	if err := f.store.ImageStore.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.svc.Reuse(ctx, f.userID.Hex(), key); err != nil {
+		t.Fatal(err)
+	}
+	ref := f.refs.get(key)
+	if ref == nil || ref.Refs != 2 || ref.Pending || ref.Size != int64(len(data)) {
+		t.Fatalf("ref = %+v, want 2 refs of %d bytes", ref, len(data))
+	}
+	if used := f.users.used(f.userID); used != int64(len(data)) {
+		t.Errorf("used %d, want %d", used, len(data))
+	}
+
+	// Ya registrada, reusarla de nuevo solo suma la referencia
+	if _, err := f.svc.Reuse(ctx, f.userID.Hex(), key); err != nil {
+		t.Fatal(err)
+	}
+	if ref := f.refs.get(key); ref.Refs != 3 || f.users.used(f.userID) != int64(len(data)) {
+		t.Errorf("refs %d, used %d; want 3 and %d", ref.Refs, f.users.used(f.userID), len(data))
+	}
+
+	if _, err := f.svc.Reuse(ctx, primitive.NewObjectID().Hex(), key); !errors.Is(err, ErrNotOwner) {
+		t.Errorf("Reuse by another user = %v, want ErrNotOwner", err)
+	}
+}
+
+func checkImage(t *testing.T, f *imageFixture, key string, wantFile bool, wantRefs, wantPuts int, wantUsage bool) {
+	t.Helper()
+	if got := f.exists(key); got != wantFile {
+		t.Errorf("file exists = %v, want %v", got, wantFile)
+	}
+	ref := f.refs.get(key)
+	refs := -1
+	if ref != nil {
+		refs = ref.Refs
+		if ref.Pending {
+			t.Errorf("ref still pending: %+v", ref)
+		}
+	}
+	if refs != wantRefs {
+		t.Errorf("refs = %d, want %d", refs, wantRefs)
+	}
+	if n := f.store.putCount(key); n != wantPuts {
+		t.Errorf("original written %d times, want %d", n, wantPuts)
+	}
+	used := f.users.used(f.userID)
+	if wantUsage && (ref == nil || used != ref.Size) || !wantUsage && used != 0 {
+		t.Errorf("used = %d with ref %+v", used, ref)
+	}
+}
+
+// keyHash es el nombre que save le da a data (ya limpia por imaging)
+func keyHash(t *testing.T, data []byte) string {
+	f := newImageFixture(t, 0)
+	img, err := f.save(t, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, name, _ := strings.Cut(img.Key, "/")
+	return name
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"view-list/internal/domain"
+	"view-list/internal/jobs"
+	"view-list/internal/storage"
+)
+
+const JobCleanJobFiles = "clean_job_files"
+
+// JobFileCleaner borra los archivos de import/export más viejos que ttl:
+// los exports que nadie bajó y los imports de jobs que quedaron dead.
+// Va contra el storage compartido, así que alcanza con que lo corra una instancia.
+type JobFileCleaner struct {
+	store storage.ImageStore
+	ttl   time.Duration
+}
+
+func NewJobFileCleaner(queue *jobs.Queue, store storage.ImageStore, ttl time.Duration) *JobFileCleaner {
+	c := &JobFileCleaner{store: store, ttl: ttl}
+	if queue != nil {
+		queue.Register(JobCleanJobFiles, func(ctx context.Context, job *domain.Job) (map[string]string, error) {
+			removed, err := c.Run(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]string{"removed": fmt.Sprint(removed)}, nil
+		})
+	}
+	return c
+}
+
+// Run hace una pasada y devuelve cuántos archivos borró
+func (c *JobFileCleaner) Run(ctx context.Context) (int, error) {
+	objects, err := c.store.List(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-c.ttl)
+	removed := 0
+	var lastErr error
+	for _, obj := range objects {
+		if ctx.Err() != nil {
+			return removed, ctx.Err()
+		}
+		if obj.ModTime.After(cutoff) {
+			continue
+		}
+		if err := c.store.Delete(ctx, obj.Key); err != nil {
+			lastErr = err
+			continue
+		}
+		removed++
+	}
+	return removed, lastErr
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"view-list/internal/storage"
+)
+
+func TestJobFileCleaner(t *testing.T) {
+	dir := t.TempDir()
+	store := storage.NewLocalStore(dir)
+	ctx := context.Background()
+
+	for _, key := range []string{"import_old.bson", "export_old.bson", "export_new.bson"} {
+		if err := store.Put(ctx, key, strings.NewReader("data"), 4, "application/octet-stream"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	for _, key := range []string{"import_old.bson", "export_old.bson"} {
+		if err := os.Chtimes(filepath.Join(dir, key), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := NewJobFileCleaner(nil, store, time.Hour).Run(ctx)
+	if err != nil || removed != 2 {
+		t.Fatalf("Run = %d, %v; want 2", removed, err)
+	}
+	left, _ := store.List(ctx, "")
+	if len(left) != 1 || left[0].Key != "export_new.bson" {
+		t.Fatalf("left %+v, want only export_new.bson", left)
+	}
+}
+
+func TestJobFileKey(t *testing.T) {
+	for file, want := range map[string]string{
+		"export_1.bson":                  "export_1.bson",
+		"data/jobs/import_2.bson":        "import_2.bson", // payload de versiones anteriores
+		"/srv/app/data/jobs/import.bson": "import.bson",
+	} {
+		if got := jobFileKey(file); got != want {
+			t.Errorf("jobFileKey(%q) = %q, want %q", file, got, want)
+		}
+	}
+}
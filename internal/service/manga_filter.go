@@ -0,0 +1,221 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"view-list/internal/domain"
+	"view-list/internal/query"
+	"view-list/internal/search"
+)
+
+// validateFilter chequea lo que el parser no sabe (ej: que los estados existan para el usuario
+// o que el tipo sea uno de los conocidos)
+func validateFilter(f query.Node, states []domain.ReadingState) error {
+	var err error
+	query.Walk(f, func(n query.Node) bool {
+		c, ok := n.(query.Cond)
+		if !ok {
+			return true
+		}
+		for _, s := range c.Strings {
+			switch {
+			case c.Field == query.FieldState && findState(states, domain.MangaState(s)) < 0:
+				err = fmt.Errorf("%w: unknown state %q", query.ErrSyntax, s)
+			case c.Field == query.FieldKind && !domain.IsValidMediaKind(domain.MediaKind(s)):
+				err = fmt.Errorf("%w: unknown kind %q (use manga, anime, novel, tv or game)", query.ErrSyntax, s)
+			case c.Field == query.FieldType && (s == "" || !domain.IsValidSeriesType(domain.SeriesType(s))):
+				err = fmt.Errorf("%w: unknown type %q (use manga, manhwa, manhua, webtoon or light_novel)", query.ErrSyntax, s)
+			case c.Field == query.FieldDemographic && (s == "" || !domain.IsValidDemographic(domain.Demographic(s))):
+				err = fmt.Errorf("%w: unknown demographic %q", query.ErrSyntax, s)
+			}
+		}
+		return err == nil
+	})
+	return err
+}
+
+// matchFilter evalúa el filtro completo sobre un manga, incluida la búsqueda libre que el repo no aplica
+func matchFilter(m *domain.Manga, n query.Node) bool {
+	switch v := n.(type) {
+	case nil:
+		return true
+	case query.And:
+		for _, c := range v.Nodes {
+			if !matchFilter(m, c) {
+				return false
+			}
+		}
+		return true
+	case query.Or:
+		for _, c := range v.Nodes {
+			if matchFilter(m, c) {
+				return true
+			}
+		}
+		return false
+	case query.Not:
+		return !matchFilter(m, v.Node)
+	case query.Text:
+		return search.Parse(v.Value).Score(searchFields(m)) > 0
+	case query.Cond:
+		return matchCond(m, v)
+	}
+	return false
+}
+
+func matchCond(m *domain.Manga, c query.Cond) bool {
+	switch c.Field {
+	case query.FieldKind:
+		return containsFolded([]string{string(m.MediaKind())}, c.Strings, false)
+	case query.FieldState:
+		return containsFolded([]string{string(m.State)}, c.Strings, false)
+	case query.FieldGenre:
+		return containsFolded(m.Genre, c.Strings, c.Op == query.OpAll)
+	case query.FieldLink:
+		return m.Link != ""
+	case query.FieldImage:
+		return m.Image != ""
+	case query.FieldAuthor:
+		return containsFolded(m.Authors, c.Strings, false) || containsFolded(m.Artists, c.Strings, false)
+	case query.FieldType:
+		return containsFolded([]string{string(m.Type)}, c.Strings, false)
+	case query.FieldDemographic:
+		return containsFolded([]string{string(m.Demographic)}, c.Strings, false)
+	case query.FieldLanguage:
+		return containsFolded([]string{m.OriginalLanguage}, c.Strings, false)
+	case query.FieldYear:
+		return m.StartYear > 0 && compare(float64(m.StartYear), c.Number, c.Op)
+	case query.FieldReview:
+		return m.Review != ""
+	case query.FieldChapter:
+		return compare(m.Chapter, c.Number, c.Op)
+	case query.FieldScore:
+		// Igual que en el repo: sin puntaje no cumple ninguna comparación
+		return m.Score > 0 && (c.Op == query.OpExists || compare(m.Score, c.Number, c.Op))
+	case query.FieldCreated:
+		return compare(float64(m.CreatedAt.UnixNano()), float64(c.Time.UnixNano()), c.Op)
+	case query.FieldUpdated:
+		return compare(float64(m.UpdatedAt.UnixNano()), float64(c.Time.UnixNano()), c.Op)
+	}
+	return false
+}
+
+// Igual que la collation del repo: sin mayúsculas ni acentos
+func containsFolded(have, want []string, all bool) bool {
+	set := make(map[string]bool, len(have))
+	for _, h := range have {
+		set[strings.TrimSpace(search.Normalize(h))] = true
+	}
+	for _, w := range want {
+		found := set[strings.TrimSpace(search.Normalize(w))]
+		if all && !found {
+			return false
+		}
+		if !all && found {
+			return true
+		}
+	}
+	return all
+}
+
+func compare(a, b float64, op query.Op) bool {
+	switch op {
+	case query.OpEq:
+		return a == b
+	case query.OpLt:
+		return a < b
+	case query.OpLte:
+		return a <= b
+	case query.OpGt:
+		return a > b
+	case query.OpGte:
+		return a >= b
+	}
+	return false
+}
+
+// applyFilter termina de filtrar lo que trajo el repo y, si hay búsqueda libre, ordena por relevancia
+func applyFilter(mangas []domain.Manga, f query.Node) []domain.Manga {
+	if !query.HasText(f) {
+		return mangas
+	}
+
+	var queries []*search.Query
+	for _, t := range query.PositiveText(f) {
+		queries = append(queries, search.Parse(t))
+	}
+
+	type scored struct {
+		manga domain.Manga
+		score float64
+	}
+	var out []scored
+	for i := range mangas {
+		if !matchFilter(&mangas[i], f) {
+			continue
+		}
+		fields := searchFields(&mangas[i])
+		score := 0.0
+		for _, q := range queries {
+			score += q.Score(fields)
+		}
+		out = append(out, scored{manga: mangas[i], score: score})
+	}
+	// A igual relevancia queda el orden del repo (más recientes primero)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].score > out[j].score })
+
+	result := make([]domain.Manga, len(out))
+	for i, s := range out {
+		result[i] = s.manga
+	}
+	return result
+}
+
+// CountFacets cuenta estados y géneros, y promedia los puntajes, en memoria, igual que el $facet del repo de Mongo.
+// Los géneros se agrupan sin mayúsculas ni acentos y se muestran como aparecen primero.
+func CountFacets(mangas []domain.Manga) *domain.Facets {
+	facets := domain.NewFacets()
+	index := map[string]int{}
+	var total float64
+	sums := map[int]float64{}
+	scored := map[int]int{}
+	for _, m := range mangas {
+		facets.States[m.State]++
+		facets.Kinds[m.MediaKind()]++
+		if m.Score > 0 {
+			facets.Scored++
+			total += m.Score
+		}
+		for _, g := range m.Genre {
+			key := strings.TrimSpace(search.Normalize(g))
+			i, ok := index[key]
+			if ok {
+				facets.Genres[i].Count++
+			} else {
+				i = len(facets.Genres)
+				index[key] = i
+				facets.Genres = append(facets.Genres, domain.GenreCount{Genre: g, Count: 1})
+			}
+			if m.Score > 0 {
+				sums[i] += m.Score
+				scored[i]++
+			}
+		}
+	}
+	if facets.Scored > 0 {
+		avg := total / float64(facets.Scored)
+		facets.AvgScore = &avg
+	}
+	for i, n := range scored {
+		avg := sums[i] / float64(n)
+		facets.Genres[i].AvgScore = &avg
+	}
+	sort.SliceStable(facets.Genres, func(i, j int) bool {
+		if facets.Genres[i].Count != facets.Genres[j].Count {
+			return facets.Genres[i].Count > facets.Genres[j].Count
+		}
+		return facets.Genres[i].Genre < facets.Genres[j].Genre
+	})
+	return facets
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"view-list/internal/domain"
+	"view-list/internal/storage"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Tipos de job que maneja MangaService
+const (
+	JobDeleteImage       = "delete_image"
+	JobRemoveUserUploads = "remove_user_uploads"
+	JobImportMangas      = "import_mangas"
+	JobExportMangas      = "export_mangas"
+)
+
+var (
+	ErrExportNotReady = errors.New("Export is not ready yet")
+	ErrExportExpired  = errors.New("Export file expired, queue a new export")
+)
+
+func (s *MangaService) registerJobs() {
+	s.queue.Register(JobDeleteImage, func(ctx context.Context, job *domain.Job) (map[string]string, error) {
+		// Entre que se encoló y ahora alguien pudo subir la misma imagen: DeleteIfUnused lo vuelve a mirar
+		return nil, s.images.DeleteIfUnused(ctx, job.Payload["key"], "job:"+job.ID.Hex())
+	})
+
+	// Jobs encolados por versiones anteriores de DeleteAll. Ahora cada manga suelta su referencia
+	// y los archivos sin ninguna se borran con JobDeleteImage; lo que haya quedado lo levanta el GC de uploads.
+	s.queue.Register(JobRemoveUserUploads, func(ctx context.Context, job *domain.Job) (map[string]string, error) {
+		return map[string]string{"skipped": "true"}, nil
+	})
+
+	s.queue.Register(JobImportMangas, func(ctx context.Context, job *domain.Job) (map[string]string, error) {
+		key := jobFileKey(job.Payload["file"])
+		data, err := s.readJobFile(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		imported, err := s.ImportUserMangas(ctx, job.Payload["user_id"], data, job.ID)
+		if err != nil {
+			return nil, err
+		}
+		// El backup ya quedó en la db, el archivo no hace falta
+		_ = s.jobFiles.Delete(ctx, key)
+		result := map[string]string{"images_over_quota": fmt.Sprint(imported.OverQuota)}
+		if len(imported.Warnings) > 0 {
+			result["warnings"] = strings.Join(imported.Warnings, "; ")
+		}
+		return result, nil
+	})
+
+	s.queue.Register(JobExportMangas, func(ctx context.Context, job *domain.Job) (map[string]string, error) {
+		data, err := s.ExportUserMangas(ctx, job.Payload["user_id"])
+		if err != nil {
+			return nil, err
+		}
+		key := "export_" + job.ID.Hex() + ".bson"
+		if err := s.writeJobFile(ctx, key, data); err != nil {
+			return nil, err
+		}
+		return map[string]string{"file": key}, nil
+	})
+}
+
+// QueueImport guarda el backup en el storage de jobs y encola su importación.
+// Lo puede levantar cualquier instancia, por eso no va al disco local.
+func (s *MangaService) QueueImport(ctx context.Context, userID string, data []byte) (*domain.Job, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	key := "import_" + primitive.NewObjectID().Hex() + ".bson"
+	if err := s.writeJobFile(ctx, key, data); err != nil {
+		return nil, err
+	}
+
+	job, err := s.queue.Enqueue(ctx, JobImportMangas, objID, map[string]string{"user_id": userID, "file": key})
+	if err != nil {
+		_ = s.jobFiles.Delete(ctx, key)
+		return nil, err
+	}
+	return job, nil
+}
+
+// QueueExport encola la generación del backup; se descarga con ExportFile cuando termina
+func (s *MangaService) QueueExport(ctx context.Context, userID string) (*domain.Job, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.queue.Enqueue(ctx, JobExportMangas, objID, map[string]string{"user_id": userID})
+}
+
+// GetUserJob devuelve un job solo si pertenece al usuario
+func (s *MangaService) GetUserJob(ctx context.Context, userID string, jobID primitive.ObjectID) (*domain.Job, error) {
+	job, err := s.queue.GetByID(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.UserID.Hex() != userID {
+		return nil, errors.New("Job not found")
+	}
+	return job, nil
+}
+
+// ExportFile abre el backup generado por un job de export terminado
+func (s *MangaService) ExportFile(ctx context.Context, userID string, jobID primitive.ObjectID) (io.ReadCloser, *storage.ObjectInfo, error) {
+	job, err := s.GetUserJob(ctx, userID, jobID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if job.Type != JobExportMangas {
+		return nil, nil, errors.New("Job is not an export")
+	}
+	if job.Status != domain.JobStatusDone || job.Result["file"] == "" {
+		return nil, nil, ErrExportNotReady
+	}
+	// Los archivos se borran pasado JOB_FILE_TTL (ver JobFileCleaner)
+	rc, info, err := s.jobFiles.Get(ctx, jobFileKey(job.Result["file"]))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, ErrExportExpired
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return rc, info, nil
+}
+
+func (s *MangaService) writeJobFile(ctx context.Context, key string, data []byte) error {
+	if err := s.jobFiles.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "application/octet-stream"); err != nil {
+		return fmt.Errorf("writing job file %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *MangaService) readJobFile(ctx context.Context, key string) ([]byte, error) {
+	rc, _, err := s.jobFiles.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("reading job file %s: %w", key, err)
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// Los jobs encolados por versiones anteriores guardan el path (DATA_DIR/jobs/<archivo>): me quedo con el nombre
+func jobFileKey(file string) string {
+	return path.Base(filepath.ToSlash(file))
+}
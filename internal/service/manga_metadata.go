@@ -0,0 +1,138 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"view-list/internal/domain"
+	"view-list/internal/search"
+)
+
+const (
+	maxNames     = 20 // títulos alternativos, autores, artistas y fuentes (cada uno)
+	maxNameChars = 300
+	minYear      = 1900
+)
+
+var ErrInvalidMetadata = errors.New("Invalid metadata")
+
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+// validateMetadata limpia los datos de la serie (espacios, repetidos) y chequea que sean coherentes
+func validateMetadata(m *domain.Manga) error {
+	var err error
+	if m.Authors, err = cleanNames("authors", m.Authors); err != nil {
+		return err
+	}
+	if m.Artists, err = cleanNames("artists", m.Artists); err != nil {
+		return err
+	}
+	if m.AltTitles, err = cleanTitles(m.AltTitles); err != nil {
+		return err
+	}
+	if m.Sources, err = cleanSources(m.Sources); err != nil {
+		return err
+	}
+
+	m.Type = domain.SeriesType(strings.ToLower(strings.TrimSpace(string(m.Type))))
+	m.Demographic = domain.Demographic(strings.ToLower(strings.TrimSpace(string(m.Demographic))))
+	m.OriginalLanguage = strings.ToLower(strings.TrimSpace(m.OriginalLanguage))
+	maxYear := time.Now().Year() + 5
+
+	switch {
+	case m.Type != domain.SeriesUnknown && !m.MediaKind().HasVolumes():
+		return fmt.Errorf("%w: type only applies to manga and novels", ErrInvalidMetadata)
+	case !domain.IsValidSeriesType(m.Type):
+		return fmt.Errorf("%w: type must be manga, manhwa, manhua, webtoon or light novel", ErrInvalidMetadata)
+	case !domain.IsValidDemographic(m.Demographic):
+		return fmt.Errorf("%w: demographic must be shounen, shoujo, seinen, josei or kodomo", ErrInvalidMetadata)
+	case m.OriginalLanguage != "" && !languagePattern.MatchString(m.OriginalLanguage):
+		return fmt.Errorf("%w: original_language must be an ISO 639 code (ja, ko, zh)", ErrInvalidMetadata)
+	case m.StartYear != 0 && (m.StartYear < minYear || m.StartYear > maxYear),
+		m.EndYear != 0 && (m.EndYear < minYear || m.EndYear > maxYear):
+		return fmt.Errorf("%w: years must be between %d and %d", ErrInvalidMetadata, minYear, maxYear)
+	case m.StartYear != 0 && m.EndYear != 0 && m.EndYear < m.StartYear:
+		return fmt.Errorf("%w: end_year is before start_year", ErrInvalidMetadata)
+	}
+	return nil
+}
+
+// Sin vacíos ni repetidos (sin mayúsculas ni acentos), en el orden en que vinieron
+func cleanNames(field string, names []string) ([]string, error) {
+	seen := map[string]bool{}
+	var out []string
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		key := search.Normalize(n)
+		if n == "" || seen[key] {
+			continue
+		}
+		if utf8.RuneCountInString(n) > maxNameChars {
+			return nil, fmt.Errorf("%w: %s too long (max %d characters)", ErrInvalidMetadata, field, maxNameChars)
+		}
+		seen[key] = true
+		out = append(out, n)
+	}
+	if len(out) > maxNames {
+		return nil, fmt.Errorf("%w: too many %s (max %d)", ErrInvalidMetadata, field, maxNames)
+	}
+	return out, nil
+}
+
+func cleanTitles(titles []domain.AltTitle) ([]domain.AltTitle, error) {
+	seen := map[string]bool{}
+	var out []domain.AltTitle
+	for _, t := range titles {
+		t.Title = strings.TrimSpace(t.Title)
+		t.Language = strings.ToLower(strings.TrimSpace(t.Language))
+		key := search.Normalize(t.Title)
+		if t.Title == "" || seen[key] {
+			continue
+		}
+		if utf8.RuneCountInString(t.Title) > maxNameChars {
+			return nil, fmt.Errorf("%w: alt_titles too long (max %d characters)", ErrInvalidMetadata, maxNameChars)
+		}
+		if t.Language != "" && !languagePattern.MatchString(t.Language) {
+			return nil, fmt.Errorf("%w: invalid language %q in alt_titles", ErrInvalidMetadata, t.Language)
+		}
+		seen[key] = true
+		out = append(out, t)
+	}
+	if len(out) > maxNames {
+		return nil, fmt.Errorf("%w: too many alt_titles (max %d)", ErrInvalidMetadata, maxNames)
+	}
+	return out, nil
+}
+
+// Solo http(s); si no tiene nombre queda el dominio (ej: "mangadex.org")
+func cleanSources(sources []domain.Source) ([]domain.Source, error) {
+	seen := map[string]bool{}
+	var out []domain.Source
+	for _, src := range sources {
+		src.Name = strings.TrimSpace(src.Name)
+		src.URL = strings.TrimSpace(src.URL)
+		if src.URL == "" || seen[src.URL] {
+			continue
+		}
+		u, err := url.Parse(src.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%w: invalid source url %q", ErrInvalidMetadata, src.URL)
+		}
+		if src.Name == "" {
+			src.Name = strings.TrimPrefix(u.Hostname(), "www.")
+		}
+		if utf8.RuneCountInString(src.Name) > maxNameChars || len(src.URL) > 2048 {
+			return nil, fmt.Errorf("%w: source too long", ErrInvalidMetadata)
+		}
+		seen[src.URL] = true
+		out = append(out, src)
+	}
+	if len(out) > maxNames {
+		return nil, fmt.Errorf("%w: too many sources (max %d)", ErrInvalidMetadata, maxNames)
+	}
+	return out, nil
+}
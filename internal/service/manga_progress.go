@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"view-list/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	maxChapter = 100000
+	maxVolume  = 10000
+)
+
+var ErrInvalidProgress = errors.New("Invalid progress")
+
+// validateProgress redondea a dos decimales (105.5, 12.25) y chequea que todo sea coherente con el tipo
+func validateProgress(m *domain.Manga) error {
+	m.Kind = m.MediaKind()
+	m.Chapter = roundChapter(m.Chapter)
+	m.TotalChapters = roundChapter(m.TotalChapters)
+	unit := m.Kind.Unit()
+
+	switch {
+	case !domain.IsValidMediaKind(m.Kind):
+		return fmt.Errorf("%w: kind must be manga, anime, novel, tv or game", ErrInvalidProgress)
+	case math.IsNaN(m.Chapter) || m.Chapter < 0 || m.Chapter > maxChapter:
+		return fmt.Errorf("%w: %s must be between 0 and %d", ErrInvalidProgress, unit, maxChapter)
+	case math.IsNaN(m.TotalChapters) || m.TotalChapters < 0 || m.TotalChapters > maxChapter:
+		return fmt.Errorf("%w: total must be between 0 and %d", ErrInvalidProgress, maxChapter)
+	case !m.Kind.HasVolumes() && (m.Volume != 0 || m.TotalVolumes != 0):
+		return fmt.Errorf("%w: a %s has no volumes", ErrInvalidProgress, m.Kind)
+	case m.Volume < 0 || m.Volume > maxVolume || m.TotalVolumes < 0 || m.TotalVolumes > maxVolume:
+		return fmt.Errorf("%w: volumes must be between 0 and %d", ErrInvalidProgress, maxVolume)
+	case m.TotalChapters > 0 && m.Chapter > m.TotalChapters:
+		return fmt.Errorf("%w: %s %g is past the total of %g", ErrInvalidProgress, unit, m.Chapter, m.TotalChapters)
+	case m.TotalVolumes > 0 && m.Volume > m.TotalVolumes:
+		return fmt.Errorf("%w: volume %d is past the total of %d", ErrInvalidProgress, m.Volume, m.TotalVolumes)
+	case !domain.IsValidPublicationStatus(m.PublicationStatus):
+		return fmt.Errorf("%w: publication_status must be ongoing, completed, hiatus or cancelled", ErrInvalidProgress)
+	}
+	return nil
+}
+
+func roundChapter(n float64) float64 {
+	return math.Round(n*100) / 100
+}
+
+// autoComplete pasa el manga al estado terminado cuando el capítulo llega al último conocido.
+// No lo hace si el update ya trae un estado, si la serie sigue saliendo (el "último" es solo el
+// último publicado) o si ya está en un estado de categoría finished.
+func (s *MangaService) autoComplete(ctx context.Context, before, after *domain.Manga, updates bson.M) error {
+	if _, explicit := updates["state"]; explicit {
+		return nil
+	}
+	if _, changed := updates["chapter"]; !changed || after.TotalChapters <= 0 || after.Chapter < after.TotalChapters {
+		return nil
+	}
+	if after.PublicationStatus == domain.PublicationOngoing || after.PublicationStatus == domain.PublicationHiatus {
+		return nil
+	}
+
+	states, err := s.states.States(ctx, before.UserID.Hex())
+	if err != nil {
+		return err
+	}
+	target := finishedState(states)
+	if target == "" {
+		return nil // el usuario no tiene ningún estado de terminado
+	}
+	if i := findState(states, before.State); i >= 0 && states[i].Category == domain.CategoryFinished {
+		return nil
+	}
+	updates["state"] = target
+	return nil
+}
+
+// El estado "completed" si existe; si no, el primero de categoría finished
+func finishedState(states []domain.ReadingState) domain.MangaState {
+	var first domain.MangaState
+	for _, st := range states {
+		if st.Category != domain.CategoryFinished {
+			continue
+		}
+		if st.Key == domain.MangaStateCompleted {
+			return st.Key
+		}
+		if first == "" {
+			first = st.Key
+		}
+	}
+	return first
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+	"view-list/internal/domain"
+	"view-list/internal/query"
+)
+
+const maxReview = 20000 // caracteres
+
+var ErrInvalidScore = errors.New("Invalid score")
+
+// ScoreScale es la escala del usuario; si no se puede leer se usa la por defecto (solo afecta cómo se muestra)
+func (s *MangaService) ScoreScale(ctx context.Context, userID string) domain.ScoreScale {
+	scale, err := s.scores.Scale(ctx, userID)
+	if err != nil {
+		return domain.DefaultScoreScale
+	}
+	return scale
+}
+
+// NormalizeScore pasa un puntaje en la escala del usuario a 0-100. 0 es "sin puntaje".
+func (s *MangaService) NormalizeScore(ctx context.Context, userID string, score float64) (float64, error) {
+	if score == 0 {
+		return 0, nil
+	}
+	scale, err := s.scores.Scale(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := scale.Normalize(score)
+	if !ok {
+		return 0, fmt.Errorf("%w: must be between %g and %g in steps of %g (0 removes it)", ErrInvalidScore, scale.Step(), scale.Max(), scale.Step())
+	}
+	return n, nil
+}
+
+func validateReview(m *domain.Manga) error {
+	if m.Score < 0 || m.Score > 100 {
+		return fmt.Errorf("%w: out of range", ErrInvalidScore)
+	}
+	if utf8.RuneCountInString(m.Review) > maxReview {
+		return fmt.Errorf("review too long (max %d characters)", maxReview)
+	}
+	return nil
+}
+
+// scaleFilter pasa los score del filtro (en la escala del usuario) a 0-100 como están guardados
+func scaleFilter(f query.Node, scale domain.ScoreScale) query.Node {
+	return query.MapConds(f, func(c query.Cond) query.Cond {
+		if c.Field == query.FieldScore && c.Op != query.OpExists {
+			c.Number = scale.ToNormalized(c.Number)
+		}
+		return c
+	})
+}
+
+func presentScores(facets *domain.Facets, scale domain.ScoreScale) {
+	if facets.AvgScore != nil {
+		v := scale.Average(*facets.AvgScore)
+		facets.AvgScore = &v
+	}
+	for i := range facets.Genres {
+		if avg := facets.Genres[i].AvgScore; avg != nil {
+			v := scale.Average(*avg)
+			facets.Genres[i].AvgScore = &v
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"strings"
+	"view-list/internal/domain"
+	"view-list/internal/search"
+)
+
+// La búsqueda libre se puntúa en memoria: el repo trae los mangas del usuario que cumplen el
+// resto del filtro (ver applyFilter) y acá se compara el texto con internal/search. No hay índice
+// de texto en Mongo; alcanza porque cada búsqueda es sobre la lista de un solo usuario.
+
+// Pesos de cada campo en la búsqueda: un acierto en el nombre vale más que en la descripción
+const (
+	weightName        = 3
+	weightGenre       = 2
+	weightPeople      = 2 // autores y artistas
+	weightDescription = 1
+)
+
+// Campos donde busca el texto libre de los filtros (query.Text). Cada título alternativo va
+// aparte y con el peso del nombre: "Attack on Titan" encuentra a "Shingeki no Kyojin".
+func searchFields(m *domain.Manga) []search.Field {
+	fields := []search.Field{
+		{Text: m.Name, Weight: weightName},
+		{Text: strings.Join(m.Genre, " "), Weight: weightGenre},
+		{Text: strings.Join(append(append([]string{}, m.Authors...), m.Artists...), " "), Weight: weightPeople},
+		{Text: m.Description, Weight: weightDescription},
+	}
+	for _, t := range m.AltTitles {
+		fields = append(fields, search.Field{Text: t.Title, Weight: weightName})
+	}
+	return fields
+}
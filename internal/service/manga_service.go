@@ -2,36 +2,194 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"strings"
 	"time"
 	"view-list/internal/domain"
-	"view-list/internal/utils"
+	"view-list/internal/jobs"
+	"view-list/internal/query"
+	"view-list/internal/storage"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type MangaService struct {
-	mgRepo domain.MangaRepo
+	mgRepo   domain.MangaRepo
+	colRepo  domain.CollectionRepo
+	states   *StateService
+	scores   *ScoreService
+	queue    *jobs.Queue
+	images   *ImageService
+	jobFiles storage.ImageStore // archivos de import/export de los jobs, compartidos entre instancias
 }
 
-func NewMangaService(mgRepo domain.MangaRepo) *MangaService {
-	return &MangaService{mgRepo: mgRepo}
+func NewMangaService(mgRepo domain.MangaRepo, colRepo domain.CollectionRepo, states *StateService, scores *ScoreService, queue *jobs.Queue, images *ImageService, jobFiles storage.ImageStore) *MangaService {
+	s := &MangaService{mgRepo: mgRepo, colRepo: colRepo, states: states, scores: scores, queue: queue, images: images, jobFiles: jobFiles}
+	s.registerJobs()
+	return s
+}
+
+// Guarda una imagen base64 en la carpeta del usuario y devuelve su URL pública y las de sus variantes
+func (s *MangaService) SaveImage(ctx context.Context, base64Data, userID string) (*StoredImage, error) {
+	return s.images.SaveBase64(ctx, userID, base64Data)
+}
+
+// StoreImage guarda la portada que viene en un create/update: base64 siempre, una URL externa
+// solo si pidieron bajarla (fetchRemote). Devuelve nil si la imagen queda como vino.
+func (s *MangaService) StoreImage(ctx context.Context, image string, fetchRemote bool, userID string) (*StoredImage, error) {
+	if strings.HasPrefix(image, "data:image") {
+		return s.images.SaveBase64(ctx, userID, image)
+	}
+	// Una imagen nuestra (ej: la URL firmada que devolvió la API): se guarda la URL limpia y suma una referencia
+	if key, ok := s.images.Key(image, userID); ok {
+		return s.images.Reuse(ctx, userID, key)
+	}
+	if fetchRemote && (strings.HasPrefix(image, "http://") || strings.HasPrefix(image, "https://")) {
+		return s.images.SaveRemote(ctx, userID, image)
+	}
+	return nil, nil
+}
+
+// Present cambia las keys guardadas de la portada y sus variantes por URLs públicas firmadas,
+// armadas con la configuración actual, y pasa el puntaje a la escala del usuario. Es solo para
+// la respuesta: el manga no se vuelve a guardar.
+func (s *MangaService) Present(m *domain.Manga, scale domain.ScoreScale) {
+	m.Kind = m.MediaKind()
+	m.Unit = m.Kind.Unit()
+	if pct, ok := m.Completion(); ok {
+		m.Progress = &pct
+	}
+	if m.Score > 0 {
+		score := scale.Display(m.Score)
+		m.ScoreDisplay = &score
+	}
+	owner := m.UserID.Hex()
+	m.Image = s.images.ResolveURL(m.Image, owner)
+	variants := make(map[string]string, len(m.Variants))
+	for name, key := range m.Variants {
+		variants[name] = s.images.ResolveURL(key, owner)
+	}
+	if len(variants) > 0 {
+		m.Variants = variants
+	}
+}
+
+// ImageURLs son las URLs públicas de una portada recién guardada
+type ImageURLs struct {
+	Image    string            `json:"image"`
+	Variants map[string]string `json:"variants,omitempty"`
+}
+
+func (s *MangaService) ImageURLs(img *StoredImage, userID string) ImageURLs {
+	urls := ImageURLs{Image: s.images.ResolveURL(img.Key, userID)}
+	for name, key := range img.Variants {
+		if urls.Variants == nil {
+			urls.Variants = make(map[string]string, len(img.Variants))
+		}
+		urls.Variants[name] = s.images.ResolveURL(key, userID)
+	}
+	return urls
+}
+
+func (s *MangaService) PresentAll(mangas []domain.Manga, scale domain.ScoreScale) {
+	for i := range mangas {
+		s.Present(&mangas[i], scale)
+	}
+}
+
+// Suelta la referencia del manga a su imagen y, si era la última, encola el borrado del archivo
+func (s *MangaService) RemoveImageAsync(ctx context.Context, image, userID string) {
+	key, ok := s.images.Key(image, userID)
+	if !ok {
+		return
+	}
+	last, err := s.images.Release(ctx, key)
+	if err != nil {
+		// El archivo queda sin referencias en la db; el GC de uploads lo levanta
+		log.Printf("warning: error releasing image %s: %v\n", key, err)
+		return
+	}
+	if !last {
+		return
+	}
+	if _, err := s.queue.Enqueue(ctx, JobDeleteImage, primitive.NilObjectID, map[string]string{"key": key}); err != nil {
+		log.Printf("warning: error queueing deletion of %s: %v\n", key, err)
+	}
+}
+
+var ErrMangaNotFound = errors.New("Manga not found")
+
+// Trae el manga solo si es del usuario; si no, responde como si no existiera
+func (s *MangaService) GetOwned(ctx context.Context, id primitive.ObjectID, userID string) (*domain.Manga, error) {
+	manga, err := s.mgRepo.GetByID(ctx, id)
+	if err != nil || manga.UserID.Hex() != userID {
+		return nil, ErrMangaNotFound
+	}
+	return manga, nil
+}
+
+// SetCover reemplaza la portada con una imagen binaria y encola el borrado de la anterior
+func (s *MangaService) SetCover(ctx context.Context, id primitive.ObjectID, userID string, r io.Reader) (*StoredImage, error) {
+	manga, err := s.GetOwned(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := s.images.SaveStream(ctx, userID, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.mgRepo.Update(ctx, id, bson.M{"image": img.Key, "variants": img.Variants, "updated_at": time.Now()}); err != nil {
+		s.RemoveImageAsync(ctx, img.Key, userID)
+		return nil, err
+	}
+	if manga.Image != "" {
+		s.RemoveImageAsync(ctx, manga.Image, userID)
+	}
+	return img, nil
+}
+
+// RemoveCover deja el manga sin portada
+func (s *MangaService) RemoveCover(ctx context.Context, id primitive.ObjectID, userID string) error {
+	manga, err := s.GetOwned(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.mgRepo.Update(ctx, id, bson.M{"image": "", "variants": nil, "updated_at": time.Now()}); err != nil {
+		return err
+	}
+	if manga.Image != "" {
+		s.RemoveImageAsync(ctx, manga.Image, userID)
+	}
+	return nil
 }
 
 func (s *MangaService) Create(ctx context.Context, manga *domain.Manga, userID string) error {
-	// 1.0 Valido que el estado esté contemplado
-	if !domain.IsValidMangaState(manga.State) {
-		return errors.New("Invalid manga state")
+	// 1.0 Valido que el estado sea uno de los del usuario
+	if err := s.states.Validate(ctx, userID, manga.State); err != nil {
+		return err
 	}
 
 	// 1.1 Valido que el nombre no esté vacío
 	if manga.Name == "" {
 		return errors.New("Name cannot be empty")
 	}
+	if err := validateProgress(manga); err != nil {
+		return err
+	}
+	if err := validateReview(manga); err != nil {
+		return err
+	}
+	if err := validateMetadata(manga); err != nil {
+		return err
+	}
 	// 1.2 Asigno el userID
 	objID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
@@ -46,30 +204,113 @@ func (s *MangaService) GetByID(ctx context.Context, id primitive.ObjectID) (*dom
 	return s.mgRepo.GetByID(ctx, id)
 }
 
-func (s *MangaService) ListAll(ctx context.Context, userID, state, search string) ([]domain.Manga, error) {
+// ListAll lista los mangas del usuario que cumplen el filtro (nil = todos). Con búsqueda libre
+// vienen ordenados por relevancia; si no, más recientes primero.
+func (s *MangaService) ListAll(ctx context.Context, userID string, f query.Node) ([]domain.Manga, error) {
 	objID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		return nil, err
 	}
-	return s.mgRepo.List(ctx, objID, state, search)
+	states, err := s.states.States(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateFilter(f, states); err != nil {
+		return nil, err
+	}
+	scale, err := s.scores.Scale(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	f = scaleFilter(f, scale)
+	mangas, err := s.mgRepo.Filter(ctx, objID, f)
+	if err != nil {
+		return nil, err
+	}
+	return applyFilter(mangas, f), nil
+}
+
+// ListWithFacets es ListAll más los conteos por género de esos resultados y por estado
+// sin el filtro de estado (las pestañas muestran cuántos hay en cada una)
+func (s *MangaService) ListWithFacets(ctx context.Context, userID string, f query.Node) ([]domain.Manga, *domain.Facets, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	states, err := s.states.States(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := validateFilter(f, states); err != nil {
+		return nil, nil, err
+	}
+	scale, err := s.scores.Scale(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	f = scaleFilter(f, scale)
+	mangas, facets, err := s.mgRepo.FilterFacets(ctx, objID, f)
+	if err != nil {
+		return nil, nil, err
+	}
+	if query.HasText(f) {
+		// Con búsqueda libre el repo trae de más: se cuenta sobre lo que quedó
+		mangas = applyFilter(mangas, f)
+		facets = CountFacets(mangas)
+		if query.HasField(f, query.FieldState) {
+			// Los estados van sin las condiciones de estado (como en el repo): hace falta otra lista
+			withoutState := query.Without(f, query.FieldState)
+			all, err := s.mgRepo.Filter(ctx, objID, withoutState)
+			if err != nil {
+				return nil, nil, err
+			}
+			facets.States = CountFacets(applyFilter(all, withoutState)).States
+		}
+	}
+	facets.FillStates(states)
+	presentScores(facets, scale)
+	return mangas, facets, nil
 }
 
 func (s *MangaService) Update(ctx context.Context, id primitive.ObjectID, updates bson.M) error {
 	// 1.0 Valido que el manga exista
-	_, err := s.mgRepo.GetByID(ctx, id)
+	manga, err := s.mgRepo.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	// 1.1 Valido los states
+	// 1.1 Valido los states (los del dueño del manga)
 	if val, ok := updates["state"]; ok {
 		state := domain.MangaState(fmt.Sprint(val)) // Convierte a strign
-		if !domain.IsValidMangaState(state) {
-			return errors.New("Invalid manga state")
+		if err := s.states.Validate(ctx, manga.UserID.Hex(), state); err != nil {
+			return err
 		}
 		updates["state"] = state // Normalización
 	}
 
+	// 1.2 Se valida el resultado final (ej: chapter contra el total ya guardado)
+	after, err := mergeUpdates(manga, updates)
+	if err != nil {
+		return err
+	}
+	if err := validateProgress(&after); err != nil {
+		return err
+	}
+	if err := validateReview(&after); err != nil {
+		return err
+	}
+	if err := validateMetadata(&after); err != nil {
+		return err
+	}
+	if err := syncUpdates(&after, updates); err != nil {
+		return err
+	}
+
+	// 1.3 Si llegó al último capítulo pasa a terminado
+	if err := s.autoComplete(ctx, manga, &after, updates); err != nil {
+		return err
+	}
+
 	return s.mgRepo.Update(ctx, id, updates)
 }
 
@@ -80,17 +321,37 @@ func (s *MangaService) Delete(ctx context.Context, id primitive.ObjectID) error
 		return err
 	}
 
-	if manga.Image != "" && strings.HasPrefix(manga.Image, "/uploads/") {
-		filePath := "." + manga.Image
-		go func() {
-			time.Sleep(200 * time.Millisecond) // Más rápido pero suficiente
-			if err := utils.DeleteFileWithRetry(filePath, 8); err != nil {
-				log.Printf("warning: error deleting file %s: %v\n", filePath, err)
-			}
-		}()
+	if err := s.mgRepo.Delete(ctx, id); err != nil {
+		return err
 	}
+	// La portada se suelta recién con el manga borrado: si el borrado falla sigue en uso
+	if manga.Image != "" {
+		s.RemoveImageAsync(ctx, manga.Image, manga.UserID.Hex())
+	}
+	// Si esto falla el manga igual ya no aparece en las colecciones (se ignoran los que no existen)
+	if err := s.colRepo.RemoveManga(ctx, id); err != nil {
+		log.Printf("warning: error removing manga %s from collections: %v\n", id.Hex(), err)
+	}
+	return nil
+}
 
-	return s.mgRepo.Delete(ctx, id)
+// DeleteKind borra todo lo de un tipo (DELETE /api/mangas solo borra los mangas). A diferencia
+// de DeleteAll va de a uno, así cada portada suelta su referencia y los demás tipos no se tocan.
+func (s *MangaService) DeleteKind(ctx context.Context, userID string, kind domain.MediaKind) error {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+	items, err := s.mgRepo.Filter(ctx, objID, query.Cond{Field: query.FieldKind, Op: query.OpIn, Strings: []string{string(kind)}})
+	if err != nil {
+		return err
+	}
+	for _, m := range items {
+		if err := s.Delete(ctx, m.ID); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *MangaService) DeleteAll(ctx context.Context, userID string) error {
@@ -99,14 +360,28 @@ func (s *MangaService) DeleteAll(ctx context.Context, userID string) error {
 		return err
 	}
 
-	// 1. borro los datos de monog
-	if err := s.mgRepo.DeleteAll(ctx, objID); err != nil {
+	// 1. Las portadas se sueltan de a una, como al borrar cada manga: la misma imagen puede
+	// estar en uso por un import que entró recién, y solo se borra si era la última referencia
+	mangas, err := s.mgRepo.List(ctx, objID, "")
+	if err != nil {
 		return err
 	}
 
-	// 2. Borrar archivos de forma asíncrona (no bloquea la respuesta)
-	utils.RemoveUserUploadsAsync(userID)
+	// 2. borro los datos de monog
+	if err := s.mgRepo.DeleteAll(ctx, objID); err != nil {
+		return err
+	}
+	// Las colecciones quedan, vacías
+	if err := s.colRepo.RemoveUserItems(ctx, objID); err != nil {
+		log.Printf("warning: error emptying collections of user %s: %v\n", userID, err)
+	}
 
+	// 3. Los archivos sin referencias se borran en segundo plano (no bloquea la respuesta)
+	for _, m := range mangas {
+		if m.Image != "" {
+			s.RemoveImageAsync(ctx, m.Image, userID)
+		}
+	}
 	return nil
 }
 
@@ -116,14 +391,15 @@ func (s *MangaService) ExportUserMangas(ctx context.Context, userID string) ([]b
 		return nil, err
 	}
 
-	mangas, err := s.mgRepo.List(ctx, objID, "", "")
+	mangas, err := s.mgRepo.List(ctx, objID, "")
 	if err != nil {
 		return nil, err
 	}
 
 	for i := range mangas {
+		mangas[i].Variants = nil // se regeneran al importar
 		if mangas[i].Image != "" {
-			b64, err := utils.ImageToBase64(mangas[i].Image)
+			b64, err := s.images.ToBase64(ctx, mangas[i].Image, userID)
 
 			if err == nil {
 				mangas[i].Image = b64
@@ -131,7 +407,13 @@ func (s *MangaService) ExportUserMangas(ctx context.Context, userID string) ([]b
 		}
 	}
 
-	data, err := bson.Marshal(bson.M{"mangas": mangas})
+	// Los estados van en el backup para no perder labels, colores y categorías de los propios
+	states, err := s.states.States(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := bson.Marshal(bson.M{"mangas": mangas, "states": states})
 	if err != nil {
 		return nil, err
 	}
@@ -139,48 +421,146 @@ func (s *MangaService) ExportUserMangas(ctx context.Context, userID string) ([]b
 	return data, nil
 }
 
-func (s *MangaService) ImportUserMangas(ctx context.Context, userID string, data []byte) error {
+// ImportResult es lo que deja una importación en el resultado del job
+type ImportResult struct {
+	OverQuota int      // portadas que quedaron afuera por la cuota: esos mangas se importan igual, sin imagen
+	Warnings  []string // estados del backup que no se pudieron agregar y a cuál se pasaron sus mangas
+}
+
+// ImportUserMangas inserta los mangas de un backup. Es idempotente por jobID: cada manga recibe un ID
+// derivado del job y de su posición, así un reintento (o el mismo job retomado al vencer el lock)
+// saltea los que ya entraron sin volver a guardar sus portadas ni sumar referencias.
+func (s *MangaService) ImportUserMangas(ctx context.Context, userID string, data []byte, jobID primitive.ObjectID) (*ImportResult, error) {
 	objID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var wrapper struct {
-		Mangas []domain.Manga `bson:"mangas"`
+		Mangas []domain.Manga        `bson:"mangas"`
+		States []domain.ReadingState `bson:"states"` // backups viejos no lo tienen
 	}
 
 	if err := bson.Unmarshal(data, &wrapper); err != nil {
-		return err
+		return nil, err
+	}
+
+	// Los estados del backup que el usuario no tiene se agregan; los que no se pueden (inválidos o
+	// sin lugar) pasan al estado por defecto, así ningún manga queda con uno inválido
+	keys := make([]domain.MangaState, len(wrapper.Mangas))
+	for i, m := range wrapper.Mangas {
+		keys[i] = m.State
+	}
+	mapping, warnings, err := s.states.Ensure(ctx, userID, wrapper.States, keys)
+	if err != nil {
+		return nil, err
+	}
+	result := &ImportResult{Warnings: warnings}
+	for i := range wrapper.Mangas {
+		wrapper.Mangas[i].State = mapping[wrapper.Mangas[i].State]
 	}
 
+	ids := make([]primitive.ObjectID, len(wrapper.Mangas))
 	for i := range wrapper.Mangas {
-		m := &wrapper.Mangas[i]
+		ids[i] = importID(jobID, i)
+	}
+	done, err := s.mgRepo.GetByIDs(ctx, objID, ids)
+	if err != nil {
+		return nil, err
+	}
+	imported := make(map[primitive.ObjectID]bool, len(done))
+	for _, m := range done {
+		imported[m.ID] = true
+	}
+
+	pending := make([]domain.Manga, 0, len(wrapper.Mangas))
+	for i := range wrapper.Mangas {
+		if !imported[ids[i]] {
+			wrapper.Mangas[i].ID = ids[i]
+			pending = append(pending, wrapper.Mangas[i])
+		}
+	}
+	if len(pending) == 0 {
+		return result, nil // ya estaba todo
+	}
+
+	overQuota := 0
+	for i := range pending {
+		m := &pending[i]
+		m.Variants = nil // las del backup apuntan a archivos de otra instalación
+		if _, ok := s.images.Key(m.Image, userID); ok || IsStorageKey(m.Image) {
+			// Portada que no se pudo exportar en base64: la key no sirve acá
+			m.Image = ""
+		}
 
 		// ⚙️ Si viene una imagen base64, la guardamos en disco
-		if strings.HasPrefix(m.Image, "data:image/") {
+		if strings.HasPrefix(m.Image, "data:image/") && overQuota > 0 {
+			// Sin lugar: no tiene sentido seguir procesando imágenes
+			m.Image = ""
+			overQuota++
+		} else if strings.HasPrefix(m.Image, "data:image/") {
 			// 🧹 Limpiar posibles saltos de línea o espacios
 			clean := strings.ReplaceAll(m.Image, "\n", "")
 			clean = strings.ReplaceAll(clean, "\r", "")
 			clean = strings.TrimSpace(clean)
 
-			imgPath, err := utils.SaveBase64ImageForUser(clean, userID)
-			if err != nil {
+			img, err := s.SaveImage(ctx, clean, userID)
+			if errors.Is(err, ErrQuotaExceeded) {
+				fmt.Printf("❌ Storage quota exceeded importing mangas of user %s, skipping remaining images\n", userID)
+				m.Image = ""
+				overQuota++
+			} else if err != nil {
 				fmt.Printf("❌ Error saving image for manga %s: %v\n", m.Name, err)
 				m.Image = "" // limpiar si falló
 			} else {
-				m.Image = imgPath
+				m.Image = img.Key
+				m.Variants = img.Variants
 			}
 		}
 
-		// limpiar IDs y asignar usuario actual
-		m.ID = primitive.NilObjectID
 		m.UserID = objID
 	}
 
 	// insertar todos
-	if err := s.mgRepo.BulkInsert(ctx, wrapper.Mangas); err != nil {
-		return err
+	if err := s.mgRepo.BulkInsert(ctx, pending); err != nil {
+		s.releaseNotInserted(context.WithoutCancel(ctx), objID, pending)
+		return nil, err
 	}
 
-	return nil
+	result.OverQuota = overQuota
+	return result, nil
+}
+
+// importID es el ID del manga en la posición i del backup del job: el mismo en cada reintento
+func importID(jobID primitive.ObjectID, i int) primitive.ObjectID {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d", jobID.Hex(), i)))
+	var id primitive.ObjectID
+	copy(id[:4], jobID[:4]) // la fecha del ObjectID queda la del job
+	copy(id[4:], sum[:])
+	return id
+}
+
+// Si el insert falló (o entró a medias), las portadas que se guardaron para los mangas que no quedaron
+// en la db no las usa nadie: se sueltan sus referencias. Las de los que sí entraron quedan.
+func (s *MangaService) releaseNotInserted(ctx context.Context, userID primitive.ObjectID, mangas []domain.Manga) {
+	ids := make([]primitive.ObjectID, len(mangas))
+	for i, m := range mangas {
+		ids[i] = m.ID
+	}
+	inserted, err := s.mgRepo.GetByIDs(ctx, userID, ids)
+	if err != nil {
+		// Quedan con referencias de más; el GC de uploads los levanta
+		log.Printf("warning: error checking imported mangas of user %s: %v\n", userID.Hex(), err)
+		return
+	}
+	in := make(map[primitive.ObjectID]bool, len(inserted))
+	for _, m := range inserted {
+		in[m.ID] = true
+	}
+	for _, m := range mangas {
+		// Después de la limpieza, las únicas keys son las que guardó esta importación
+		if !in[m.ID] && IsStorageKey(m.Image) {
+			s.RemoveImageAsync(ctx, m.Image, userID.Hex())
+		}
+	}
 }
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"view-list/internal/domain"
+	"view-list/internal/search"
+)
+
+// Órdenes aceptados: name, chapter (o current), score, created y updated, con "-" adelante para descendente.
+// Vacío o "relevance" deja el orden del listado (relevancia si hay búsqueda, si no más recientes primero).
+var mangaSorts = map[string]func(a, b *domain.Manga) int{
+	"name": func(a, b *domain.Manga) int {
+		return strings.Compare(search.Normalize(a.Name), search.Normalize(b.Name))
+	},
+	"chapter": func(a, b *domain.Manga) int { return cmpOrdered(a.Chapter, b.Chapter) },
+	"current": func(a, b *domain.Manga) int { return cmpOrdered(a.Chapter, b.Chapter) }, // chapter con el nombre de /api/media
+	"score":   func(a, b *domain.Manga) int { return cmpOrdered(a.Score, b.Score) },
+	"created": func(a, b *domain.Manga) int { return a.CreatedAt.Compare(b.CreatedAt) },
+	"updated": func(a, b *domain.Manga) int { return a.UpdatedAt.Compare(b.UpdatedAt) },
+}
+
+var ErrInvalidSort = errors.New("invalid sort (use name, chapter, score, created or updated, with - for descending)")
+
+func ValidateSort(s string) error {
+	if s == "" || s == "relevance" {
+		return nil
+	}
+	if _, ok := mangaSorts[strings.TrimPrefix(s, "-")]; !ok {
+		return ErrInvalidSort
+	}
+	return nil
+}
+
+// SortMangas ordena en el lugar; a igual valor se mantiene el orden que traían
+func SortMangas(mangas []domain.Manga, s string) {
+	field := strings.TrimPrefix(s, "-")
+	cmp, ok := mangaSorts[field]
+	if !ok {
+		return
+	}
+	desc := strings.HasPrefix(s, "-")
+	sort.SliceStable(mangas, func(i, j int) bool {
+		c := cmp(&mangas[i], &mangas[j])
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+// PinFirst pone primero los mangas fijados (en el orden de pinned) que estén en la lista
+func PinFirst(mangas []domain.Manga, pinned []string) []domain.Manga {
+	if len(pinned) == 0 {
+		return mangas
+	}
+	pos := make(map[string]int, len(pinned))
+	for i, id := range pinned {
+		if _, dup := pos[id]; !dup {
+			pos[id] = i
+		}
+	}
+
+	out := make([]domain.Manga, 0, len(mangas))
+	head := make([]*domain.Manga, len(pinned))
+	for i := range mangas {
+		if p, ok := pos[mangas[i].ID.Hex()]; ok {
+			head[p] = &mangas[i]
+		}
+	}
+	for _, m := range head {
+		if m != nil {
+			out = append(out, *m)
+		}
+	}
+	for _, m := range mangas {
+		if _, ok := pos[m.ID.Hex()]; !ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func cmpOrdered[T ~int | ~float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
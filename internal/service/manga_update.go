@@ -0,0 +1,54 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"view-list/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var ErrInvalidUpdate = errors.New("Invalid update")
+
+// mergeUpdates aplica los updates sobre una copia del manga pasando por bson, así se valida el
+// resultado completo (ej: el capítulo contra el total ya guardado) con los mismos tags que en la db
+func mergeUpdates(m *domain.Manga, updates bson.M) (domain.Manga, error) {
+	var merged domain.Manga
+	raw, err := bson.Marshal(m)
+	if err != nil {
+		return merged, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return merged, err
+	}
+	for key, val := range updates {
+		doc[key] = val
+	}
+	raw, err = bson.Marshal(doc)
+	if err != nil {
+		return merged, fmt.Errorf("%w: %v", ErrInvalidUpdate, err)
+	}
+	if err := bson.Unmarshal(raw, &merged); err != nil {
+		// ej: un volumen con decimales
+		return merged, fmt.Errorf("%w: %v", ErrInvalidUpdate, err)
+	}
+	return merged, nil
+}
+
+// syncUpdates pasa a los updates los valores ya normalizados (redondeados, sin espacios, sin repetidos).
+// Los que quedaron vacíos van como null: en la db es lo mismo que no tenerlos.
+func syncUpdates(m *domain.Manga, updates bson.M) error {
+	raw, err := bson.Marshal(m)
+	if err != nil {
+		return err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	for key := range updates {
+		updates[key] = doc[key]
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Orden manual por posición fraccionaria: al mover un elemento entre otros dos toma el punto
+// medio y se escribe solo ese. Cuando los huecos se achican demasiado se renumera todo.
+const (
+	positionStep   = 1024.0
+	positionMinGap = 1e-6
+)
+
+var (
+	errMovingNotFound = errors.New("element to move not found")
+	errAfterNotFound  = errors.New("element to move after not found")
+)
+
+type positioned struct {
+	id  primitive.ObjectID
+	pos float64
+}
+
+// reorder calcula las posiciones a guardar para dejar moving justo después de after
+// (hex; vacío = primero). ordered viene ordenado por posición e incluye a moving.
+func reorder(ordered []positioned, moving primitive.ObjectID, after string) (map[primitive.ObjectID]float64, error) {
+	rest := make([]positioned, 0, len(ordered))
+	found := false
+	for _, p := range ordered {
+		if p.id == moving {
+			found = true
+			continue
+		}
+		rest = append(rest, p)
+	}
+	if !found {
+		return nil, errMovingNotFound
+	}
+
+	idx := -1 // índice en rest del que queda antes
+	if after != "" {
+		afterID, err := primitive.ObjectIDFromHex(after)
+		if err != nil {
+			return nil, errAfterNotFound
+		}
+		for i, p := range rest {
+			if p.id == afterID {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return nil, errAfterNotFound
+		}
+	}
+
+	var pos float64
+	switch {
+	case len(rest) == 0:
+		pos = positionStep
+	case idx == -1:
+		pos = rest[0].pos - positionStep
+	case idx == len(rest)-1:
+		pos = rest[idx].pos + positionStep
+	default:
+		pos = (rest[idx].pos + rest[idx+1].pos) / 2
+		if pos-rest[idx].pos < positionMinGap || rest[idx+1].pos-pos < positionMinGap {
+			return renumber(rest, moving, idx), nil
+		}
+	}
+	return map[primitive.ObjectID]float64{moving: pos}, nil
+}
+
+// renumber reparte de nuevo todas las posiciones con moving después de rest[idx]
+func renumber(rest []positioned, moving primitive.ObjectID, idx int) map[primitive.ObjectID]float64 {
+	out := make(map[primitive.ObjectID]float64, len(rest)+1)
+	n := 0
+	next := func(id primitive.ObjectID) {
+		n++
+		out[id] = float64(n) * positionStep
+	}
+	if idx == -1 {
+		next(moving)
+	}
+	for i, p := range rest {
+		next(p.id)
+		if i == idx {
+			next(moving)
+		}
+	}
+	return out
+}
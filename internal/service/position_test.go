@@ -0,0 +1,143 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// list arma n elementos con las posiciones que arma renumber
+func list(n int) []positioned {
+	out := make([]positioned, n)
+	for i := range out {
+		out[i] = positioned{id: primitive.NewObjectID(), pos: float64(i+1) * positionStep}
+	}
+	return out
+}
+
+// apply guarda las posiciones nuevas y devuelve la lista ordenada como la leería Mongo
+func apply(ordered []positioned, updates map[primitive.ObjectID]float64) []positioned {
+	out := make([]positioned, len(ordered))
+	for i, p := range ordered {
+		if pos, ok := updates[p.id]; ok {
+			p.pos = pos
+		}
+		out[i] = p
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].pos < out[j].pos })
+	return out
+}
+
+func indexes(ordered, original []positioned) []int {
+	idx := make(map[primitive.ObjectID]int, len(original))
+	for i, p := range original {
+		idx[p.id] = i
+	}
+	out := make([]int, len(ordered))
+	for i, p := range ordered {
+		out[i] = idx[p.id]
+	}
+	return out
+}
+
+func TestReorder(t *testing.T) {
+	tests := []struct {
+		name   string
+		moving int
+		after  int // -1 = primero
+		want   []int
+	}{
+		{"to the start", 3, -1, []int{3, 0, 1, 2, 4}},
+		{"to the end", 0, 4, []int{1, 2, 3, 4, 0}},
+		{"forward", 1, 3, []int{0, 2, 3, 1, 4}},
+		{"backward", 4, 0, []int{0, 4, 1, 2, 3}},
+		{"same place", 2, 1, []int{0, 1, 2, 3, 4}},
+		{"first stays first", 0, -1, []int{0, 1, 2, 3, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ordered := list(5)
+			after := ""
+			if tt.after >= 0 {
+				after = ordered[tt.after].id.Hex()
+			}
+			updates, err := reorder(ordered, ordered[tt.moving].id, after)
+			if err != nil {
+				t.Fatalf("reorder: %v", err)
+			}
+			// Con huecos de sobra solo se escribe el que se mueve
+			if _, ok := updates[ordered[tt.moving].id]; len(updates) != 1 || !ok {
+				t.Fatalf("updates = %v, want only the moved element", updates)
+			}
+			got := indexes(apply(ordered, updates), ordered)
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("order = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestReorderSingle(t *testing.T) {
+	ordered := list(1)
+	updates, err := reorder(ordered, ordered[0].id, "")
+	if err != nil || updates[ordered[0].id] != positionStep {
+		t.Fatalf("reorder = %v, %v", updates, err)
+	}
+}
+
+func TestReorderErrors(t *testing.T) {
+	ordered := list(3)
+	tests := []struct {
+		name   string
+		moving primitive.ObjectID
+		after  string
+		want   error
+	}{
+		{"moving not in the list", primitive.NewObjectID(), "", errMovingNotFound},
+		{"after not in the list", ordered[0].id, primitive.NewObjectID().Hex(), errAfterNotFound},
+		{"after is not an id", ordered[0].id, "zzz", errAfterNotFound},
+		{"after itself", ordered[1].id, ordered[1].id.Hex(), errAfterNotFound},
+	}
+	for _, tt := range tests {
+		if _, err := reorder(ordered, tt.moving, tt.after); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestReorderRenumbers(t *testing.T) {
+	// Mover siempre al mismo hueco lo parte a la mitad cada vez hasta que no queda lugar
+	ordered := list(4)
+	renumbered := false
+	for i := 0; i < 100 && !renumbered; i++ {
+		// El tercero pasa a segundo: se van turnando los dos del medio y el hueco se achica
+		moving := ordered[2]
+		updates, err := reorder(ordered, moving.id, ordered[0].id.Hex())
+		if err != nil {
+			t.Fatalf("move %d: %v", i, err)
+		}
+		ordered = apply(ordered, updates)
+		if ordered[1].id != moving.id {
+			t.Fatalf("move %d: element not placed after the first one", i)
+		}
+
+		if len(updates) > 1 {
+			renumbered = true
+			if len(updates) != len(ordered) {
+				t.Fatalf("renumber wrote %d of %d positions", len(updates), len(ordered))
+			}
+			for j, p := range ordered {
+				if p.pos != float64(j+1)*positionStep {
+					t.Fatalf("position %d = %v after renumbering, want %v", j, p.pos, float64(j+1)*positionStep)
+				}
+			}
+		}
+	}
+	if !renumbered {
+		t.Fatal("the gap never got small enough to renumber")
+	}
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"view-list/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidScoreScale = errors.New("Invalid score scale (use 10, 100 or 5)")
+
+// ScoreService maneja la escala de puntajes del usuario. Los puntajes se guardan normalizados,
+// así que la escala solo cambia cómo entran y salen por la API.
+type ScoreService struct {
+	users domain.UserRepo
+}
+
+func NewScoreService(users domain.UserRepo) *ScoreService {
+	return &ScoreService{users: users}
+}
+
+func (s *ScoreService) Scale(ctx context.Context, userID string) (domain.ScoreScale, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return "", err
+	}
+	user, err := s.users.GetByID(ctx, objID)
+	if err != nil {
+		return "", err
+	}
+	if user.ScoreScale == "" {
+		return domain.DefaultScoreScale, nil
+	}
+	return user.ScoreScale, nil
+}
+
+func (s *ScoreService) SetScale(ctx context.Context, userID string, scale domain.ScoreScale) error {
+	if !domain.IsValidScoreScale(scale) {
+		return ErrInvalidScoreScale
+	}
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+	return s.users.SetScoreScale(ctx, objID, scale)
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"view-list/internal/domain"
+	"view-list/internal/query"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxSmartLists     = 100 // por usuario
+	maxSmartListName  = 100
+	maxSmartListPins  = 200
+	maxSmartListQuery = 1000
+)
+
+var (
+	ErrSmartListNotFound = errors.New("Smart list not found")
+	ErrInvalidSmartList  = errors.New("Invalid smart list")
+	ErrTooManySmartLists = fmt.Errorf("%w: limit of %d lists reached", ErrInvalidSmartList, maxSmartLists)
+)
+
+// SmartListInput es lo que manda el usuario al crear o editar (reemplaza todo)
+type SmartListInput struct {
+	Name   string   `json:"name"`
+	Query  string   `json:"query"`
+	Sort   string   `json:"sort"`
+	Pinned []string `json:"pinned"`
+}
+
+type SmartListService struct {
+	repo   domain.SmartListRepo
+	mangas *MangaService
+}
+
+func NewSmartListService(repo domain.SmartListRepo, mangas *MangaService) *SmartListService {
+	return &SmartListService{repo: repo, mangas: mangas}
+}
+
+func (s *SmartListService) List(ctx context.Context, userID string) ([]domain.SmartList, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListByUser(ctx, objID)
+}
+
+// Get trae la lista solo si es del usuario; si no, responde como si no existiera
+func (s *SmartListService) Get(ctx context.Context, id primitive.ObjectID, userID string) (*domain.SmartList, error) {
+	list, err := s.repo.GetByID(ctx, id)
+	if err != nil || list.UserID.Hex() != userID {
+		return nil, ErrSmartListNotFound
+	}
+	return list, nil
+}
+
+func (s *SmartListService) Create(ctx context.Context, userID string, in SmartListInput) (*domain.SmartList, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+	states, err := s.mangas.states.States(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	pinned, err := validateSmartList(&in, states)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := s.repo.CountByUser(ctx, objID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxSmartLists {
+		return nil, ErrTooManySmartLists
+	}
+
+	now := time.Now()
+	list := &domain.SmartList{
+		ID:        primitive.NewObjectID(),
+		UserID:    objID,
+		Name:      in.Name,
+		Query:     in.Query,
+		Sort:      in.Sort,
+		Pinned:    pinned,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.repo.Create(ctx, list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *SmartListService) Update(ctx context.Context, id primitive.ObjectID, userID string, in SmartListInput) (*domain.SmartList, error) {
+	list, err := s.Get(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	states, err := s.mangas.states.States(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	pinned, err := validateSmartList(&in, states)
+	if err != nil {
+		return nil, err
+	}
+
+	list.Name, list.Query, list.Sort, list.Pinned = in.Name, in.Query, in.Sort, pinned
+	list.UpdatedAt = time.Now()
+	updates := bson.M{"name": list.Name, "query": list.Query, "sort": list.Sort, "pinned": list.Pinned, "updated_at": list.UpdatedAt}
+	if err := s.repo.Update(ctx, id, updates); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *SmartListService) Delete(ctx context.Context, id primitive.ObjectID, userID string) error {
+	if _, err := s.Get(ctx, id, userID); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, id)
+}
+
+// Evaluate corre el filtro guardado con los mismos filtros que GET /api/mangas y aplica
+// el orden y los fijados de la lista
+func (s *SmartListService) Evaluate(ctx context.Context, id primitive.ObjectID, userID string) (*domain.SmartList, []domain.Manga, error) {
+	list, err := s.Get(ctx, id, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Se parsea cada vez: las fechas relativas (now-30d) se calculan al abrir la lista
+	f, err := query.Parse(list.Query)
+	if err != nil {
+		return nil, nil, err
+	}
+	mangas, err := s.mangas.ListAll(ctx, userID, f)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	SortMangas(mangas, list.Sort)
+	pinned := make([]string, len(list.Pinned))
+	for i, p := range list.Pinned {
+		pinned[i] = p.Hex()
+	}
+	return list, PinFirst(mangas, pinned), nil
+}
+
+// validateSmartList normaliza la entrada y devuelve los fijados ya como ObjectID
+func validateSmartList(in *SmartListInput, states []domain.ReadingState) ([]primitive.ObjectID, error) {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Query = strings.TrimSpace(in.Query)
+	in.Sort = strings.TrimSpace(in.Sort)
+
+	if in.Name == "" || utf8.RuneCountInString(in.Name) > maxSmartListName {
+		return nil, fmt.Errorf("%w: name is required (max %d characters)", ErrInvalidSmartList, maxSmartListName)
+	}
+	if len(in.Query) > maxSmartListQuery {
+		return nil, fmt.Errorf("%w: query too long", ErrInvalidSmartList)
+	}
+	f, err := query.Parse(in.Query)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateFilter(f, states); err != nil {
+		return nil, err
+	}
+	if err := ValidateSort(in.Sort); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSmartList, err)
+	}
+	if len(in.Pinned) > maxSmartListPins {
+		return nil, fmt.Errorf("%w: too many pinned mangas (max %d)", ErrInvalidSmartList, maxSmartListPins)
+	}
+
+	pinned := make([]primitive.ObjectID, 0, len(in.Pinned))
+	seen := map[primitive.ObjectID]bool{}
+	for _, p := range in.Pinned {
+		id, err := primitive.ObjectIDFromHex(p)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid pinned id %q", ErrInvalidSmartList, p)
+		}
+		if !seen[id] {
+			seen[id] = true
+			pinned = append(pinned, id)
+		}
+	}
+	return pinned, nil
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+	"view-list/internal/domain"
+	"view-list/internal/search"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxStates     = 30
+	maxStateKey   = 40
+	maxStateLabel = 60
+)
+
+var (
+	ErrInvalidState  = errors.New("Invalid manga state")
+	ErrInvalidStates = errors.New("Invalid states")
+	ErrStateInUse    = errors.New("State is in use")
+)
+
+var (
+	stateKeyPattern = regexp.MustCompile(`^[a-z0-9]+( [a-z0-9]+)*$`) // sin - ni _: el filtro los toma como espacios
+	colorPattern    = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// StateService maneja los estados configurables de cada usuario. Se guardan en el documento
+// del usuario; si no tiene (usuario viejo sin migrar) valen los por defecto.
+type StateService struct {
+	users  domain.UserRepo
+	mgRepo domain.MangaRepo
+}
+
+func NewStateService(users domain.UserRepo, mgRepo domain.MangaRepo) *StateService {
+	return &StateService{users: users, mgRepo: mgRepo}
+}
+
+func (s *StateService) States(ctx context.Context, userID string) ([]domain.ReadingState, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.GetByID(ctx, objID)
+	if err != nil {
+		return nil, err
+	}
+	if len(user.States) == 0 {
+		return domain.DefaultReadingStates(), nil
+	}
+	return user.States, nil
+}
+
+// Validate chequea que el estado exista para el usuario
+func (s *StateService) Validate(ctx context.Context, userID string, state domain.MangaState) error {
+	states, err := s.States(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if findState(states, state) < 0 {
+		return fmt.Errorf("%w: %q", ErrInvalidState, state)
+	}
+	return nil
+}
+
+// Replace guarda el conjunto completo (en orden). Un estado que se saca y todavía tiene mangas
+// necesita un destino en reassign (key vieja -> key nueva); si no, da ErrStateInUse.
+func (s *StateService) Replace(ctx context.Context, userID string, states []domain.ReadingState, reassign map[domain.MangaState]domain.MangaState) ([]domain.ReadingState, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := normalizeStates(states); err != nil {
+		return nil, err
+	}
+
+	counts, err := s.mgRepo.CountByState(ctx, objID)
+	if err != nil {
+		return nil, err
+	}
+	for key, n := range counts {
+		if n == 0 || findState(states, key) >= 0 {
+			continue
+		}
+		to, ok := reassign[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q has %d mangas, pass reassign to move them to another state", ErrStateInUse, key, n)
+		}
+		if findState(states, to) < 0 {
+			return nil, fmt.Errorf("%w: cannot reassign %q to unknown state %q", ErrInvalidStates, key, to)
+		}
+	}
+
+	// Primero se guardan los estados: si falla una reasignación el usuario puede reintentar
+	if err := s.users.SetStates(ctx, objID, states); err != nil {
+		return nil, err
+	}
+	for from, to := range reassign {
+		if counts[from] == 0 || findState(states, from) >= 0 {
+			continue
+		}
+		if _, err := s.mgRepo.ReassignState(ctx, objID, from, to); err != nil {
+			return nil, err
+		}
+	}
+	return states, nil
+}
+
+// Ensure agrega al final los estados que faltan (ej: al importar un backup con estados propios).
+// Los que vienen en extra se copian tal cual; las keys sueltas se agregan como inactivas.
+// Un estado inválido, o que ya no entra (maxStates), no hace fallar: sus mangas van al estado por
+// defecto y queda un aviso. Devuelve a qué estado va cada key de keys.
+func (s *StateService) Ensure(ctx context.Context, userID string, extra []domain.ReadingState, keys []domain.MangaState) (map[domain.MangaState]domain.MangaState, []string, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	states, err := s.States(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	warnings := []string{}
+	added := false
+	// Devuelve la key ya normalizada, o false si no quedó en el conjunto
+	add := func(st domain.ReadingState) (domain.MangaState, bool) {
+		if err := normalizeState(&st); err != nil {
+			warnings = append(warnings, err.Error())
+			return "", false
+		}
+		if findState(states, st.Key) >= 0 {
+			return st.Key, true
+		}
+		if len(states) >= maxStates {
+			warnings = append(warnings, fmt.Sprintf("state %q not added: max %d states", st.Key, maxStates))
+			return "", false
+		}
+		states = append(states, st)
+		added = true
+		return st.Key, true
+	}
+
+	for _, st := range extra {
+		add(st)
+	}
+	fallback := defaultState(states)
+	mapping := make(map[domain.MangaState]domain.MangaState, len(keys))
+	for _, key := range keys {
+		if _, ok := mapping[key]; ok {
+			continue
+		}
+		if key == "" {
+			mapping[key] = fallback
+			continue
+		}
+		st := domain.ReadingState{Key: key, Label: string(key), Color: "#a3a3a3", Category: domain.CategoryInactive}
+		if to, ok := add(st); ok {
+			mapping[key] = to
+			continue
+		}
+		mapping[key] = fallback
+		warnings = append(warnings, fmt.Sprintf("mangas with state %q moved to %q", key, fallback))
+	}
+
+	if added {
+		if err := s.users.SetStates(ctx, objID, states); err != nil {
+			return nil, nil, err
+		}
+	}
+	return mapping, warnings, nil
+}
+
+// defaultState es adonde van los mangas con un estado que no se pudo agregar:
+// "plan to read" si el usuario lo tiene, si no el primero inactivo, si no el primero
+func defaultState(states []domain.ReadingState) domain.MangaState {
+	if findState(states, domain.MangaStatePlanned) >= 0 {
+		return domain.MangaStatePlanned
+	}
+	for _, st := range states {
+		if st.Category == domain.CategoryInactive {
+			return st.Key
+		}
+	}
+	return states[0].Key
+}
+
+// normalizeStates completa las keys que faltan desde el label y valida todo el conjunto
+func normalizeStates(states []domain.ReadingState) error {
+	if len(states) == 0 || len(states) > maxStates {
+		return fmt.Errorf("%w: between 1 and %d states", ErrInvalidStates, maxStates)
+	}
+	seen := map[domain.MangaState]bool{}
+	for i := range states {
+		st := &states[i]
+		if err := normalizeState(st); err != nil {
+			return err
+		}
+		if seen[st.Key] {
+			return fmt.Errorf("%w: duplicated key %q", ErrInvalidStates, st.Key)
+		}
+		seen[st.Key] = true
+	}
+	return nil
+}
+
+// normalizeState hace lo mismo con un solo estado, sin mirar los demás
+func normalizeState(st *domain.ReadingState) error {
+	st.Label = strings.TrimSpace(st.Label)
+	if st.Key == "" {
+		st.Key = domain.MangaState(strings.Join(search.Tokens(st.Label), " "))
+	}
+	st.Key = domain.MangaState(strings.ToLower(strings.TrimSpace(string(st.Key))))
+	if st.Category == "" {
+		st.Category = domain.CategoryInactive
+	}
+
+	switch {
+	case st.Label == "" || utf8.RuneCountInString(st.Label) > maxStateLabel:
+		return fmt.Errorf("%w: label is required (max %d characters)", ErrInvalidStates, maxStateLabel)
+	case len(st.Key) > maxStateKey || !stateKeyPattern.MatchString(string(st.Key)):
+		return fmt.Errorf("%w: key %q must be lowercase letters and numbers separated by single spaces", ErrInvalidStates, st.Key)
+	case !colorPattern.MatchString(st.Color):
+		return fmt.Errorf("%w: color of %q must be #rrggbb", ErrInvalidStates, st.Key)
+	case !domain.IsValidStateCategory(st.Category):
+		return fmt.Errorf("%w: category of %q must be active, finished or inactive", ErrInvalidStates, st.Key)
+	}
+	return nil
+}
+
+func findState(states []domain.ReadingState, key domain.MangaState) int {
+	for i, s := range states {
+		if s.Key == key {
+			return i
+		}
+	}
+	return -1
+}
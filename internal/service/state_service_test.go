@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"view-list/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// without son los estados por defecto menos keys
+func without(keys ...domain.MangaState) []domain.ReadingState {
+	var out []domain.ReadingState
+	for _, st := range domain.DefaultReadingStates() {
+		if findState(stateList(keys...), st.Key) < 0 {
+			out = append(out, st)
+		}
+	}
+	return out
+}
+
+// stateList arma estados válidos con esas keys, todos de la misma categoría
+func stateList(keys ...domain.MangaState) []domain.ReadingState {
+	out := make([]domain.ReadingState, len(keys))
+	for i, k := range keys {
+		out[i] = domain.ReadingState{Key: k, Label: string(k), Color: "#123456", Category: domain.CategoryActive}
+	}
+	return out
+}
+
+// numbered arma n estados activos s0, s1, ...
+func numbered(n int) []domain.ReadingState {
+	keys := make([]domain.MangaState, n)
+	for i := range keys {
+		keys[i] = domain.MangaState(fmt.Sprintf("s%d", i))
+	}
+	return stateList(keys...)
+}
+
+// El usuario devuelto es el mismo que guarda el repo: user.States es lo último que se guardó
+func newStateFixture(states []domain.ReadingState, counts map[domain.MangaState]int) (*StateService, *domain.User, *fakeMangas) {
+	user := &domain.User{ID: primitive.NewObjectID(), States: states}
+	mangas := &fakeMangas{counts: counts}
+	return NewStateService(newFakeUsers(user), mangas), user, mangas
+}
+
+func keysOf(states []domain.ReadingState) []domain.MangaState {
+	out := make([]domain.MangaState, len(states))
+	for i, st := range states {
+		out[i] = st.Key
+	}
+	return out
+}
+
+func TestStateReplace(t *testing.T) {
+	tests := []struct {
+		name           string
+		counts         map[domain.MangaState]int
+		states         []domain.ReadingState
+		reassign       map[domain.MangaState]domain.MangaState
+		wantErr        error
+		wantReassigned map[domain.MangaState]domain.MangaState
+	}{
+		{
+			name:   "remove an unused state",
+			counts: map[domain.MangaState]int{domain.MangaStateReading: 3, domain.MangaStateDropped: 0},
+			states: without(domain.MangaStateDropped),
+		},
+		{
+			name:    "remove a state in use",
+			counts:  map[domain.MangaState]int{domain.MangaStateDropped: 2},
+			states:  without(domain.MangaStateDropped),
+			wantErr: ErrStateInUse,
+		},
+		{
+			name:           "reassign a state in use",
+			counts:         map[domain.MangaState]int{domain.MangaStateDropped: 2},
+			states:         without(domain.MangaStateDropped),
+			reassign:       map[domain.MangaState]domain.MangaState{domain.MangaStateDropped: domain.MangaStateOnHold},
+			wantReassigned: map[domain.MangaState]domain.MangaState{domain.MangaStateDropped: domain.MangaStateOnHold},
+		},
+		{
+			name:     "reassign to a removed state",
+			counts:   map[domain.MangaState]int{domain.MangaStateDropped: 2},
+			states:   without(domain.MangaStateDropped, domain.MangaStateOnHold),
+			reassign: map[domain.MangaState]domain.MangaState{domain.MangaStateDropped: domain.MangaStateOnHold},
+			wantErr:  ErrInvalidStates,
+		},
+		{
+			name:   "reassign of kept or empty states is ignored",
+			counts: map[domain.MangaState]int{domain.MangaStateReading: 3},
+			states: without(domain.MangaStateDropped),
+			reassign: map[domain.MangaState]domain.MangaState{
+				domain.MangaStateReading: domain.MangaStateCompleted,
+				domain.MangaStateDropped: domain.MangaStateOnHold,
+			},
+		},
+		{
+			name:    "duplicated key",
+			states:  append(without(), stateList(domain.MangaStateReading)...),
+			wantErr: ErrInvalidStates,
+		},
+		{
+			name:    "too many states",
+			states:  numbered(maxStates + 1),
+			wantErr: ErrInvalidStates,
+		},
+		{
+			name:    "no states",
+			states:  nil,
+			wantErr: ErrInvalidStates,
+		},
+		{
+			name:    "invalid key",
+			states:  stateList("to-read"),
+			wantErr: ErrInvalidStates,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, user, mangas := newStateFixture(nil, tt.counts)
+			got, err := svc.Replace(context.Background(), user.ID.Hex(), tt.states, tt.reassign)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Replace = %v, want %v", err, tt.wantErr)
+			}
+
+			saved := user.States
+			if tt.wantErr != nil {
+				if saved != nil || mangas.reassigned != nil {
+					t.Errorf("saved %v, reassigned %v; want nothing changed", keysOf(saved), mangas.reassigned)
+				}
+				return
+			}
+			if !reflect.DeepEqual(keysOf(saved), keysOf(got)) {
+				t.Errorf("saved %v, want %v", keysOf(saved), keysOf(got))
+			}
+			if !reflect.DeepEqual(mangas.reassigned, tt.wantReassigned) {
+				t.Errorf("reassigned %v, want %v", mangas.reassigned, tt.wantReassigned)
+			}
+		})
+	}
+}
+
+func TestStateReplaceKeyFromLabel(t *testing.T) {
+	svc, user, _ := newStateFixture(nil, nil)
+	states := []domain.ReadingState{{Label: "  Read Later ", Color: "#123456"}}
+	got, err := svc.Replace(context.Background(), user.ID.Hex(), states, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := domain.ReadingState{Key: "read later", Label: "Read Later", Color: "#123456", Category: domain.CategoryInactive}
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("Replace = %+v, want %+v", got, want)
+	}
+}
+
+func TestStateEnsure(t *testing.T) {
+	planned := domain.MangaStatePlanned
+	tests := []struct {
+		name         string
+		states       []domain.ReadingState // nil = los por defecto
+		extra        []domain.ReadingState
+		keys         []domain.MangaState
+		wantMapping  map[domain.MangaState]domain.MangaState
+		wantWarnings int
+		wantAdded    []domain.ReadingState // nil = no se guarda nada
+	}{
+		{
+			name:        "known keys",
+			keys:        []domain.MangaState{domain.MangaStateReading, domain.MangaStateReading},
+			wantMapping: map[domain.MangaState]domain.MangaState{domain.MangaStateReading: domain.MangaStateReading},
+		},
+		{
+			name:        "extra states are copied",
+			extra:       []domain.ReadingState{{Label: "Favorites", Color: "#ff0000", Category: domain.CategoryActive}},
+			keys:        []domain.MangaState{"favorites"},
+			wantMapping: map[domain.MangaState]domain.MangaState{"favorites": "favorites"},
+			wantAdded:   []domain.ReadingState{{Key: "favorites", Label: "Favorites", Color: "#ff0000", Category: domain.CategoryActive}},
+		},
+		{
+			name:        "unknown keys are added as inactive",
+			keys:        []domain.MangaState{" Abandoned "},
+			wantMapping: map[domain.MangaState]domain.MangaState{" Abandoned ": "abandoned"},
+			wantAdded:   []domain.ReadingState{{Key: "abandoned", Label: "Abandoned", Color: "#a3a3a3", Category: domain.CategoryInactive}},
+		},
+		{
+			name:         "invalid key goes to the fallback",
+			keys:         []domain.MangaState{"to-read"},
+			wantMapping:  map[domain.MangaState]domain.MangaState{"to-read": planned},
+			wantWarnings: 2,
+		},
+		{
+			name:         "invalid extra state is skipped",
+			extra:        []domain.ReadingState{{Label: "Bad", Color: "red"}},
+			wantMapping:  map[domain.MangaState]domain.MangaState{},
+			wantWarnings: 1,
+		},
+		{
+			name:        "empty key goes to the fallback without warning",
+			keys:        []domain.MangaState{""},
+			wantMapping: map[domain.MangaState]domain.MangaState{"": planned},
+		},
+		{
+			name:         "no room left",
+			states:       numbered(maxStates),
+			keys:         []domain.MangaState{"s3", "new"},
+			wantMapping:  map[domain.MangaState]domain.MangaState{"s3": "s3", "new": "s0"},
+			wantWarnings: 2,
+		},
+		{
+			name:         "fills up to maxStates",
+			states:       numbered(maxStates - 1),
+			keys:         []domain.MangaState{"first", "second"},
+			wantMapping:  map[domain.MangaState]domain.MangaState{"first": "first", "second": "s0"}, // el fallback sale de los estados de antes
+			wantWarnings: 2,
+			wantAdded:    []domain.ReadingState{{Key: "first", Label: "first", Color: "#a3a3a3", Category: domain.CategoryInactive}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, user, _ := newStateFixture(tt.states, nil)
+			mapping, warnings, err := svc.Ensure(context.Background(), user.ID.Hex(), tt.extra, tt.keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(mapping, tt.wantMapping) {
+				t.Errorf("mapping %v, want %v", mapping, tt.wantMapping)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("warnings %q, want %d", warnings, tt.wantWarnings)
+			}
+
+			before := tt.states
+			if before == nil {
+				before = domain.DefaultReadingStates()
+			}
+			saved := user.States
+			if tt.wantAdded == nil {
+				if !reflect.DeepEqual(saved, tt.states) {
+					t.Errorf("saved %v, want the states untouched", keysOf(saved))
+				}
+				return
+			}
+			want := append(append([]domain.ReadingState(nil), before...), tt.wantAdded...)
+			if !reflect.DeepEqual(saved, want) {
+				t.Errorf("saved %+v, want %+v", saved, want)
+			}
+		})
+	}
+}
+
+func TestDefaultState(t *testing.T) {
+	inactive := domain.ReadingState{Key: "paused", Label: "Paused", Color: "#123456", Category: domain.CategoryInactive}
+	tests := []struct {
+		states []domain.ReadingState
+		want   domain.MangaState
+	}{
+		{domain.DefaultReadingStates(), domain.MangaStatePlanned},
+		{without(domain.MangaStatePlanned), domain.MangaStateOnHold}, // el primer inactivo
+		{append(stateList("a", "b"), inactive), "paused"},
+		{stateList("a", "b"), "a"},
+	}
+	for _, tt := range tests {
+		if got := defaultState(tt.states); got != tt.want {
+			t.Errorf("defaultState(%v) = %q, want %q", keysOf(tt.states), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+	"view-list/internal/domain"
+	"view-list/internal/imaging"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StorageRecalc reconstruye el uso de cada usuario y los conteos de referencias
+// a partir de lo que hay realmente en el storage y en la colección de mangas.
+type StorageRecalc struct {
+	mgRepo domain.MangaRepo
+	users  domain.UserRepo
+	images *ImageService
+}
+
+type RecalcReport struct {
+	Files int              `json:"files"`
+	Bytes int64            `json:"bytes"`
+	Usage map[string]int64 `json:"usage"` // bytes por user id
+	Refs  int              `json:"refs"`  // imágenes con conteo reconstruido
+	Stale int              `json:"stale"` // conteos de imágenes que ya no están en el storage
+}
+
+func NewStorageRecalc(mgRepo domain.MangaRepo, users domain.UserRepo, images *ImageService) *StorageRecalc {
+	return &StorageRecalc{mgRepo: mgRepo, users: users, images: images}
+}
+
+func (r *StorageRecalc) Run(ctx context.Context) (*RecalcReport, error) {
+	report := &RecalcReport{Usage: map[string]int64{}}
+
+	// 1. Lo que hay en el storage, agrupando cada original con sus variantes
+	objects, err := r.images.store.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	originals := map[string]int64{}    // key -> bytes
+	variantBytes := map[string]int64{} // key del original sin extensión -> bytes
+	variantNames := map[string]map[string]bool{}
+	for _, obj := range objects {
+		userID, ok := keyOwner(obj.Key)
+		if !ok {
+			continue
+		}
+		report.Files++
+		report.Bytes += obj.Size
+		report.Usage[userID] += obj.Size
+
+		if imaging.IsVariantKey(obj.Key) {
+			base := obj.Key[:strings.LastIndex(obj.Key, "_")]
+			variantBytes[base] += obj.Size
+			if variantNames[base] == nil {
+				variantNames[base] = map[string]bool{}
+			}
+			variantNames[base][strings.TrimSuffix(obj.Key[len(base)+1:], imaging.VariantExt)] = true
+			continue
+		}
+		originals[obj.Key] = obj.Size
+	}
+
+	// 2. Cuántos mangas usan cada archivo
+	mangas, err := r.mgRepo.ListWithImage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	refs := map[string]int{}
+	for _, m := range mangas {
+		if key, ok := r.images.Key(m.Image, m.UserID.Hex()); ok {
+			refs[key]++
+		}
+	}
+
+	// 3. Conteos nuevos. Los archivos sin mangas no llevan conteo: los levanta el GC de uploads
+	now := time.Now()
+	for key, size := range originals {
+		if refs[key] == 0 {
+			if _, err := r.images.refs.Remove(ctx, key); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		userID, _ := keyOwner(key)
+		base := strings.TrimSuffix(key, path.Ext(key))
+		ref := &domain.ImageRef{
+			Key:       key,
+			UserID:    userID,
+			Size:      size + variantBytes[base],
+			Refs:      refs[key],
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		// Con alguna variante se generaron; las que faltan no achicaban el original
+		if names := variantNames[base]; len(names) > 0 {
+			ref.HasVariants = true
+			for _, v := range imaging.Variants {
+				if !names[v.Name] {
+					ref.SkippedVariants = append(ref.SkippedVariants, v.Name)
+				}
+			}
+		}
+		if err := r.images.refs.Upsert(ctx, ref); err != nil {
+			return nil, err
+		}
+		report.Refs++
+	}
+
+	// 4. Conteos de archivos que ya no existen
+	existing, err := r.images.refs.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range existing {
+		if _, ok := originals[ref.Key]; ok {
+			continue
+		}
+		if _, err := r.images.refs.Remove(ctx, ref.Key); err != nil {
+			return nil, err
+		}
+		report.Stale++
+	}
+
+	// 5. Uso por usuario: primero todos en 0, después los que tienen archivos
+	if err := r.users.ResetStorageUsed(ctx); err != nil {
+		return nil, err
+	}
+	for userID, bytes := range report.Usage {
+		objID, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			continue
+		}
+		if err := r.users.SetStorageUsed(ctx, objID, bytes); err != nil {
+			return nil, fmt.Errorf("user %s: %w", userID, err)
+		}
+	}
+
+	log.Printf("Storage recalc: %d files, %d bytes, %d users, %d refs, %d stale\n",
+		report.Files, report.Bytes, len(report.Usage), report.Refs, report.Stale)
+	return report, nil
+}
+
+// keyOwner saca el user id de una key user_<id>/...
+func keyOwner(key string) (string, bool) {
+	dir, _, ok := strings.Cut(key, "/")
+	if !ok || !strings.HasPrefix(dir, "user_") {
+		return "", false
+	}
+	return strings.TrimPrefix(dir, "user_"), true
+}
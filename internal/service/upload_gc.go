@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+	"view-list/internal/domain"
+	"view-list/internal/jobs"
+	"view-list/internal/storage"
+)
+
+const JobGCUploads = "gc_uploads"
+
+// UploadGC reconcilia el storage de imágenes con la colección de mangas:
+// mueve a cuarentena los archivos que nadie referencia y reporta las imágenes que faltan.
+type UploadGC struct {
+	mgRepo     domain.MangaRepo
+	images     *ImageService
+	quarantine storage.ImageStore
+	grace      time.Duration // archivos más nuevos que esto no se tocan (pueden estar guardándose)
+	retention  time.Duration // cuánto se guarda la cuarentena antes de borrarla
+}
+
+type MissingImage struct {
+	MangaID string `json:"manga_id"`
+	UserID  string `json:"user_id"`
+	Image   string `json:"image"`
+}
+
+type GCReport struct {
+	DryRun      bool           `json:"dry_run"`
+	Scanned     int            `json:"scanned"`
+	Referenced  int            `json:"referenced"`
+	Quarantined []string       `json:"quarantined"`
+	InGrace     []string       `json:"in_grace"` // huérfanos todavía dentro del período de gracia
+	Purged      int            `json:"purged"`   // archivos de cuarentena vencidos que se borraron
+	Missing     []MissingImage `json:"missing"`
+	Errors      []string       `json:"errors"`
+}
+
+func NewUploadGC(mgRepo domain.MangaRepo, queue *jobs.Queue, images *ImageService, quarantine storage.ImageStore, grace, retention time.Duration) *UploadGC {
+	gc := &UploadGC{
+		mgRepo:     mgRepo,
+		images:     images,
+		quarantine: quarantine,
+		grace:      grace,
+		retention:  retention,
+	}
+	if queue != nil {
+		queue.Register(JobGCUploads, func(ctx context.Context, job *domain.Job) (map[string]string, error) {
+			report, err := gc.Run(ctx, false)
+			if err != nil {
+				return nil, err
+			}
+			return report.Summary(), nil
+		})
+	}
+	return gc
+}
+
+// Run hace una pasada completa. Con dryRun solo reporta, sin mover ni borrar nada.
+func (gc *UploadGC) Run(ctx context.Context, dryRun bool) (*GCReport, error) {
+	report := &GCReport{DryRun: dryRun}
+
+	// 1. Lo que hay en el storage
+	objects, err := gc.images.store.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		stored[obj.Key] = true
+	}
+
+	// 2. Imágenes referenciadas en la db
+	mangas, err := gc.mgRepo.ListWithImage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	referenced := map[string]bool{}
+	for _, m := range mangas {
+		key, ok := gc.images.Key(m.Image, m.UserID.Hex())
+		if !ok {
+			// Link externo, o algo que no sé leer como nuestro: si se parece a un upload lo cuento como
+			// referenciado por las dudas. Perder una portada es peor que dejar un archivo de más.
+			if key, ok := uploadKeyAnyOwner(m.Image); ok {
+				referenced[key] = true
+				for _, vKey := range gc.images.VariantKeys(key) {
+					referenced[vKey] = true
+				}
+			}
+			continue
+		}
+		referenced[key] = true
+		for _, vKey := range gc.images.VariantKeys(key) {
+			referenced[vKey] = true
+		}
+		if !stored[key] {
+			report.Missing = append(report.Missing, MissingImage{MangaID: m.ID.Hex(), UserID: m.UserID.Hex(), Image: m.Image})
+		}
+	}
+
+	// 3. Archivos sin referencia, pasado el período de gracia, van a cuarentena
+	now := time.Now()
+	for _, obj := range objects {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		report.Scanned++
+		if referenced[obj.Key] {
+			report.Referenced++
+			continue
+		}
+		if now.Sub(obj.ModTime) < gc.grace {
+			report.InGrace = append(report.InGrace, obj.Key)
+			continue
+		}
+
+		if !dryRun {
+			if err := gc.moveToQuarantine(ctx, obj, now); err != nil {
+				report.Errors = append(report.Errors, err.Error())
+				continue
+			}
+		}
+		report.Quarantined = append(report.Quarantined, obj.Key)
+	}
+
+	// 4. Limpio la cuarentena vencida
+	if !dryRun {
+		report.Purged = gc.purge(ctx, now, report)
+	}
+
+	log.Printf("Upload GC: %d scanned, %d quarantined, %d missing, %d purged\n",
+		report.Scanned, len(report.Quarantined), len(report.Missing), report.Purged)
+	return report, nil
+}
+
+// Copia el archivo a la cuarentena como <fecha>/<key> y lo borra del storage
+func (gc *UploadGC) moveToQuarantine(ctx context.Context, obj storage.ObjectInfo, now time.Time) error {
+	rc, info, err := gc.images.store.Get(ctx, obj.Key)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", obj.Key, err)
+	}
+	defer rc.Close()
+
+	dst := now.Format("2006-01-02") + "/" + obj.Key
+	if err := gc.quarantine.Put(ctx, dst, rc, info.Size, info.ContentType); err != nil {
+		return fmt.Errorf("quarantining %s: %w", obj.Key, err)
+	}
+	// Las variantes huérfanas pasan por acá una por una, así que borro solo esta key
+	if err := gc.images.store.Delete(ctx, obj.Key); err != nil {
+		return err
+	}
+	return gc.images.Forget(ctx, obj.Key)
+}
+
+func (gc *UploadGC) purge(ctx context.Context, now time.Time, report *GCReport) int {
+	objects, err := gc.quarantine.List(ctx, "")
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		return 0
+	}
+
+	purged := 0
+	for _, obj := range objects {
+		day, _, _ := strings.Cut(obj.Key, "/")
+		// Cuento desde el final del día, así ningún archivo queda menos que retention
+		date, err := time.ParseInLocation("2006-01-02", day, now.Location())
+		if err != nil || now.Sub(date.AddDate(0, 0, 1)) < gc.retention {
+			continue
+		}
+		if err := gc.quarantine.Delete(ctx, obj.Key); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+		purged++
+	}
+	return purged
+}
+
+// uploadKeyAnyOwner saca la key de una key o URL con /uploads/ sin mirar el dueño ni el origen
+func uploadKeyAnyOwner(image string) (string, bool) {
+	if IsStorageKey(image) {
+		return image, true
+	}
+	u, err := url.Parse(image)
+	if err != nil {
+		return "", false
+	}
+	_, rest, ok := strings.Cut(u.Path, "/uploads/")
+	if !ok {
+		return "", false
+	}
+	key, err := storage.CleanKey(rest)
+	return key, err == nil
+}
+
+// Summary es el resultado que queda guardado en el job
+func (r *GCReport) Summary() map[string]string {
+	return map[string]string{
+		"scanned":     fmt.Sprint(r.Scanned),
+		"quarantined": fmt.Sprint(len(r.Quarantined)),
+		"in_grace":    fmt.Sprint(len(r.InGrace)),
+		"missing":     fmt.Sprint(len(r.Missing)),
+		"purged":      fmt.Sprint(r.Purged),
+		"errors":      fmt.Sprint(len(r.Errors)),
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+var ErrUserExists = errors.New("User already exists")
+
 type userService struct {
 	uRepo domain.UserRepo
 }
@@ -20,12 +22,20 @@ func NewUserService(uRepo domain.UserRepo) domain.UserService {
 func (s *userService) Register(ctx context.Context, user *domain.User) error {
 	_, err := s.uRepo.GetByEmail(ctx, user.Email)
 	if err == nil {
-		return errors.New("User already exists")
+		return ErrUserExists
 	}
 
 	hashed, _ := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	user.Password = string(hashed)
-	return s.uRepo.Create(ctx, user)
+	user.States = domain.DefaultReadingStates()
+	// Dos registros a la vez pasan el chequeo de arriba: el índice único decide
+	if err := s.uRepo.Create(ctx, user); err != nil {
+		if errors.Is(err, domain.ErrDuplicate) {
+			return ErrUserExists
+		}
+		return err
+	}
+	return nil
 }
 
 func (s *userService) Login(ctx context.Context, email, password string) (*domain.User, error) {
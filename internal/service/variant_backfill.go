@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"view-list/internal/domain"
+	"view-list/internal/imaging"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// VariantBackfill genera las variantes (thumb, card, full) de las portadas subidas
+// antes de que existieran, o de las que fallaron al guardarse.
+type VariantBackfill struct {
+	mgRepo domain.MangaRepo
+	images *ImageService
+}
+
+type BackfillReport struct {
+	Scanned   int      `json:"scanned"`
+	Generated int      `json:"generated"`
+	Skipped   int      `json:"skipped"` // ya tenían todas las variantes o son links externos
+	Errors    []string `json:"errors"`
+}
+
+func NewVariantBackfill(mgRepo domain.MangaRepo, images *ImageService) *VariantBackfill {
+	return &VariantBackfill{mgRepo: mgRepo, images: images}
+}
+
+// Run recorre los mangas con imagen; con force regenera también las que ya tenían variantes
+func (b *VariantBackfill) Run(ctx context.Context, force bool) (*BackfillReport, error) {
+	mangas, err := b.mgRepo.ListWithImage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &BackfillReport{Errors: []string{}}
+	for _, m := range mangas {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		report.Scanned++
+
+		key, ok := b.images.Key(m.Image, m.UserID.Hex())
+		if !ok || (!force && len(m.Variants) == len(imaging.Variants)) {
+			report.Skipped++
+			continue
+		}
+
+		variants, err := b.images.GenerateVariants(ctx, key)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("manga %s (%s): %v", m.ID.Hex(), key, err))
+			continue
+		}
+		// Sin tocar updated_at: para el usuario el manga no cambió
+		if err := b.mgRepo.Update(ctx, m.ID, bson.M{"variants": variants}); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("manga %s: %v", m.ID.Hex(), err))
+			continue
+		}
+		report.Generated++
+	}
+
+	log.Printf("Variant backfill: %d scanned, %d generated, %d skipped, %d errors\n",
+		report.Scanned, report.Generated, report.Skipped, len(report.Errors))
+	return report, nil
+}
@@ -0,0 +1,342 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config sirve para AWS S3 y para cualquier compatible (MinIO, R2, Spaces...).
+type S3Config struct {
+	Endpoint  string // ej: https://s3.amazonaws.com o http://localhost:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Prefix    string // se antepone a todas las keys, ej: "uploads/"
+	PathStyle bool   // endpoint/bucket/key en vez de bucket.endpoint/key (MinIO lo necesita)
+}
+
+// S3Store habla la API REST de S3 firmando con SigV4, sin depender del SDK.
+type S3Store struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	u, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	return &S3Store{cfg: cfg, endpoint: u, client: &http.Client{Timeout: 5 * time.Minute}}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	req, err := s.newRequest(ctx, http.MethodPut, key, nil, r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info := &ObjectInfo{Key: key, Size: resp.ContentLength, ContentType: resp.Header.Get("Content-Type")}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = t
+	}
+	if info.ContentType == "" {
+		info.ContentType = ContentTypeByExt(key)
+	}
+	return resp.Body, info, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type listResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var list []ObjectInfo
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.cfg.Prefix + prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		req, err := s.newBucketRequest(ctx, http.MethodGet, query)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var res listResult
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decoding S3 list response: %w", err)
+		}
+
+		for _, c := range res.Contents {
+			key := strings.TrimPrefix(c.Key, s.cfg.Prefix)
+			list = append(list, ObjectInfo{Key: key, Size: c.Size, ContentType: ContentTypeByExt(key), ModTime: c.LastModified})
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			return list, nil
+		}
+		token = res.NextContinuationToken
+	}
+}
+
+// SignedURL arma una URL GET prefirmada (query string SigV4) que vence en ttl
+func (s *S3Store) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	u := s.objectURL(key)
+	now := time.Now().UTC()
+
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.cfg.AccessKey + "/" + s.scope(now)},
+		"X-Amz-Date":          {now.Format("20060102T150405Z")},
+		"X-Amz-Expires":       {strconv.Itoa(int(ttl.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	u.RawQuery = canonicalQuery(query)
+
+	headers := http.Header{}
+	headers.Set("Host", u.Host)
+	signature := s.signature(now, http.MethodGet, u, headers, unsignedPayload)
+
+	u.RawQuery += "&X-Amz-Signature=" + signature
+	return u.String(), nil
+}
+
+// -------------------- firma SigV4 --------------------
+
+func (s *S3Store) newRequest(ctx context.Context, method, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	u := s.objectURL(key)
+	u.RawQuery = canonicalQuery(query)
+	return http.NewRequestWithContext(ctx, method, u.String(), body)
+}
+
+func (s *S3Store) newBucketRequest(ctx context.Context, method string, query url.Values) (*http.Request, error) {
+	u := s.bucketURL()
+	u.RawQuery = canonicalQuery(query)
+	return http.NewRequestWithContext(ctx, method, u.String(), nil)
+}
+
+func (s *S3Store) bucketURL() *url.URL {
+	u := *s.endpoint
+	if s.cfg.PathStyle {
+		u.Path = "/" + s.cfg.Bucket + "/"
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = "/"
+	}
+	return &u
+}
+
+func (s *S3Store) objectURL(key string) *url.URL {
+	u := s.bucketURL()
+	u.Path += s.cfg.Prefix + key
+	u.RawPath = encodePath(u.Path)
+	return u
+}
+
+// Firma el request, lo ejecuta y traduce los errores de S3
+func (s *S3Store) do(req *http.Request) (*http.Response, error) {
+	now := time.Now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	req.Header.Set("Host", req.URL.Host)
+
+	signedHeaders := map[string]bool{"host": true, "x-amz-date": true, "x-amz-content-sha256": true}
+	toSign := http.Header{}
+	for k, v := range req.Header {
+		if signedHeaders[strings.ToLower(k)] {
+			toSign[k] = v
+		}
+	}
+	signature := s.signature(now, req.Method, req.URL, toSign, unsignedPayload)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, s.scope(now), signedHeaderList(toSign), signature))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("S3 %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+func (s *S3Store) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.cfg.Region + "/s3/aws4_request"
+}
+
+func (s *S3Store) signature(t time.Time, method string, u *url.URL, headers http.Header, payloadHash string) string {
+	canonicalRequest := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		u.RawQuery,
+		canonicalHeaders(headers),
+		signedHeaderList(headers),
+		payloadHash,
+	}, "\n")
+
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		t.Format("20060102T150405Z"),
+		s.scope(t),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func canonicalHeaders(h http.Header) string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, strings.ToLower(k))
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k + ":" + strings.TrimSpace(h.Get(k)) + "\n")
+	}
+	return b.String()
+}
+
+func signedHeaderList(h http.Header) string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, strings.ToLower(k))
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ";")
+}
+
+// Query ordenada y con el encoding que pide SigV4 (espacios como %20, no +)
+func canonicalQuery(q url.Values) string {
+	if len(q) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func encodePath(p string) string {
+	return uriEncode(p, false)
+}
+
+// Encoding RFC 3986: solo quedan sin escapar A-Z a-z 0-9 - _ . ~ (y "/" en paths)
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
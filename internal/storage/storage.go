@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("Image not found")
+	ErrInvalidKey = errors.New("Invalid storage key")
+)
+
+// ObjectInfo describe un archivo guardado. Key siempre usa "/" (ej: user_<id>/<uuid>.jpg).
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// ImageStore abstrae dónde se guardan las imágenes subidas (disco local, S3, MinIO...).
+type ImageStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	Delete(ctx context.Context, key string) error // si no existe no es error
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// URL directa al archivo (firmada y con vencimiento en S3). Vacío si el backend no tiene una.
+	SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// CleanKey valida una key que viene de afuera (URL, db) para que no se escape de la raíz.
+func CleanKey(key string) (string, error) {
+	key = strings.TrimPrefix(strings.ReplaceAll(key, "\\", "/"), "/")
+	if key == "" {
+		return "", ErrInvalidKey
+	}
+	clean := path.Clean(key)
+	if clean != key || clean == "." || strings.HasPrefix(clean, "../") || clean == ".." {
+		return "", ErrInvalidKey
+	}
+	return clean, nil
+}
+
+// ContentTypeByExt es el mime que se usa cuando el backend no guarda uno
+func ContentTypeByExt(key string) string {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".webp":
+		return "image/webp"
+	case ".gif":
+		return "image/gif"
+	default:
+		return "application/octet-stream"
+	}
+}
@@ -0,0 +1,28 @@
+package http
+
+import (
+	"view-list/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AdminHandler struct {
+	uploadGC *service.UploadGC
+}
+
+func NewAdminHandler(uploadGC *service.UploadGC) *AdminHandler {
+	return &AdminHandler{uploadGC}
+}
+
+// POST /api/admin/uploads/gc?dry_run=true
+// Corre el recolector en el momento y devuelve el reporte completo
+func (h *AdminHandler) RunUploadGC(c *fiber.Ctx) error {
+	dryRun := c.QueryBool("dry_run", false)
+
+	report, err := h.uploadGC.Run(c.Context(), dryRun)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": report, "message": "Upload GC finished"})
+}
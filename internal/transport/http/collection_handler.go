@@ -0,0 +1,251 @@
+package http
+
+import (
+	"errors"
+	"view-list/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CollectionHandler struct {
+	svc    *service.CollectionService
+	mangas *service.MangaService
+}
+
+func NewCollectionHandler(svc *service.CollectionService, mangas *service.MangaService) *CollectionHandler {
+	return &CollectionHandler{svc: svc, mangas: mangas}
+}
+
+type addMangaRequest struct {
+	MediaID string `json:"media_id"`
+	MangaID string `json:"manga_id"` // nombre de antes, se sigue aceptando
+}
+
+// Para reordenar arrastrando: after es el ID del elemento que queda antes (vacío = primero)
+type moveRequest struct {
+	After string `json:"after"`
+}
+
+// GET /api/collections
+func (h *CollectionHandler) List(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	cols, err := h.svc.List(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": cols, "message": "Collections retrieved successfully!"})
+}
+
+// POST /api/collections
+func (h *CollectionHandler) Create(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	var in service.CollectionInput
+	if err := c.BodyParser(&in); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+
+	col, err := h.svc.Create(c.Context(), userID, in)
+	if err != nil {
+		return c.Status(collectionErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"data": col, "message": "Collection created successfully!"})
+}
+
+// GET /api/collections/:id devuelve los mangas en el orden de la colección
+func (h *CollectionHandler) Get(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid collection ID"})
+	}
+
+	col, mangas, err := h.svc.Mangas(c.Context(), id, userID)
+	if err != nil {
+		return c.Status(collectionErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	h.mangas.PresentAll(mangas, h.mangas.ScoreScale(c.Context(), userID))
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": mangas, "collection": col, "message": "Collection retrieved successfully!"})
+}
+
+// PUT /api/collections/:id
+func (h *CollectionHandler) Update(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid collection ID"})
+	}
+
+	var in service.CollectionInput
+	if err := c.BodyParser(&in); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+
+	col, err := h.svc.Update(c.Context(), id, userID, in)
+	if err != nil {
+		return c.Status(collectionErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": col, "message": "Collection updated successfully!"})
+}
+
+// DELETE /api/collections/:id (los mangas no se borran)
+func (h *CollectionHandler) Delete(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid collection ID"})
+	}
+
+	if err := h.svc.Delete(c.Context(), id, userID); err != nil {
+		return c.Status(collectionErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Collection deleted successfully!"})
+}
+
+// PUT /api/collections/:id/position
+func (h *CollectionHandler) Move(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid collection ID"})
+	}
+
+	var req moveRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+
+	if err := h.svc.Move(c.Context(), id, userID, req.After); err != nil {
+		return c.Status(collectionErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Collection moved successfully!"})
+}
+
+// POST /api/collections/:id/mangas
+func (h *CollectionHandler) AddManga(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid collection ID"})
+	}
+
+	var req addMangaRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+	if req.MediaID != "" {
+		req.MangaID = req.MediaID
+	}
+	mangaID, err := primitive.ObjectIDFromHex(req.MangaID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid manga ID"})
+	}
+
+	if err := h.svc.AddManga(c.Context(), id, userID, mangaID); err != nil {
+		return c.Status(collectionErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Manga added to the collection!"})
+}
+
+// DELETE /api/collections/:id/mangas/:mangaId
+func (h *CollectionHandler) RemoveManga(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid collection ID"})
+	}
+	mangaID, err := primitive.ObjectIDFromHex(c.Params("mangaId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid manga ID"})
+	}
+
+	if err := h.svc.RemoveManga(c.Context(), id, userID, mangaID); err != nil {
+		return c.Status(collectionErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Manga removed from the collection!"})
+}
+
+// PUT /api/collections/:id/mangas/:mangaId/position
+func (h *CollectionHandler) MoveManga(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid collection ID"})
+	}
+	mangaID, err := primitive.ObjectIDFromHex(c.Params("mangaId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid manga ID"})
+	}
+
+	var req moveRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+
+	if err := h.svc.MoveManga(c.Context(), id, userID, mangaID, req.After); err != nil {
+		return c.Status(collectionErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Manga moved successfully!"})
+}
+
+// GET /api/mangas/:id/collections devuelve los IDs de las colecciones donde está
+func (h *CollectionHandler) OfManga(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	mangaID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid manga ID"})
+	}
+
+	ids, err := h.svc.CollectionsOf(c.Context(), mangaID, userID)
+	if err != nil {
+		return c.Status(collectionErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": ids, "message": "Collections retrieved successfully!"})
+}
+
+func collectionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrCollectionNotFound), errors.Is(err, service.ErrMangaNotFound),
+		errors.Is(err, service.ErrNotInCollection):
+		return fiber.StatusNotFound
+	case errors.Is(err, service.ErrAlreadyInCollection):
+		return fiber.StatusConflict
+	case errors.Is(err, service.ErrInvalidCollection):
+		return fiber.StatusBadRequest
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
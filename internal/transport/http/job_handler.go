@@ -0,0 +1,38 @@
+package http
+
+import (
+	"view-list/internal/domain"
+	"view-list/internal/jobs"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type JobHandler struct {
+	queue *jobs.Queue
+}
+
+func NewJobHandler(queue *jobs.Queue) *JobHandler {
+	return &JobHandler{queue}
+}
+
+// GET /api/admin/jobs?status=dead&limit=50
+func (h *JobHandler) ListJobs(c *fiber.Ctx) error {
+	status := domain.JobStatus(c.Query("status"))
+	switch status {
+	case "", domain.JobStatusPending, domain.JobStatusRunning, domain.JobStatusDone, domain.JobStatusDead:
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid job status"})
+	}
+
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 500 {
+		limit = 100
+	}
+
+	list, err := h.queue.List(c.Context(), status, int64(limit))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": list, "message": "Jobs retrieved successfully!"})
+}
@@ -1,45 +1,221 @@
 package http
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"io"
-	"strings"
+	"mime/multipart"
 	"time"
 	"view-list/internal/domain"
+	"view-list/internal/fetch"
+	"view-list/internal/imaging"
+	"view-list/internal/query"
 	"view-list/internal/service"
-	"view-list/internal/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// MangaHandler sirve /api/media y, por compatibilidad, /api/mangas: las mismas rutas, pero
+// /api/mangas solo ve mangas y responde con los nombres de siempre (chapter, total_chapters).
 type MangaHandler struct {
-	svc *service.MangaService
+	svc    *service.MangaService
+	kind   domain.MediaKind // vacío = todos los tipos (/api/media)
+	noun   string           // para los mensajes
+	plural string
 }
 
 func NewMangaHandler(svc *service.MangaService) *MangaHandler {
-	return &MangaHandler{svc}
+	return &MangaHandler{svc: svc, kind: domain.KindManga, noun: "Manga", plural: "Mangas"}
 }
 
-// Structs para create & update
+func NewMediaHandler(svc *service.MangaService) *MangaHandler {
+	return &MangaHandler{svc: svc, noun: "Media", plural: "Media"}
+}
+
+// mediaResponse es como sale cada elemento por /api/media: los campos de domain.Media, pero el
+// progreso se llama current/total (en la unidad del tipo) en vez de chapter/total_chapters.
+// /api/mangas responde domain.Manga tal cual.
+type mediaResponse struct {
+	ID                primitive.ObjectID       `json:"_id"`
+	Kind              domain.MediaKind         `json:"kind"`
+	Unit              domain.ProgressUnit      `json:"unit"`
+	Name              string                   `json:"name"`
+	State             domain.MangaState        `json:"state"`
+	Current           float64                  `json:"current"`
+	Volume            int                      `json:"volume"`
+	Total             float64                  `json:"total"`
+	TotalVolumes      int                      `json:"total_volumes"`
+	PublicationStatus domain.PublicationStatus `json:"publication_status"`
+	Progress          *float64                 `json:"progress,omitempty"`
+	Score             *float64                 `json:"score,omitempty"`
+	Review            string                   `json:"review,omitempty"`
+	ReviewSpoiler     bool                     `json:"review_spoiler,omitempty"`
+	Image             string                   `json:"image"`
+	Variants          map[string]string        `json:"variants,omitempty"`
+	Link              string                   `json:"link"`
+	Description       string                   `json:"description"`
+	Genre             []string                 `json:"genre"`
+	UserID            primitive.ObjectID       `json:"user_id"`
+	CreatedAt         time.Time                `json:"created_at"`
+	UpdatedAt         time.Time                `json:"updated_at"`
+
+	AltTitles        []domain.AltTitle  `json:"alt_titles,omitempty"`
+	Authors          []string           `json:"authors,omitempty"`
+	Artists          []string           `json:"artists,omitempty"`
+	Type             domain.SeriesType  `json:"type,omitempty"`
+	Demographic      domain.Demographic `json:"demographic,omitempty"`
+	OriginalLanguage string             `json:"original_language,omitempty"`
+	StartYear        int                `json:"start_year,omitempty"`
+	EndYear          int                `json:"end_year,omitempty"`
+	Sources          []domain.Source    `json:"sources,omitempty"`
+}
+
+func newMediaResponse(m *domain.Media) mediaResponse {
+	return mediaResponse{
+		ID:                m.ID,
+		Kind:              m.Kind,
+		Unit:              m.Unit,
+		Name:              m.Name,
+		State:             m.State,
+		Current:           m.Chapter,
+		Volume:            m.Volume,
+		Total:             m.TotalChapters,
+		TotalVolumes:      m.TotalVolumes,
+		PublicationStatus: m.PublicationStatus,
+		Progress:          m.Progress,
+		Score:             m.ScoreDisplay,
+		Review:            m.Review,
+		ReviewSpoiler:     m.ReviewSpoiler,
+		Image:             m.Image,
+		Variants:          m.Variants,
+		Link:              m.Link,
+		Description:       m.Description,
+		Genre:             m.Genre,
+		UserID:            m.UserID,
+		CreatedAt:         m.CreatedAt,
+		UpdatedAt:         m.UpdatedAt,
+		AltTitles:         m.AltTitles,
+		Authors:           m.Authors,
+		Artists:           m.Artists,
+		Type:              m.Type,
+		Demographic:       m.Demographic,
+		OriginalLanguage:  m.OriginalLanguage,
+		StartYear:         m.StartYear,
+		EndYear:           m.EndYear,
+		Sources:           m.Sources,
+	}
+}
+
+func (h *MangaHandler) view(m *domain.Manga) any {
+	if h.kind != "" {
+		return m
+	}
+	return newMediaResponse(m)
+}
+
+func (h *MangaHandler) views(mangas []domain.Manga) any {
+	if h.kind != "" {
+		return mangas
+	}
+	out := make([]mediaResponse, len(mangas))
+	for i := range mangas {
+		out[i] = newMediaResponse(&mangas[i])
+	}
+	return out
+}
+
+var errWrongKind = errors.New("This endpoint only handles mangas, use /api/media")
+
+// El tipo de un create o update: en /api/mangas siempre manga
+func (h *MangaHandler) requestKind(kind domain.MediaKind) (domain.MediaKind, error) {
+	switch {
+	case h.kind == "":
+		return kind, nil // lo valida el servicio
+	case kind == "" || kind == h.kind:
+		return h.kind, nil
+	}
+	return "", errWrongKind
+}
+
+// owned trae el elemento si es del usuario y del tipo del handler; si no, responde como si no existiera
+func (h *MangaHandler) owned(c *fiber.Ctx, id primitive.ObjectID, userID string) (*domain.Manga, error) {
+	m, err := h.svc.GetOwned(c.Context(), id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if h.kind != "" && m.MediaKind() != h.kind {
+		return nil, service.ErrMangaNotFound
+	}
+	return m, nil
+}
+
+// Structs para create & update. En /api/media el progreso va como current/total (chapter y
+// total_chapters también se aceptan).
 type createMangaRequest struct {
+	Kind        domain.MediaKind  `json:"kind"`
+	Current     *float64          `json:"current"`
+	Total       *float64          `json:"total"`
 	Name        string            `json:"name"`
 	State       domain.MangaState `json:"state"`
-	Chapter     uint16            `json:"chapter"`
+	Chapter     float64           `json:"chapter"`
+	Volume      int               `json:"volume"`
 	Image       string            `json:"image"` // Mongo deja hasta 16MB por data
 	Link        string            `json:"link"`
 	Description string            `json:"description"`
 	Genre       []string          `json:"genre"`
+	FetchImage  bool              `json:"fetch_image"` // si image es una URL, el server la baja y la guarda
+
+	TotalChapters     float64                  `json:"total_chapters"`
+	TotalVolumes      int                      `json:"total_volumes"`
+	PublicationStatus domain.PublicationStatus `json:"publication_status"`
+
+	Score         float64 `json:"score"` // en la escala del usuario; 0 = sin puntaje
+	Review        string  `json:"review"`
+	ReviewSpoiler bool    `json:"review_spoiler"`
+
+	AltTitles        []domain.AltTitle  `json:"alt_titles"`
+	Authors          []string           `json:"authors"`
+	Artists          []string           `json:"artists"`
+	Type             domain.SeriesType  `json:"type"`
+	Demographic      domain.Demographic `json:"demographic"`
+	OriginalLanguage string             `json:"original_language"`
+	StartYear        int                `json:"start_year"`
+	EndYear          int                `json:"end_year"`
+	Sources          []domain.Source    `json:"sources"`
 }
 type updateMangaRequest struct {
+	Kind        *domain.MediaKind  `json:"kind,omitempty"`
+	Current     *float64           `json:"current,omitempty"`
+	Total       *float64           `json:"total,omitempty"`
 	Name        *string            `json:"name,omitempty"`
 	State       *domain.MangaState `json:"state,omitempty"`
-	Chapter     *uint16            `json:"chapter,omitempty"`
+	Chapter     *float64           `json:"chapter,omitempty"`
+	Volume      *int               `json:"volume,omitempty"`
 	Image       *string            `json:"image,omitempty"`
 	Link        *string            `json:"link,omitempty"`
 	Description *string            `json:"description,omitempty"`
 	Genre       *[]string          `json:"genre,omitempty"`
+	FetchImage  bool               `json:"fetch_image,omitempty"`
+
+	TotalChapters     *float64                  `json:"total_chapters,omitempty"`
+	TotalVolumes      *int                      `json:"total_volumes,omitempty"`
+	PublicationStatus *domain.PublicationStatus `json:"publication_status,omitempty"`
+
+	Score         *float64 `json:"score,omitempty"` // 0 saca el puntaje
+	Review        *string  `json:"review,omitempty"`
+	ReviewSpoiler *bool    `json:"review_spoiler,omitempty"`
+
+	AltTitles        *[]domain.AltTitle  `json:"alt_titles,omitempty"`
+	Authors          *[]string           `json:"authors,omitempty"`
+	Artists          *[]string           `json:"artists,omitempty"`
+	Type             *domain.SeriesType  `json:"type,omitempty"`
+	Demographic      *domain.Demographic `json:"demographic,omitempty"`
+	OriginalLanguage *string             `json:"original_language,omitempty"`
+	StartYear        *int                `json:"start_year,omitempty"`
+	EndYear          *int                `json:"end_year,omitempty"`
+	Sources          *[]domain.Source    `json:"sources,omitempty"`
 }
 
 // * Comienzan los métodos de la API
@@ -54,32 +230,77 @@ func (h *MangaHandler) CreateManga(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
 	}
 
-	if strings.HasPrefix(req.Image, "data:image") {
-		url, err := utils.SaveBase64ImageForUser(req.Image, userID)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save image"})
-		}
-		req.Image = url
+	kind, err := h.requestKind(req.Kind)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if req.Current != nil {
+		req.Chapter = *req.Current
+	}
+	if req.Total != nil {
+		req.TotalChapters = *req.Total
+	}
+
+	score, err := h.svc.NormalizeScore(c.Context(), userID, req.Score)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var variants map[string]string
+	img, err := h.svc.StoreImage(c.Context(), req.Image, req.FetchImage, userID)
+	if err != nil {
+		return imageError(c, err)
+	}
+	if img != nil {
+		req.Image = img.Key
+		variants = img.Variants
 	}
 
 	manga := &domain.Manga{
 		ID:          primitive.NewObjectID(),
+		Kind:        kind,
 		Name:        req.Name,
 		State:       req.State,
 		Chapter:     req.Chapter,
+		Volume:      req.Volume,
 		Image:       req.Image,
+		Variants:    variants,
 		Link:        req.Link,
 		Description: req.Description,
 		Genre:       req.Genre,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+
+		TotalChapters:     req.TotalChapters,
+		TotalVolumes:      req.TotalVolumes,
+		PublicationStatus: req.PublicationStatus,
+
+		Score:         score,
+		Review:        req.Review,
+		ReviewSpoiler: req.ReviewSpoiler,
+
+		AltTitles:        req.AltTitles,
+		Authors:          req.Authors,
+		Artists:          req.Artists,
+		Type:             req.Type,
+		Demographic:      req.Demographic,
+		OriginalLanguage: req.OriginalLanguage,
+		StartYear:        req.StartYear,
+		EndYear:          req.EndYear,
+		Sources:          req.Sources,
+
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
 	}
 
 	if err := h.svc.Create(c.Context(), manga, userID); err != nil {
+		// La portada ya sumó su referencia (y su espacio): sin manga no la usa nadie
+		if img != nil {
+			h.svc.RemoveImageAsync(c.Context(), img.Key, userID)
+		}
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"data": manga, "message": "Manga created successfully!"})
+	h.svc.Present(manga, h.svc.ScoreScale(c.Context(), userID))
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"data": h.view(manga), "message": h.noun + " created successfully!"})
 }
 
 func (h *MangaHandler) GetMangas(c *fiber.Ctx) error {
@@ -88,15 +309,47 @@ func (h *MangaHandler) GetMangas(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
 	}
 
-	state := c.Query("state")
-	search := c.Query("search")
+	// q es el lenguaje de filtros (ver internal/query); state y search se mantienen y se suman con AND
+	f, err := query.Parse(c.Query("q"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if state := c.Query("state"); state != "" {
+		f = query.Combine(f, query.Cond{Field: query.FieldState, Op: query.OpIn, Strings: []string{state}})
+	}
+	if search := c.Query("search"); search != "" {
+		f = query.Combine(f, query.Text{Value: search})
+	}
+	if h.kind != "" {
+		f = query.Combine(f, query.Cond{Field: query.FieldKind, Op: query.OpIn, Strings: []string{string(h.kind)}})
+	}
+	sort := c.Query("sort")
+	if err := service.ValidateSort(sort); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 
-	mangas, err := h.svc.ListAll(c.Context(), userID, state, search)
+	// facets=true suma los conteos por estado y género del mismo filtro (tabs y chips sin más requests)
+	var mangas []domain.Manga
+	var facets *domain.Facets
+	if c.QueryBool("facets") {
+		mangas, facets, err = h.svc.ListWithFacets(c.Context(), userID, f)
+	} else {
+		mangas, err = h.svc.ListAll(c.Context(), userID, f)
+	}
+	if errors.Is(err, query.ErrSyntax) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": mangas, "message": "Mangas retrieved successfully!"})
+	service.SortMangas(mangas, sort)
+	h.svc.PresentAll(mangas, h.svc.ScoreScale(c.Context(), userID))
+	resp := fiber.Map{"data": h.views(mangas), "message": h.plural + " retrieved successfully!"}
+	if facets != nil {
+		resp["facets"] = facets
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
 }
 
 func (h *MangaHandler) GetManga(c *fiber.Ctx) error {
@@ -106,12 +359,19 @@ func (h *MangaHandler) GetManga(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	manga, err := h.svc.GetByID(c.Context(), id)
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	// Solo el dueño: la respuesta lleva URLs firmadas de sus imágenes
+	manga, err := h.owned(c, id, userID)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": manga, "message": "Manga retrieved successfully!"})
+	h.svc.Present(manga, h.svc.ScoreScale(c.Context(), userID))
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": h.view(manga), "message": h.noun + " retrieved successfully!"})
 }
 
 func (h *MangaHandler) UpdateManga(c *fiber.Ctx) error {
@@ -131,8 +391,26 @@ func (h *MangaHandler) UpdateManga(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	oldManga, err := h.owned(c, id, userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	// Hago el mapeo de updates
 	updates := bson.M{}
+	if req.Kind != nil {
+		kind, err := h.requestKind(*req.Kind)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		updates["kind"] = kind
+	}
+	if req.Current != nil {
+		req.Chapter = req.Current
+	}
+	if req.Total != nil {
+		req.TotalChapters = req.Total
+	}
 	if req.Name != nil {
 		updates["name"] = *req.Name
 	}
@@ -142,45 +420,101 @@ func (h *MangaHandler) UpdateManga(c *fiber.Ctx) error {
 	if req.Chapter != nil {
 		updates["chapter"] = *req.Chapter
 	}
+	if req.Volume != nil {
+		updates["volume"] = *req.Volume
+	}
+	if req.TotalChapters != nil {
+		updates["total_chapters"] = *req.TotalChapters
+	}
+	if req.TotalVolumes != nil {
+		updates["total_volumes"] = *req.TotalVolumes
+	}
+	if req.PublicationStatus != nil {
+		updates["publication_status"] = *req.PublicationStatus
+	}
+	if req.Score != nil {
+		score, err := h.svc.NormalizeScore(c.Context(), userID, *req.Score)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		updates["score"] = score
+	}
+	if req.Review != nil {
+		updates["review"] = *req.Review
+	}
+	if req.ReviewSpoiler != nil {
+		updates["review_spoiler"] = *req.ReviewSpoiler
+	}
 	if req.Link != nil {
 		updates["link"] = *req.Link
 	}
+	if req.AltTitles != nil {
+		updates["alt_titles"] = *req.AltTitles
+	}
+	if req.Authors != nil {
+		updates["authors"] = *req.Authors
+	}
+	if req.Artists != nil {
+		updates["artists"] = *req.Artists
+	}
+	if req.Type != nil {
+		updates["type"] = *req.Type
+	}
+	if req.Demographic != nil {
+		updates["demographic"] = *req.Demographic
+	}
+	if req.OriginalLanguage != nil {
+		updates["original_language"] = *req.OriginalLanguage
+	}
+	if req.StartYear != nil {
+		updates["start_year"] = *req.StartYear
+	}
+	if req.EndYear != nil {
+		updates["end_year"] = *req.EndYear
+	}
+	if req.Sources != nil {
+		updates["sources"] = *req.Sources
+	}
 	if req.Description != nil {
 		updates["description"] = *req.Description
 	}
 	if req.Genre != nil {
 		updates["genre"] = *req.Genre
 	}
+	var img *service.StoredImage
 	if req.Image != nil {
-		if strings.HasPrefix(*req.Image, "data:image") {
-			oldManga, err := h.svc.GetByID(c.Context(), id)
-			if err == nil && oldManga.Image != "" {
-				// Borrar la imagen vieja de forma asíncrona
-				oldImagePath := "." + oldManga.Image // Agregar "./" si es necesario
-				go func() {
-					time.Sleep(200 * time.Millisecond)
-					if err := utils.DeleteFileWithRetry(oldImagePath, 8); err != nil {
-						fmt.Printf("warning: error deleting old image %s: %v\n", oldImagePath, err)
-					}
-				}()
-			}
-
-			// Guardar la nueva imagen en la carpeta del usuario
-			url, err := utils.SaveBase64ImageForUser(*req.Image, userID)
-			if err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save image"})
-			}
-			updates["image"] = url
+		img, err = h.svc.StoreImage(c.Context(), *req.Image, req.FetchImage, userID)
+		if err != nil {
+			return imageError(c, err)
+		}
+		if img != nil {
+			updates["image"] = img.Key
+			updates["variants"] = img.Variants
 		}
 	}
 
 	updates["updated_at"] = time.Now()
 
 	if err := h.svc.Update(c.Context(), id, updates); err != nil {
+		// El manga sigue con la portada vieja: la nueva no la usa nadie
+		if img != nil {
+			h.svc.RemoveImageAsync(c.Context(), img.Key, userID)
+		}
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
+	// Recién con el cambio guardado se suelta la vieja. Si es la misma imagen, StoreImage ya sumó
+	// la referencia nueva, así que el archivo no se borra.
+	if img != nil && oldManga.Image != "" {
+		h.svc.RemoveImageAsync(c.Context(), oldManga.Image, userID)
+	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Manga updated successfully!"})
+	// Se devuelve el manga como quedó: el update puede haber cambiado el estado solo (último capítulo)
+	manga, err := h.svc.GetByID(c.Context(), id)
+	if err != nil {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": h.noun + " updated successfully!"})
+	}
+	h.svc.Present(manga, h.svc.ScoreScale(c.Context(), userID))
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": h.view(manga), "message": h.noun + " updated successfully!"})
 }
 
 func (h *MangaHandler) DeleteManga(c *fiber.Ctx) error {
@@ -190,11 +524,130 @@ func (h *MangaHandler) DeleteManga(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	if _, err := h.owned(c, id, userID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	if err := h.svc.Delete(c.Context(), id); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Manga deleted successfully!"})
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": h.noun + " deleted successfully!"})
+}
+
+// POST /api/mangas/:id/cover
+// Acepta multipart (campo "cover") o el binario crudo con Content-Type image/*
+func (h *MangaHandler) UploadCover(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	if _, err := h.owned(c, id, userID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// El cuerpo no se junta en memoria: la imagen va leyéndose del request hasta el límite de imaging
+	body := requestBody(c)
+	if boundary := string(c.Request().Header.MultipartFormBoundary()); boundary != "" {
+		part, err := formPart(multipart.NewReader(body, boundary), "cover")
+		if errors.Is(err, errBodyTooLarge) {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Missing \"cover\" file"})
+		}
+		defer part.Close()
+		body = part
+	} else if c.Request().Header.ContentLength() == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Empty body"})
+	}
+
+	img, err := h.svc.SetCover(c.Context(), id, userID, body)
+	if err != nil {
+		if errors.Is(err, service.ErrMangaNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return imageError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": h.svc.ImageURLs(img, userID), "message": "Cover uploaded successfully!"})
+}
+
+// formPart avanza el multipart hasta el archivo del campo name, sin leer el resto del cuerpo
+func formPart(mr *multipart.Reader, name string) (*multipart.Part, error) {
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == name && part.FileName() != "" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// DELETE /api/mangas/:id/cover
+func (h *MangaHandler) DeleteCover(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	if _, err := h.owned(c, id, userID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := h.svc.RemoveCover(c.Context(), id, userID); err != nil {
+		return c.Status(coverErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Cover deleted successfully!"})
+}
+
+func coverErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrMangaNotFound):
+		return fiber.StatusNotFound
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
+
+// Los rechazos de imaging se devuelven con el motivo; cualquier otro error es del server
+func imageError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrQuotaExceeded):
+		return c.Status(fiber.StatusInsufficientStorage).JSON(fiber.Map{"error": err.Error(), "code": "quota_exceeded"})
+	case errors.Is(err, imaging.ErrTooLarge):
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, imaging.ErrUnsupportedFormat):
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, imaging.ErrInvalidImage):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, fetch.ErrFetch):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrImageBusy):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, errBodyTooLarge):
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": err.Error()})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save image"})
+	}
 }
 
 func (h *MangaHandler) DeleteAllMangas(c *fiber.Ctx) error {
@@ -203,11 +656,16 @@ func (h *MangaHandler) DeleteAllMangas(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
 	}
 
-	if err := h.svc.DeleteAll(c.Context(), userID); err != nil {
+	// /api/mangas borra solo los mangas; /api/media, todo
+	deleteAll := h.svc.DeleteAll
+	if h.kind != "" {
+		deleteAll = func(ctx context.Context, userID string) error { return h.svc.DeleteKind(ctx, userID, h.kind) }
+	}
+	if err := deleteAll(c.Context(), userID); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Mangas deleted successfully!"})
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": h.plural + " deleted successfully!"})
 }
 
 // Exporta un bson al front
@@ -227,7 +685,69 @@ func (h *MangaHandler) ExportUserMangas(c *fiber.Ctx) error {
 	return c.Send(data)
 }
 
-// Importa un bson desde el front a la db
+// Encola la generación del backup. Se descarga con DownloadExport cuando el job termina
+func (h *MangaHandler) QueueExport(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	job, err := h.svc.QueueExport(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"data": job, "message": "Export queued"})
+}
+
+func (h *MangaHandler) DownloadExport(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	jobID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	rc, info, err := h.svc.ExportFile(c.Context(), userID, jobID)
+	if errors.Is(err, service.ErrExportNotReady) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, service.ErrExportExpired) {
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set("Content-Type", "application/octet-stream")
+	c.Set("Content-Disposition", "attachment; filename=mangas_backup.bson")
+	return c.SendStream(rc, int(info.Size))
+}
+
+// Estado de un job de import/export del usuario
+func (h *MangaHandler) GetBackupJob(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	jobID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	job, err := h.svc.GetUserJob(c.Context(), userID, jobID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": job, "message": "Job retrieved successfully!"})
+}
+
+// Importa un bson desde el front a la db (en segundo plano, por la cola de jobs)
 func (h *MangaHandler) ImportUserMangas(c *fiber.Ctx) error {
 	userID, ok := c.Locals("user_id").(string)
 	if !ok {
@@ -250,9 +770,10 @@ func (h *MangaHandler) ImportUserMangas(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	if err := h.svc.ImportUserMangas(c.Context(), userID, data); err != nil {
+	job, err := h.svc.QueueImport(c.Context(), userID, data)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Import successfull"})
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"data": job, "message": "Import queued"})
 }
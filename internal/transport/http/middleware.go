@@ -1,19 +1,19 @@
 package http
 
 import (
-	"os"
+	"bytes"
+	"errors"
+	"io"
 	"strings"
+	"view-list/internal/auth"
+	"view-list/internal/config"
+	"view-list/internal/domain"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func JWTMiddleware() fiber.Handler {
-	secret := []byte(os.Getenv(("JWT_SECRET")))
-	if secret == nil {
-		secret = []byte("en-mi-opinion-profesional-es-timpo-para-PANICO")
-	}
-
+func JWTMiddleware(keys *auth.KeyManager) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
@@ -26,9 +26,7 @@ func JWTMiddleware() fiber.Handler {
 		}
 
 		tokenString := parts[1]
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return secret, nil
-		})
+		token, err := keys.Parse(tokenString)
 
 		if err != nil || !token.Valid {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
@@ -50,3 +48,92 @@ func JWTMiddleware() fiber.Handler {
 
 	}
 }
+
+// AdminMiddleware va después de JWTMiddleware: deja pasar solo a los emails de ADMIN_EMAILS
+func AdminMiddleware(userSvc domain.UserService, cfg *config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, ok := c.Locals("user_id").(string)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		user, err := userSvc.GetByID(c.Context(), userID)
+		if err != nil || !cfg.IsAdmin(user.Email) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+		}
+		return c.Next()
+	}
+}
+
+var errBodyTooLarge = errors.New("Request body too large")
+
+// BodyLimit reemplaza el límite de fasthttp, que con StreamRequestBody deja pasar cuerpos más grandes
+// como stream. Las rutas de stream (ej: subir portada) reciben el cuerpo en Locals("body") ya limitado
+// y lo leen de a poco; al resto se le lee entero acá, hasta limit, como antes.
+// Si el cuerpo queda sin leer se cierra la conexión: lo que sobra no se puede tomar como otro request.
+func BodyLimit(limit int, stream func(c *fiber.Ctx) bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Request().Header.ContentLength() > limit {
+			c.Context().SetConnectionClose()
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": errBodyTooLarge.Error()})
+		}
+		body := c.Context().RequestBodyStream()
+		if body == nil {
+			return c.Next()
+		}
+		limited := &limitedReader{r: body, n: int64(limit)}
+		if stream(c) {
+			c.Locals("body", io.Reader(limited))
+			err := c.Next()
+			if !limited.eof {
+				c.Context().SetConnectionClose()
+			}
+			return err
+		}
+		// Content-Length conocido y dentro del límite: fasthttp ya lo tiene en memoria
+		if c.Request().Header.ContentLength() >= 0 {
+			return c.Next()
+		}
+		data, err := io.ReadAll(limited)
+		if err != nil {
+			c.Context().SetConnectionClose()
+			if errors.Is(err, errBodyTooLarge) {
+				return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		c.Request().SetBody(data)
+		return c.Next()
+	}
+}
+
+// requestBody devuelve el cuerpo que dejó BodyLimit para las rutas de stream
+func requestBody(c *fiber.Ctx) io.Reader {
+	if r, ok := c.Locals("body").(io.Reader); ok {
+		return r
+	}
+	return bytes.NewReader(c.Body())
+}
+
+// Como io.LimitReader pero falla con errBodyTooLarge en vez de cortar en silencio
+type limitedReader struct {
+	r   io.Reader
+	n   int64
+	eof bool // se leyó todo el cuerpo
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errBodyTooLarge
+	}
+	l.eof = err == io.EOF
+	return n, err
+}
@@ -2,18 +2,30 @@ package http
 
 import (
 	"path/filepath"
+	"strings"
+	"view-list/internal/auth"
+	"view-list/internal/config"
+	"view-list/internal/fetch"
+	"view-list/internal/jobs"
 	"view-list/internal/repository"
 	"view-list/internal/service"
+	"view-list/internal/storage"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func NewRouter(db *mongo.Database, staticDir string) *fiber.App {
+func NewRouter(db *mongo.Database, cfg *config.Config, keys *auth.KeyManager, queue *jobs.Queue, images, quarantine, jobFiles storage.ImageStore) *fiber.App {
+	// El cuerpo llega como stream: el límite lo pone BodyLimit y las portadas no se juntan en memoria
 	app := fiber.New(fiber.Config{
-		BodyLimit: 20 * 1024 * 1024, // 100 MB, si hay más tira error
+		BodyLimit:                    cfg.BodyLimit,
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
 	})
+	app.Use(BodyLimit(cfg.BodyLimit, func(c *fiber.Ctx) bool {
+		return c.Method() == fiber.MethodPost && strings.HasSuffix(c.Path(), "/cover")
+	}))
 
 	// --- CORS ---
 	app.Use(cors.New(cors.Config{
@@ -25,14 +37,42 @@ func NewRouter(db *mongo.Database, staticDir string) *fiber.App {
 	// --- Repository ---
 	mangaRepo := repository.NewMangaRepo(db)
 	userRepo := repository.NewUserRepo(db)
+	collectionRepo := repository.NewCollectionRepo(db)
 
 	// --- Services ---
-	mangaSvc := service.NewMangaService(mangaRepo)
+	signer := auth.NewURLSigner(keys, cfg.UploadURLTTL)
+	fetcher := fetch.NewFetcher(fetch.Options{
+		Timeout:      cfg.RemoteFetchTimeout,
+		MaxBytes:     int64(cfg.ImageMaxBytes),
+		AllowPrivate: cfg.RemoteFetchAllowPrivate,
+	})
+	imageSvc := service.NewImageService(images, repository.NewImageRefRepo(db), userRepo, service.ImageOptions{
+		Limits:    cfg.ImageLimits(),
+		Quota:     int64(cfg.UserStorageQuota),
+		Fetcher:   fetcher,
+		Signer:    signer,
+		PublicURL: cfg.PublicURL(),
+	})
+	stateSvc := service.NewStateService(userRepo, mangaRepo)
+	scoreSvc := service.NewScoreService(userRepo)
+	mangaSvc := service.NewMangaService(mangaRepo, collectionRepo, stateSvc, scoreSvc, queue, imageSvc, jobFiles)
 	userSvc := service.NewUserService(userRepo)
+	smartListSvc := service.NewSmartListService(repository.NewSmartListRepo(db), mangaSvc)
+	collectionSvc := service.NewCollectionService(collectionRepo, mangaSvc)
+	uploadGC := service.NewUploadGC(mangaRepo, queue, imageSvc, quarantine, cfg.UploadGCGrace, cfg.QuarantineRetention)
+	service.NewJobFileCleaner(queue, jobFiles, cfg.JobFileTTL)
 
 	// --- Handlers ---
 	mangaHandler := NewMangaHandler(mangaSvc)
-	userHandler := NewUserHandler(userSvc)
+	mediaHandler := NewMediaHandler(mangaSvc)
+	userHandler := NewUserHandler(userSvc, keys, int64(cfg.UserStorageQuota))
+	jobHandler := NewJobHandler(queue)
+	smartListHandler := NewSmartListHandler(smartListSvc, mangaSvc)
+	collectionHandler := NewCollectionHandler(collectionSvc, mangaSvc)
+	stateHandler := NewStateHandler(stateSvc)
+	scoreHandler := NewScoreHandler(scoreSvc)
+	adminHandler := NewAdminHandler(uploadGC)
+	uploadHandler := NewUploadHandler(images, keys, signer, cfg.ImageServeMode == config.ServePresign, cfg.PresignTTL)
 
 	// --- Health check ---
 	app.Get("/health", func(c *fiber.Ctx) error {
@@ -45,39 +85,71 @@ func NewRouter(db *mongo.Database, staticDir string) *fiber.App {
 	auth.Post("/login", userHandler.Login)
 
 	// --- Protected API ---
-	api := app.Group("/api", JWTMiddleware())
+	api := app.Group("/api", JWTMiddleware(keys))
 
 	api.Get("/me", userHandler.Me)
+	api.Get("/states", stateHandler.List)
+	api.Put("/states", stateHandler.Replace)
+	api.Get("/score-scale", scoreHandler.Get)
+	api.Put("/score-scale", scoreHandler.Set)
+
+	mediaRoutes(api.Group("/media"), mediaHandler, collectionHandler)
+	// /api/mangas queda por compatibilidad: mismas rutas, solo mangas y con los nombres de antes
+	mediaRoutes(api.Group("/mangas"), mangaHandler, collectionHandler)
+
+	collectionGroup := api.Group("/collections")
+	collectionGroup.Get("/", collectionHandler.List)
+	collectionGroup.Post("/", collectionHandler.Create)
+	collectionGroup.Get("/:id", collectionHandler.Get)
+	collectionGroup.Put("/:id", collectionHandler.Update)
+	collectionGroup.Delete("/:id", collectionHandler.Delete)
+	collectionGroup.Put("/:id/position", collectionHandler.Move)
+	for _, items := range []string{"/:id/media", "/:id/mangas"} {
+		collectionGroup.Post(items, collectionHandler.AddManga)
+		collectionGroup.Delete(items+"/:mangaId", collectionHandler.RemoveManga)
+		collectionGroup.Put(items+"/:mangaId/position", collectionHandler.MoveManga)
+	}
 
-	mangaGroup := api.Group("/mangas")
-	mangaGroup.Post("/", mangaHandler.CreateManga)
-	mangaGroup.Get("/", mangaHandler.GetMangas)
-	mangaGroup.Get("/:id", mangaHandler.GetManga)
-	mangaGroup.Put("/:id", mangaHandler.UpdateManga)
-	mangaGroup.Delete("/:id", mangaHandler.DeleteManga)
-	mangaGroup.Delete("/", mangaHandler.DeleteAllMangas)
+	smartGroup := api.Group("/lists/smart")
+	smartGroup.Get("/", smartListHandler.List)
+	smartGroup.Post("/", smartListHandler.Create)
+	smartGroup.Get("/:id", smartListHandler.Get)
+	smartGroup.Put("/:id", smartListHandler.Update)
+	smartGroup.Delete("/:id", smartListHandler.Delete)
 
 	backupGroup := api.Group("/backup")
 	backupGroup.Get("/", mangaHandler.ExportUserMangas)
 	backupGroup.Post("/", mangaHandler.ImportUserMangas)
+	backupGroup.Post("/export", mangaHandler.QueueExport)
+	backupGroup.Get("/export/:id", mangaHandler.DownloadExport)
+	backupGroup.Get("/jobs/:id", mangaHandler.GetBackupJob)
 
-	// --- Servir imágenes subidas ---
-	app.Static("/uploads", "./uploads", fiber.Static{
-		Compress:      true,
-		ByteRange:     true,
-		Browse:        false,
-		Index:         "",
-		CacheDuration: -1, // Importante: deshabilitar caché
-		MaxAge:        0,
-	})
+	adminGroup := api.Group("/admin", AdminMiddleware(userSvc, cfg))
+	adminGroup.Get("/jobs", jobHandler.ListJobs)
+	adminGroup.Post("/uploads/gc", adminHandler.RunUploadGC)
+
+	// --- Servir imágenes subidas (desde el storage, sirve igual con disco o S3) ---
+	app.Get("/uploads/*", uploadHandler.Serve)
 
 	// --- Frontend estático ---
-	if staticDir != "" {
-		app.Static("/", staticDir)
+	if cfg.StaticDir != "" {
+		app.Static("/", cfg.StaticDir)
 		app.Get("/*", func(c *fiber.Ctx) error {
-			return c.SendFile(filepath.Join(staticDir, "index.html"))
+			return c.SendFile(filepath.Join(cfg.StaticDir, "index.html"))
 		})
 	}
 
 	return app
 }
+
+func mediaRoutes(group fiber.Router, h *MangaHandler, collections *CollectionHandler) {
+	group.Post("/", h.CreateManga)
+	group.Get("/", h.GetMangas)
+	group.Get("/:id", h.GetManga)
+	group.Put("/:id", h.UpdateManga)
+	group.Delete("/:id", h.DeleteManga)
+	group.Delete("/", h.DeleteAllMangas)
+	group.Post("/:id/cover", h.UploadCover)
+	group.Delete("/:id/cover", h.DeleteCover)
+	group.Get("/:id/collections", collections.OfManga)
+}
@@ -0,0 +1,66 @@
+package http
+
+import (
+	"errors"
+	"view-list/internal/domain"
+	"view-list/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ScoreHandler struct {
+	svc *service.ScoreService
+}
+
+func NewScoreHandler(svc *service.ScoreService) *ScoreHandler {
+	return &ScoreHandler{svc: svc}
+}
+
+// La escala con sus límites, para que el cliente arme el selector de puntaje
+type scoreScaleResponse struct {
+	Scale domain.ScoreScale `json:"scale"`
+	Max   float64           `json:"max"`
+	Step  float64           `json:"step"`
+}
+
+func newScoreScaleResponse(scale domain.ScoreScale) scoreScaleResponse {
+	return scoreScaleResponse{Scale: scale, Max: scale.Max(), Step: scale.Step()}
+}
+
+// GET /api/score-scale
+func (h *ScoreHandler) Get(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	scale, err := h.svc.Scale(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": newScoreScaleResponse(scale), "message": "Score scale retrieved successfully!"})
+}
+
+// PUT /api/score-scale cambia la escala; los puntajes guardados no se tocan
+func (h *ScoreHandler) Set(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	var req struct {
+		Scale domain.ScoreScale `json:"scale"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+
+	err := h.svc.SetScale(c.Context(), userID, req.Scale)
+	switch {
+	case errors.Is(err, service.ErrInvalidScoreScale):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": newScoreScaleResponse(req.Scale), "message": "Score scale updated successfully!"})
+}
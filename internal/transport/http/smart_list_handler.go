@@ -0,0 +1,123 @@
+package http
+
+import (
+	"errors"
+	"view-list/internal/query"
+	"view-list/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SmartListHandler struct {
+	svc    *service.SmartListService
+	mangas *service.MangaService
+}
+
+func NewSmartListHandler(svc *service.SmartListService, mangas *service.MangaService) *SmartListHandler {
+	return &SmartListHandler{svc: svc, mangas: mangas}
+}
+
+// GET /api/lists/smart
+func (h *SmartListHandler) List(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	lists, err := h.svc.List(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": lists, "message": "Smart lists retrieved successfully!"})
+}
+
+// POST /api/lists/smart
+func (h *SmartListHandler) Create(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	var in service.SmartListInput
+	if err := c.BodyParser(&in); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+
+	list, err := h.svc.Create(c.Context(), userID, in)
+	if err != nil {
+		return c.Status(smartListErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"data": list, "message": "Smart list created successfully!"})
+}
+
+// GET /api/lists/smart/:id devuelve la lista evaluada: los mangas que cumplen el filtro hoy
+func (h *SmartListHandler) Get(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid smart list ID"})
+	}
+
+	list, mangas, err := h.svc.Evaluate(c.Context(), id, userID)
+	if err != nil {
+		return c.Status(smartListErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	h.mangas.PresentAll(mangas, h.mangas.ScoreScale(c.Context(), userID))
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": mangas, "list": list, "message": "Smart list retrieved successfully!"})
+}
+
+// PUT /api/lists/smart/:id reemplaza nombre, filtro, orden y fijados
+func (h *SmartListHandler) Update(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid smart list ID"})
+	}
+
+	var in service.SmartListInput
+	if err := c.BodyParser(&in); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+
+	list, err := h.svc.Update(c.Context(), id, userID, in)
+	if err != nil {
+		return c.Status(smartListErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": list, "message": "Smart list updated successfully!"})
+}
+
+// DELETE /api/lists/smart/:id
+func (h *SmartListHandler) Delete(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid smart list ID"})
+	}
+
+	if err := h.svc.Delete(c.Context(), id, userID); err != nil {
+		return c.Status(smartListErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Smart list deleted successfully!"})
+}
+
+func smartListErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrSmartListNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, service.ErrInvalidSmartList), errors.Is(err, query.ErrSyntax):
+		return fiber.StatusBadRequest
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
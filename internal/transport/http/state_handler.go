@@ -0,0 +1,61 @@
+package http
+
+import (
+	"errors"
+	"view-list/internal/domain"
+	"view-list/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type StateHandler struct {
+	svc *service.StateService
+}
+
+func NewStateHandler(svc *service.StateService) *StateHandler {
+	return &StateHandler{svc: svc}
+}
+
+type replaceStatesRequest struct {
+	States []domain.ReadingState `json:"states"`
+	// Para sacar un estado que tiene mangas: a qué estado pasan (key vieja -> key nueva)
+	Reassign map[domain.MangaState]domain.MangaState `json:"reassign"`
+}
+
+// GET /api/states
+func (h *StateHandler) List(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	states, err := h.svc.States(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": states, "message": "States retrieved successfully!"})
+}
+
+// PUT /api/states reemplaza el conjunto completo; el orden del array es el orden de los tabs
+func (h *StateHandler) Replace(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	var req replaceStatesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	}
+
+	states, err := h.svc.Replace(c.Context(), userID, req.States, req.Reassign)
+	switch {
+	case errors.Is(err, service.ErrInvalidStates):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrStateInUse):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": states, "message": "States updated successfully!"})
+}
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+	"view-list/internal/auth"
+	"view-list/internal/service"
+	"view-list/internal/storage"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type UploadHandler struct {
+	store      storage.ImageStore
+	keys       *auth.KeyManager
+	signer     *auth.URLSigner
+	presign    bool // redirigir a una URL firmada en vez de hacer de proxy
+	presignTTL time.Duration
+}
+
+func NewUploadHandler(store storage.ImageStore, keys *auth.KeyManager, signer *auth.URLSigner, presign bool, presignTTL time.Duration) *UploadHandler {
+	return &UploadHandler{store: store, keys: keys, signer: signer, presign: presign, presignTTL: presignTTL}
+}
+
+// Las keys nunca cambian de contenido (hash o uuid), así que se cachean para siempre.
+// "private" porque la respuesta depende de quién la pide.
+const immutableCache = "private, max-age=31536000, immutable"
+
+// GET /uploads/<key>?exp=...&sig=...
+// Pasa con la firma de la URL (la que devuelve la API en cada manga) o con el JWT del dueño.
+func (h *UploadHandler) Serve(c *fiber.Ctx) error {
+	key, err := storage.CleanKey(c.Params("*"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Image not found"})
+	}
+
+	if !h.allowed(c, key) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	etag := `"` + keyTag(key) + `"`
+	if match := c.Get(fiber.HeaderIfNoneMatch); match != "" && strings.Contains(match, etag) {
+		c.Set(fiber.HeaderETag, etag)
+		c.Set(fiber.HeaderCacheControl, immutableCache)
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	if h.presign {
+		url, err := h.store.SignedURL(c.Context(), key, h.presignTTL)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		// El disco no firma URLs, en ese caso sigue de largo y hace de proxy
+		if url != "" {
+			c.Set(fiber.HeaderCacheControl, "no-store")
+			return c.Redirect(url, fiber.StatusFound)
+		}
+	}
+
+	rc, info, err := h.store.Get(c.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Image not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set(fiber.HeaderContentType, info.ContentType)
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, immutableCache)
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	return c.SendStream(rc, int(info.Size))
+}
+
+func (h *UploadHandler) allowed(c *fiber.Ctx, key string) bool {
+	if sig := c.Query("sig"); sig != "" {
+		return h.signer.Verify(key, c.Query("exp"), sig, time.Now())
+	}
+
+	// Sin firma: solo el dueño con su token (ej: clientes que no son el navegador)
+	tokenString, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok {
+		return false
+	}
+	token, err := h.keys.Parse(tokenString)
+	if err != nil || !token.Valid {
+		return false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	userID, _ := claims["user_id"].(string)
+	return userID != "" && userID == service.OwnerOf(key)
+}
+
+// ETag fuerte: el contenido de una key no cambia nunca
+func keyTag(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
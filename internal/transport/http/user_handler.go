@@ -1,9 +1,11 @@
 package http
 
 import (
-	"os"
+	"errors"
 	"time"
+	"view-list/internal/auth"
 	"view-list/internal/domain"
+	"view-list/internal/service"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
@@ -11,12 +13,13 @@ import (
 )
 
 type UserHandler struct {
-	service   domain.UserService
-	jwtSecret []byte
+	service      domain.UserService
+	keys         *auth.KeyManager
+	storageQuota int64
 }
 
-func NewUserHandler(service domain.UserService) *UserHandler {
-	return &UserHandler{service: service, jwtSecret: []byte(os.Getenv("JWT_SECRET"))}
+func NewUserHandler(service domain.UserService, keys *auth.KeyManager, storageQuota int64) *UserHandler {
+	return &UserHandler{service: service, keys: keys, storageQuota: storageQuota}
 }
 
 // Helper struct para register y login
@@ -31,6 +34,12 @@ type loginRequest struct {
 	Password string `json:"password"`
 }
 
+// El usuario más el uso de su espacio de imágenes
+type meResponse struct {
+	*domain.User
+	Storage service.StorageUsage `json:"storage"`
+}
+
 // POST /register
 func (h *UserHandler) Register(c *fiber.Ctx) error {
 	var req registerRequest
@@ -52,6 +61,9 @@ func (h *UserHandler) Register(c *fiber.Ctx) error {
 	}
 
 	err = h.service.Register(c.Context(), user)
+	if errors.Is(err, service.ErrUserExists) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -71,12 +83,10 @@ func (h *UserHandler) Login(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	// Generar el token jwt
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	// Generar el token jwt (firmado con la clave activa)
+	tokenString, err := h.keys.Sign(jwt.MapClaims{
 		"user_id": user.ID.Hex(),
 	})
-
-	tokenString, err := token.SignedString(h.jwtSecret)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -96,5 +106,9 @@ func (h *UserHandler) Me(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": user, "message": "User retrieved successfully!"})
+	if user.ScoreScale == "" {
+		user.ScoreScale = domain.DefaultScoreScale
+	}
+	resp := meResponse{User: user, Storage: service.StorageUsage{Used: user.StorageUsed, Quota: h.storageQuota}}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": resp, "message": "User retrieved successfully!"})
 }
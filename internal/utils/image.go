@@ -4,27 +4,19 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net/url"
-	"os"
-	"path/filepath"
 	"strings"
-
-	"github.com/google/uuid"
+	"view-list/internal/storage"
 )
 
-// guarda una imagen base64 dentro de la carpeta del usuario y devuelve la URL pública.
-func SaveBase64ImageForUser(base64Data, userID string) (string, error) {
-	backendURL := os.Getenv("BACKEND_URL_WITHOUT_PORT") + os.Getenv("PORT")
-	if base64Data == "" {
-		return "", nil
-	}
-
+// Decodifica una imagen "data:image/...;base64,..." y devuelve los bytes y la extensión.
+func DecodeBase64Image(base64Data string) ([]byte, string, error) {
 	// limpiar espacios, saltos o comillas que pueden romper el formato
 	base64Data = strings.TrimSpace(base64Data)
 	base64Data = strings.Trim(base64Data, "\"")
 
 	// debe tener una coma que separe el header del contenido
 	if !strings.Contains(base64Data, ",") {
-		return "", fmt.Errorf("invalid base64 image format")
+		return nil, "", fmt.Errorf("invalid base64 image format")
 	}
 
 	parts := strings.SplitN(base64Data, ",", 2)
@@ -46,61 +38,38 @@ func SaveBase64ImageForUser(base64Data, userID string) (string, error) {
 	// decodificar base64
 	imgData, err := base64.StdEncoding.DecodeString(data)
 	if err != nil {
-		return "", fmt.Errorf("failed to decode base64 image: %w", err)
-	}
-
-	// crear carpeta del usuario si no existe
-	dir := filepath.Join("uploads", "user_"+userID)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", err
+		return nil, "", fmt.Errorf("failed to decode base64 image: %w", err)
 	}
-
-	// crear archivo con nombre único
-	filename := uuid.New().String() + ext
-	fullPath := filepath.Join(dir, filename)
-
-	if err := os.WriteFile(fullPath, imgData, 0644); err != nil {
-		return "", err
-	}
-
-	return backendURL + "/" + filepath.ToSlash(fullPath), nil
+	return imgData, ext, nil
 }
 
-func ImageToBase64(path string) (string, error) {
-	if path == "" {
-		return "", nil
-	}
+func EncodeBase64Image(data []byte, mime string) string {
+	return fmt.Sprintf("data:%s;base64,%s", mime, base64.StdEncoding.EncodeToString(data))
+}
 
-	// Extraer el path de la URL
-	parsedURL, err := url.Parse(path)
-	if err != nil {
-		return "", err
+// Saca la key de storage de la URL de una imagen (/uploads/<key>, relativa o absoluta).
+// Las absolutas se aceptan con cualquier origen: las versiones anteriores guardaban http://<host>:<puerto>/uploads/...
+// y ese origen puede ya no ser BACKEND_URL. Lo que decide es la key: tiene que estar en la carpeta de userID,
+// porque la URL la manda el cliente y no alcanza con el prefijo.
+func UploadKey(image, publicURL, userID string) (string, bool) {
+	parsedURL, err := url.Parse(image)
+	if err != nil || userID == "" {
+		return "", false
 	}
 
-	// Remover prefijo /uploads/ si tu carpeta local se llama "uploads"
-	localPath := strings.TrimPrefix(parsedURL.Path, "/")
-
-	// Limpiar y leer el archivo
-	p := filepath.Clean(localPath)
-	data, err := os.ReadFile(p)
-	if err != nil {
-		return "", fmt.Errorf("error reading file %s: %w", p, err)
+	prefixes := []string{"/uploads/"}
+	if base, err := url.Parse(publicURL); err == nil && strings.Trim(base.Path, "/") != "" {
+		prefixes = append(prefixes, strings.TrimRight(base.Path, "/")+"/uploads/")
 	}
-
-	ext := strings.ToLower(filepath.Ext(p))
-
-	var mime string
-	switch ext {
-	case ".jpg", ".jpeg":
-		mime = "image/jpeg"
-	case ".png":
-		mime = "image/png"
-	case ".webp":
-		mime = "image/webp"
-	default:
-		mime = "application/octet-stream"
+	for _, prefix := range prefixes {
+		rest, ok := strings.CutPrefix(parsedURL.Path, prefix)
+		if !ok {
+			continue
+		}
+		key, err := storage.CleanKey(rest)
+		if err == nil && strings.HasPrefix(key, "user_"+userID+"/") {
+			return key, true
+		}
 	}
-
-	base64Str := base64.StdEncoding.EncodeToString(data)
-	return fmt.Sprintf("data:%s;base64,%s", mime, base64Str), nil
+	return "", false
 }
@@ -0,0 +1,37 @@
+package utils
+
+import "testing"
+
+func TestUploadKey(t *testing.T) {
+	tests := []struct {
+		image     string
+		publicURL string
+		want      string // vacío = no es nuestra
+	}{
+		{"/uploads/user_1/abc.png", "", "user_1/abc.png"},
+		{"https://manga.example.com/uploads/user_1/abc.png", "https://manga.example.com", "user_1/abc.png"},
+		// URLs de versiones anteriores: otro host o puerto, o sin BACKEND_URL
+		{"http://localhost:4090/uploads/user_1/abc.png", "https://manga.example.com", "user_1/abc.png"},
+		{"http://192.168.0.10:4090/uploads/user_1/abc.png", "", "user_1/abc.png"},
+		// BACKEND_URL con path
+		{"https://example.com/manga/uploads/user_1/abc.png", "https://example.com/manga", "user_1/abc.png"},
+		{"/manga/uploads/user_1/abc.png", "https://example.com/manga", "user_1/abc.png"},
+
+		{"/uploads/user_2/abc.png", "", ""},                      // de otro usuario
+		{"http://localhost:4090/uploads/user_2/abc.png", "", ""}, // de otro usuario, absoluta
+		{"/uploads/user_1/../user_2/abc.png", "", ""},
+		{"/uploads/user_12/abc.png", "", ""},
+		{"https://cdn.example.com/covers/abc.png", "", ""},
+		{"https://cdn.example.com/img/uploads/user_1/abc.png", "", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		key, ok := UploadKey(tt.image, tt.publicURL, "1")
+		if key != tt.want || ok != (tt.want != "") {
+			t.Errorf("UploadKey(%q, %q) = %q, %v; want %q", tt.image, tt.publicURL, key, ok, tt.want)
+		}
+	}
+	if _, ok := UploadKey("/uploads/user_/abc.png", "", ""); ok {
+		t.Error("an empty user id must not match")
+	}
+}
@@ -0,0 +1,107 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+var ErrPoolClosed = errors.New("Worker pool is shutting down")
+
+type Task func(ctx context.Context) error
+
+type job struct {
+	name string
+	fn   Task
+}
+
+// Pool corre tareas en segundo plano (borrado de archivos, etc) con una cantidad fija de workers.
+// A diferencia de un "go func()" suelto, el shutdown espera a que terminen las pendientes.
+type Pool struct {
+	jobs   chan job
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewPool(workers, queueSize int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		jobs:   make(chan job, queueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.run()
+	}
+	return p
+}
+
+func (p *Pool) run() {
+	defer p.wg.Done()
+	for j := range p.jobs {
+		p.exec(j)
+	}
+}
+
+func (p *Pool) exec(j job) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("⚠ Task %s panicked: %v\n", j.name, r)
+		}
+	}()
+	if err := j.fn(p.ctx); err != nil {
+		log.Printf("⚠ Task %s failed: %v\n", j.name, err)
+	}
+}
+
+// Submit encola una tarea. Si la cola está llena espera a que haya lugar.
+func (p *Pool) Submit(name string, fn Task) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+
+	select {
+	case p.jobs <- job{name: name, fn: fn}:
+		return nil
+	case <-p.ctx.Done():
+		return ErrPoolClosed
+	}
+}
+
+// Shutdown deja de aceptar tareas y espera a que se vacíe la cola.
+// Si ctx vence antes, cancela el contexto de las tareas en curso y devuelve ctx.Err().
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		return ctx.Err()
+	}
+}